@@ -2,21 +2,50 @@ package agent
 
 import (
 	"fmt"
+	"github.com/appio/watchdog/journal"
+	"github.com/appio/watchdog/outlet"
 	"github.com/appio/watchdog/process"
 	"github.com/appio/watchdog/watchdog"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 )
 
 // Agent starts and manages the Watchdog instance.
 type Agent struct {
+	config *Config
+
 	// logger instance wraps the logOutput
 	logger *log.Logger
 
 	dog *watchdog.Watchdog
 
+	// journal stores process output, nil if there is no data directory
+	journal *journal.Journal
+
+	// registry persists registered processes, nil if there is no data
+	// directory
+	registry *registry
+
+	// inherited is the state handed over by the agent this one replaced
+	inherited *upgradeState
+
+	// configFiles are the process config files found in the process config
+	// directories, by path
+	configFiles     map[string]configFile
+	configFilesLock sync.Mutex
+	watching        bool
+
+	// reloadCh is used to request a reload of the configuration
+	reloadCh chan reloadRequest
+
+	// upgradeCh is used to request an upgrade
+	upgradeCh chan struct{}
+
 	// shutdownCh is used for shutdowns
 	shutdown     bool
 	shutdownCh   chan struct{}
@@ -30,57 +59,598 @@ func NewAgent(config *Config, logOutput io.Writer) *Agent {
 	}
 
 	return &Agent{
-		dog:        watchdog.New(),
-		logger:     log.New(logOutput, "", log.LstdFlags),
-		shutdownCh: make(chan struct{}),
+		config:      config,
+		dog:         watchdog.New(),
+		logger:      log.New(logOutput, "", log.LstdFlags),
+		configFiles: make(map[string]configFile),
+		shutdownCh:  make(chan struct{}),
+		upgradeCh:   make(chan struct{}, 1),
+		reloadCh:    make(chan reloadRequest),
 	}
 }
 
 func (a *Agent) Start() error {
 	a.logger.Println("[INFO] Watchdog starting...")
 
+	if a.config.DataDir != "" {
+		if err := os.MkdirAll(a.config.DataDir, 0755); err != nil {
+			return fmt.Errorf("error creating data directory: %s", err)
+		}
+		if err := a.openJournal(); err != nil {
+			return err
+		}
+
+		r, err := loadRegistry(a.config.DataDir)
+		if err != nil {
+			return err
+		}
+		a.registry = r
+	}
+
+	// Descendants of processes which outlive them are reparented to the
+	// agent rather than escaping to init
+	if err := a.dog.Subreap(); err != nil {
+		a.logger.Printf("[INFO] agent: Orphaned processes won't be reaped: %s", err)
+	}
+	a.dog.SampleStats()
+	go a.watchRuleEvents()
+
+	if a.inherited != nil {
+		a.resumeProcesses()
+	}
+
+	if a.registry != nil {
+		a.restoreRegistry()
+	}
+
+	if len(a.config.ProcessConfigDirs) > 0 {
+		a.scanConfigDirs()
+
+		a.configFilesLock.Lock()
+		a.watchConfigDirs()
+		a.configFilesLock.Unlock()
+	}
+
+	return nil
+}
+
+// restoreRegistry registers the processes recorded in the data directory and
+// restores their desired state
+func (a *Agent) restoreRegistry() {
+	for _, entry := range a.registry.Entries() {
+		// Processes handed over by an upgrade are already running
+		if a.dog.FindByName(entry.Name) != nil {
+			continue
+		}
+
+		// Processes whose file was removed from a process config directory
+		// were deregistered
+		if a.inConfigDir(entry.ConfigPath) {
+			if _, err := os.Stat(entry.ConfigPath); os.IsNotExist(err) {
+				a.registry.Remove(entry.Name)
+				continue
+			}
+		}
+
+		proc, err := a.RegisterProcess(entry.ConfigPath)
+		if err != nil {
+			// Keep the entry, the config may be back by the next restart
+			a.logger.Printf("[ERR] agent: Unable to restore process %s: %s", entry.Name, err)
+			continue
+		}
+
+		proc.Enabled = entry.Enabled
+		proc.SetRestarts(entry.Restarts)
+		a.updateRegistry(proc, nil)
+
+		if !entry.Started || !proc.Enabled {
+			continue
+		}
+
+		if a.adoptProcess(proc, entry.Identity) {
+			continue
+		}
+
+		if err := a.LaunchProcess(proc.Name); err != nil {
+			a.logger.Printf("[ERR] agent: Unable to start process %s: %s", proc.Name, err)
+		}
+	}
+}
+
+// adoptProcess takes over the instance of a process started by a previous
+// agent, if it is still running. The pid, start time and command line must
+// all match so an unrelated process which reused the pid isn't adopted.
+func (a *Agent) adoptProcess(proc *process.Process, id *process.Identity) bool {
+	if id == nil {
+		return false
+	}
+
+	current, err := process.Identify(id.Pid)
+	if err != nil || !current.Matches(id) {
+		return false
+	}
+
+	if err := proc.Adopt(id); err != nil {
+		a.logger.Printf("[ERR] agent: Unable to adopt process %s: %s", proc.Name, err)
+		return false
+	}
+
+	a.logger.Printf("[INFO] agent: Adopted running process: %s=%d", proc.Name, id.Pid)
+	a.logger.Printf("[WARN] agent: Output of adopted process %s can't be captured, its writes to stdout and stderr will fail", proc.Name)
+	return true
+}
+
+// updateRegistry records the current state of a process in the registry, if
+// there is one
+func (a *Agent) updateRegistry(proc *process.Process, update func(*registryEntry)) {
+	if a.registry == nil {
+		return
+	}
+
+	err := a.registry.Update(proc.Name, func(e *registryEntry) {
+		e.Enabled = proc.Enabled
+		e.Restarts = proc.History().Restarts
+		if update != nil {
+			update(e)
+		}
+	})
+	if err != nil {
+		a.logger.Printf("[ERR] agent: Unable to update registry: %s", err)
+	}
+}
+
+// openJournal opens the journal of process output in the data directory
+func (a *Agent) openJournal() error {
+	config := journal.Config{
+		Dir:     filepath.Join(a.config.DataDir, "journal"),
+		MaxSize: a.config.JournalMaxSize,
+	}
+
+	if a.config.JournalMaxAge != "" {
+		maxAge, err := time.ParseDuration(a.config.JournalMaxAge)
+		if err != nil {
+			return fmt.Errorf("invalid journal_max_age: %s", err)
+		}
+		config.MaxAge = maxAge
+	}
+
+	j, err := journal.Open(config)
+	if err != nil {
+		return err
+	}
+
+	a.journal = j
+	a.dog.SetJournal(j)
+	a.logger.Printf("[INFO] Journal: %s", config.Dir)
 	return nil
 }
 
 func (a *Agent) Shutdown() error {
+	if !a.stopBackground() {
+		return nil
+	}
+
 	a.logger.Println("[INFO] Gracefully shutting down...")
-	return a.dog.Shutdown()
+
+	// Record restart counters before processes are stopped. Their desired
+	// state is left alone so they are started again on the next boot.
+	for _, proc := range a.dog.Processes() {
+		a.updateRegistry(proc, nil)
+	}
+
+	var err error
+	if a.config.LeaveRunning {
+		a.logger.Println("[INFO] Leaving processes running")
+		a.dog.Detach()
+	} else {
+		err = a.dog.Shutdown()
+	}
+
+	if a.journal != nil {
+		a.journal.Close()
+	}
+	return err
+}
+
+// stopBackground marks the agent as shut down and stops its background
+// work, returning false if it was already shut down
+func (a *Agent) stopBackground() bool {
+	a.shutdownLock.Lock()
+	defer a.shutdownLock.Unlock()
+
+	if a.shutdown {
+		return false
+	}
+	a.shutdown = true
+	close(a.shutdownCh)
+
+	// Wait for a scan of the process config directories in progress
+	a.configFilesLock.Lock()
+	a.configFilesLock.Unlock()
+	return true
+}
+
+// restartBackground undoes stopBackground, when an upgrade fails after it
+// has stopped the agent
+func (a *Agent) restartBackground() {
+	a.shutdownLock.Lock()
+	a.shutdown = false
+	a.shutdownCh = make(chan struct{})
+	a.shutdownLock.Unlock()
+
+	go a.watchRuleEvents()
+
+	if len(a.config.ProcessConfigDirs) > 0 {
+		a.configFilesLock.Lock()
+		a.watching = false
+		a.watchConfigDirs()
+		a.configFilesLock.Unlock()
+	}
+}
+
+// ShutdownTimeout is the longest a graceful shutdown can take, waiting for
+// every process to stop
+func (a *Agent) ShutdownTimeout() time.Duration {
+	if a.config.LeaveRunning {
+		return 0
+	}
+	return a.dog.StopTimeout()
 }
 
 // ShutdownCh returns a channel that can be selected to wait
 // for the agent to perform a shutdown.
 func (a *Agent) ShutdownCh() <-chan struct{} {
+	a.shutdownLock.Lock()
+	defer a.shutdownLock.Unlock()
+
 	return a.shutdownCh
 }
 
+// UpgradeCh returns a channel that can be selected to wait for an upgrade
+// to be requested.
+func (a *Agent) UpgradeCh() <-chan struct{} {
+	return a.upgradeCh
+}
+
+// RequestUpgrade asks the agent command to upgrade the agent in place
+func (a *Agent) RequestUpgrade() {
+	select {
+	case a.upgradeCh <- struct{}{}:
+	default:
+	}
+}
+
+// reloadRequest asks the agent command to reload the configuration. The
+// changes made are sent on reply.
+type reloadRequest struct {
+	reply chan reloadResult
+}
+
+type reloadResult struct {
+	changes []string
+	err     error
+}
+
+// ReloadCh returns a channel that can be selected to wait for a reload of
+// the configuration to be requested.
+func (a *Agent) ReloadCh() <-chan reloadRequest {
+	return a.reloadCh
+}
+
+// RequestReload asks the agent command to reload the configuration files and
+// waits for the changes it made
+func (a *Agent) RequestReload() ([]string, error) {
+	req := reloadRequest{reply: make(chan reloadResult, 1)}
+
+	select {
+	case a.reloadCh <- req:
+	case <-a.ShutdownCh():
+		return nil, fmt.Errorf("agent is shutting down")
+	}
+
+	result := <-req.reply
+	return result.changes, result.err
+}
+
+// Reload applies a new configuration to the running agent, returning a
+// description of each change. The process config directories are scanned
+// again, even if they are unchanged. Settings which are only read when the
+// agent starts are reported but not applied.
+func (a *Agent) Reload(config *Config) []string {
+	a.configFilesLock.Lock()
+	old := a.config
+	next := *config
+
+	var changes []string
+	if old.LogLevel != next.LogLevel {
+		changes = append(changes, fmt.Sprintf("log_level: %s -> %s", old.LogLevel, next.LogLevel))
+	}
+	if strings.Join(old.ProcessConfigDirs, ",") != strings.Join(next.ProcessConfigDirs, ",") {
+		changes = append(changes, fmt.Sprintf("process_config_dir: %v -> %v",
+			old.ProcessConfigDirs, next.ProcessConfigDirs))
+	}
+
+	if old.LeaveRunning != next.LeaveRunning {
+		changes = append(changes, fmt.Sprintf("leave_running: %v -> %v", old.LeaveRunning, next.LeaveRunning))
+	}
+
+	restartOnly := func(key string, from, to interface{}) {
+		if from != to {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v (restart the agent to apply)", key, from, to))
+		}
+	}
+	restartOnly("rpc_addr", old.RPCAddr, next.RPCAddr)
+	restartOnly("data_dir", old.DataDir, next.DataDir)
+	restartOnly("journal_max_size", old.JournalMaxSize, next.JournalMaxSize)
+	restartOnly("journal_max_age", old.JournalMaxAge, next.JournalMaxAge)
+	next.RPCAddr = old.RPCAddr
+	next.DataDir = old.DataDir
+	next.JournalMaxSize = old.JournalMaxSize
+	next.JournalMaxAge = old.JournalMaxAge
+
+	a.config = &next
+	if len(next.ProcessConfigDirs) > 0 {
+		a.watchConfigDirs()
+	}
+	a.configFilesLock.Unlock()
+
+	// Processes from directories no longer configured are deregistered
+	changes = append(changes, a.scanConfigDirs()...)
+
+	return changes
+}
+
+// loadProcessConfig loads a process configuration file, checking its outlets
+// as well, which the process package can't as outlets depend on it
+func loadProcessConfig(path string) (*process.ProcessConfig, error) {
+	config, err := process.LoadConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, outletConfig := range config.Outlets {
+		if err := outlet.Validate(name, config.Name, outletConfig); err != nil {
+			return nil, fmt.Errorf("invalid configuration '%s': %s", path, err)
+		}
+	}
+	return config, nil
+}
+
 // RegisterProcess takes a configuration file and registers a new process
 func (a *Agent) RegisterProcess(configPath string) (*process.Process, error) {
-	config, err := process.LoadConfigFile(configPath)
+	config, err := loadProcessConfig(configPath)
 	if err != nil {
 		return nil, err
 	}
 
 	proc := process.NewProcessFromConfig(config)
+	proc.ConfigPath = configPath
+	if err := a.dog.Add(proc); err != nil {
+		return nil, err
+	}
 	proc.Run()
-	a.dog.Add(proc)
 
 	a.logger.Printf("[INFO] Registered process: %s", config.Name)
 
+	a.updateRegistry(proc, func(e *registryEntry) {
+		e.ConfigPath = configPath
+	})
+
 	return proc, nil
 }
 
-// StartProcess starts a process by name
+// StartProcess starts a process by name, returning once it is ready
 func (a *Agent) StartProcess(name string) (*process.Process, error) {
+	proc, ready, err := a.launchProcess(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.processReady(proc, <-ready); err != nil {
+		return nil, err
+	}
+	return proc, nil
+}
+
+// StartProcesses starts the named processes at once, so none waits for
+// another to be ready. It returns the processes started, in the order they
+// were named, and an error describing any which weren't.
+func (a *Agent) StartProcesses(names ...string) ([]*process.Process, error) {
+	procs := make([]*process.Process, len(names))
+	errs := make([]error, len(names))
+
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			procs[i], errs[i] = a.StartProcess(name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	var started []*process.Process
+	var failed []string
+	for i := range names {
+		if errs[i] != nil {
+			failed = append(failed, errs[i].Error())
+			continue
+		}
+		started = append(started, procs[i])
+	}
+
+	if len(failed) > 0 {
+		return started, fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return started, nil
+}
+
+// LaunchProcess starts a process by name without waiting for it to be ready,
+// so a slow process doesn't hold up the caller. Whether it becomes ready is
+// logged.
+func (a *Agent) LaunchProcess(name string) error {
+	proc, ready, err := a.launchProcess(name)
+	if err != nil {
+		return err
+	}
+
+	// Processes without readiness checks are ready already
+	select {
+	case err := <-ready:
+		a.processReady(proc, err)
+	default:
+		go func() {
+			if err := a.processReady(proc, <-ready); err != nil {
+				a.logger.Printf("[ERR] agent: Unable to start process %s: %s", name, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// launchProcess starts a process by name, recording it as started, and
+// returns the channel whether it becomes ready is sent on
+func (a *Agent) launchProcess(name string) (*process.Process, <-chan error, error) {
 	proc := a.dog.FindByName(name)
 	if proc == nil {
-		return nil, fmt.Errorf("Unable to find process: %s", name)
+		return nil, nil, fmt.Errorf("Unable to find process: %s", name)
 	}
 
 	a.logger.Printf("Starting process: %s...", name)
 
-	proc.Start()
+	ready, err := proc.Launch()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id, err := process.Identify(proc.PID())
+	if err != nil {
+		a.logger.Printf("[WARN] agent: Unable to identify process %s: %s", name, err)
+	}
+
+	a.updateRegistry(proc, func(e *registryEntry) {
+		e.Started = true
+		e.Identity = id
+	})
+
+	return proc, ready, nil
+}
+
+// processReady logs that a launched process is ready, or returns why it
+// isn't
+func (a *Agent) processReady(proc *process.Process, err error) error {
+	if err != nil {
+		return err
+	}
+	a.logger.Printf("Started process: %s=%d", proc.Name, proc.PID())
+	return nil
+}
+
+// watchRuleEvents logs processes restarted by their restart rules and
+// records their new instance, until the agent shuts down
+func (a *Agent) watchRuleEvents() {
+	shutdownCh := a.ShutdownCh()
+	for {
+		select {
+		case event := <-a.dog.RuleEvents():
+			if event.Err != nil {
+				a.logger.Printf("[ERR] agent: Unable to restart process %s for breaking rule %q: %s",
+					event.Process, event.Rule, event.Err)
+				continue
+			}
+			a.logger.Printf("[WARN] agent: Restarted process %s for breaking rule %q", event.Process, event.Rule)
+
+			proc := a.dog.FindByName(event.Process)
+			if proc == nil || proc.PID() == 0 {
+				continue
+			}
+			id, err := process.Identify(proc.PID())
+			if err != nil {
+				a.logger.Printf("[WARN] agent: Unable to identify process %s: %s", proc.Name, err)
+			}
+			a.updateRegistry(proc, func(e *registryEntry) {
+				e.Identity = id
+			})
+
+		case <-shutdownCh:
+			return
+		}
+	}
+}
+
+// StopProcess stops a process by name. It won't be started again when the
+// agent restarts.
+func (a *Agent) StopProcess(name string) (*process.Process, error) {
+	proc := a.dog.FindByName(name)
+	if proc == nil {
+		return nil, fmt.Errorf("Unable to find process: %s", name)
+	}
+
+	a.logger.Printf("Stopping process: %s...", name)
+
+	if err := proc.Stop(); err != nil {
+		return nil, err
+	}
 
-	a.logger.Printf("Started process: %s=%d", name, proc.PID())
+	a.updateRegistry(proc, func(e *registryEntry) {
+		e.Started = false
+		e.Identity = nil
+	})
 
 	return proc, nil
 }
+
+// DeregisterProcess stops a process and forgets it, removing it from the
+// registry
+func (a *Agent) DeregisterProcess(name string) error {
+	proc := a.dog.FindByName(name)
+	if proc == nil {
+		return fmt.Errorf("Unable to find process: %s", name)
+	}
+
+	if !proc.IsStopped() {
+		a.logger.Printf("Stopping process: %s...", name)
+		if err := proc.Stop(); err != nil {
+			return err
+		}
+	}
+
+	if err := a.dog.Remove(proc); err != nil {
+		return err
+	}
+
+	if a.registry != nil {
+		if err := a.registry.Remove(name); err != nil {
+			a.logger.Printf("[ERR] agent: Unable to update registry: %s", err)
+		}
+	}
+
+	a.logger.Printf("[INFO] Deregistered process: %s", name)
+	return nil
+}
+
+// Processes returns the named processes, or every registered process if no
+// names are given
+func (a *Agent) Processes(names ...string) ([]*process.Process, error) {
+	if len(names) == 0 {
+		return a.dog.Processes(), nil
+	}
+
+	var procs []*process.Process
+	for _, name := range names {
+		proc := a.dog.FindByName(name)
+		if proc == nil {
+			return nil, fmt.Errorf("Unable to find process: %s", name)
+		}
+		procs = append(procs, proc)
+	}
+	return procs, nil
+}
+
+// Logs queries the journal of a process. Output from processes which are no
+// longer registered, or from before the agent restarted, is included.
+func (a *Agent) Logs(q *journal.Query) ([]*process.Record, error) {
+	if a.journal == nil {
+		return nil, fmt.Errorf("The journal is disabled, set data_dir to enable it")
+	}
+	return a.journal.Query(q)
+}
@@ -14,7 +14,8 @@ import (
 	"time"
 )
 
-// gracefulTimeout controls how long we wait before forcefully terminating
+// gracefulTimeout controls how long we wait before forcefully terminating,
+// on top of the time processes are given to stop
 var gracefulTimeout = 3 * time.Second
 
 // Command is a Command implementation that runs a Watchdog agent.
@@ -26,6 +27,12 @@ type Command struct {
 	ShutdownCh <-chan struct{}
 	args       []string
 	logFilter  *logutils.LevelFilter
+	upgrade    bool
+
+	// configPaths and cmdConfig are the configuration files and flags, kept
+	// to read the configuration again on reload
+	configPaths []string
+	cmdConfig   Config
 }
 
 func (c *Command) Run(args []string) int {
@@ -45,6 +52,17 @@ func (c *Command) Run(args []string) int {
 		return 1
 	}
 
+	if c.upgrade {
+		return c.requestUpgrade(config)
+	}
+
+	// Pick up where the agent this one replaced left off
+	inherited, err := loadUpgradeState()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return 1
+	}
+
 	// Setup the log outputs
 	logGate, logWriter, logOutput := c.setupLoggers(config)
 	if logWriter == nil {
@@ -56,10 +74,11 @@ func (c *Command) Run(args []string) int {
 	if agent == nil {
 		return 1
 	}
+	agent.inherited = inherited
 	defer agent.Shutdown()
 
 	// Start the agent
-	ipc := c.startAgent(config, agent, logWriter, logOutput)
+	ipc := c.startAgent(config, agent, logWriter, logOutput, inherited)
 	if ipc == nil {
 		return 1
 	}
@@ -73,12 +92,12 @@ func (c *Command) Run(args []string) int {
 	logGate.Flush()
 
 	// Wait for exit
-	return c.handleSignals(agent)
+	return c.handleSignals(agent, ipc)
 }
 
 // startAgent is used to start the agent and IPC
 func (c *Command) startAgent(config *Config, agent *Agent,
-	logWriter *logWriter, logOutput io.Writer) *AgentIPC {
+	logWriter *logWriter, logOutput io.Writer, inherited *upgradeState) *AgentIPC {
 
 	// Start the agent after the handler is registered
 	if err := agent.Start(); err != nil {
@@ -86,8 +105,19 @@ func (c *Command) startAgent(config *Config, agent *Agent,
 		return nil
 	}
 
-	// Setup the RPC listener
-	rpcListener, err := net.Listen("tcp", config.RPCAddr)
+	// Setup the RPC listener, taking over the previous agent's after an
+	// upgrade
+	var rpcListener net.Listener
+	var err error
+	if inherited != nil {
+		// The listener is dup'd, so the inherited descriptor is closed
+		// rather than left to the processes the agent starts
+		listenerFile := os.NewFile(inherited.Listener, "rpc")
+		rpcListener, err = net.FileListener(listenerFile)
+		listenerFile.Close()
+	} else {
+		rpcListener, err = net.Listen("tcp", config.RPCAddr)
+	}
 	if err != nil {
 		c.Ui.Error(fmt.Sprintf("Error starting RPC listener: %s", err))
 		return nil
@@ -117,41 +147,81 @@ func (c *Command) readConfig() *Config {
 	cmdFlags.StringVar(&cmdConfig.LogLevel, "log-level", "", "log level")
 	cmdFlags.StringVar(&cmdConfig.RPCAddr, "rpc-addr", "",
 		"address to bind RPC listener to")
+	cmdFlags.StringVar(&cmdConfig.DataDir, "data-dir", "",
+		"directory to store agent state in")
+	cmdFlags.Var((*AppendSliceValue)(&cmdConfig.ProcessConfigDirs), "process-config-dir",
+		"directory of process configs to register and watch")
+	cmdFlags.BoolVar(&c.upgrade, "upgrade", false,
+		"upgrade the running agent in place")
 
 	if err := cmdFlags.Parse(c.args); err != nil {
 		return nil
 	}
 
+	c.configPaths = configFiles
+	c.cmdConfig = cmdConfig
+
+	config, err := c.loadConfig()
+	if err != nil {
+		c.Ui.Error(err.Error())
+		return nil
+	}
+	return config
+}
+
+// loadConfig reads the configuration files, with the flags taking precedence
+func (c *Command) loadConfig() (*Config, error) {
 	config := DefaultConfig
-	if len(configFiles) > 0 {
-		fileConfig, err := ReadConfigPaths(configFiles)
+	if len(c.configPaths) > 0 {
+		fileConfig, err := ReadConfigPaths(c.configPaths)
 		if err != nil {
-			c.Ui.Error(err.Error())
-			return nil
+			return nil, err
 		}
 
 		config = MergeConfig(config, fileConfig)
 	}
 
-	config = MergeConfig(config, &cmdConfig)
-	return config
+	config = MergeConfig(config, &c.cmdConfig)
+	return config, nil
 }
 
 // handleSignals blocks until we get an exit-causing signal
-func (c *Command) handleSignals(agent *Agent) int {
+func (c *Command) handleSignals(agent *Agent, ipc *AgentIPC) int {
+	// A failed upgrade replaces the IPC layer
+	defer func() {
+		ipc.Shutdown()
+	}()
+
 	signalCh := make(chan os.Signal, 4)
-	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	signal.Notify(signalCh, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR2)
 
 	// Wait for a signal
 	var sig os.Signal
-	select {
-	case s := <-signalCh:
-		sig = s
-	case <-c.ShutdownCh:
-		sig = os.Interrupt
-	case <-agent.ShutdownCh():
-		// Agent is already shutdown!
-		return 0
+	for sig == nil {
+		select {
+		case s := <-signalCh:
+			switch s {
+			case syscall.SIGUSR2:
+				ipc = c.handleUpgrade(agent, ipc)
+				continue
+			case syscall.SIGHUP:
+				if _, err := c.handleReload(agent); err != nil {
+					c.Ui.Error(fmt.Sprintf("Reload failed: %s", err))
+				}
+				continue
+			}
+			sig = s
+		case <-agent.UpgradeCh():
+			ipc = c.handleUpgrade(agent, ipc)
+		case req := <-agent.ReloadCh():
+			changes, err := c.handleReload(agent)
+			req.reply <- reloadResult{changes: changes, err: err}
+		case <-c.ShutdownCh:
+			sig = os.Interrupt
+		case <-agent.ShutdownCh():
+			// Agent is already shutdown!
+			return 0
+		}
 	}
 	c.Ui.Output(fmt.Sprintf("Caught signal: %v", sig))
 
@@ -183,13 +253,99 @@ func (c *Command) handleSignals(agent *Agent) int {
 	select {
 	case <-signalCh:
 		return 1
-	case <-time.After(gracefulTimeout):
+	case <-time.After(gracefulTimeout + agent.ShutdownTimeout()):
 		return 1
 	case <-gracefulCh:
 		return 0
 	}
 }
 
+// handleReload reads the configuration files again and applies the changes
+// to the running agent. Processes keep running.
+func (c *Command) handleReload(agent *Agent) ([]string, error) {
+	c.Ui.Output("Reloading configuration...")
+
+	config, err := c.loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	minLevel := logutils.LogLevel(strings.ToUpper(config.LogLevel))
+	if !ValidateLevelFilter(minLevel, c.logFilter) {
+		return nil, fmt.Errorf("Invalid log level: %s. Valid log levels are: %v",
+			minLevel, c.logFilter.Levels)
+	}
+
+	changes := agent.Reload(config)
+	c.logFilter.SetMinLevel(minLevel)
+
+	if len(changes) == 0 {
+		c.Ui.Info("No changes")
+	}
+	for _, change := range changes {
+		c.Ui.Info(change)
+	}
+	return changes, nil
+}
+
+// handleUpgrade replaces the agent with its binary on disk, which may be a
+// newer version, without stopping processes. It only returns if the upgrade
+// fails, in which case the agent carries on as before, returning the IPC
+// layer listening for clients again.
+func (c *Command) handleUpgrade(agent *Agent, ipc *AgentIPC) *AgentIPC {
+	c.Ui.Output("Upgrading agent...")
+
+	executable, err := agent.UpgradeExecutable()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Unable to upgrade: %s", err))
+		return ipc
+	}
+
+	listener, ok := ipc.listener.(*net.TCPListener)
+	if !ok {
+		c.Ui.Error("Unable to upgrade: RPC listener can't be passed on")
+		return ipc
+	}
+	listenerFile, err := listener.File()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Unable to upgrade: %s", err))
+		return ipc
+	}
+	defer listenerFile.Close()
+
+	// Clients reconnect to the new agent through the same listener
+	ipc.Shutdown()
+
+	err = agent.Upgrade(executable, listenerFile)
+	c.Ui.Error(fmt.Sprintf("Upgrade failed: %s", err))
+
+	// The agent has taken its processes back, so clients reconnect to it
+	rpcListener, err := net.FileListener(listenerFile)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error starting RPC listener: %s", err))
+		return ipc
+	}
+	return NewAgentIPC(agent, rpcListener, ipc.logger.Writer(), ipc.logWriter)
+}
+
+// requestUpgrade asks the running agent to upgrade itself in place
+func (c *Command) requestUpgrade(config *Config) int {
+	client, err := NewRPCClient(config.RPCAddr)
+	if err != nil {
+		c.Ui.Error("Error connecting to Watchdog agent")
+		return 1
+	}
+	defer client.Close()
+
+	if err := client.Upgrade(); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error upgrading agent: %s", err))
+		return 1
+	}
+
+	c.Ui.Output("Agent is upgrading")
+	return 0
+}
+
 // setupLoggers is used to setup the logGate, logWriter, and our logOutput
 func (c *Command) setupLoggers(config *Config) (*GatedWriter, *logWriter, io.Writer) {
 	// Setup logging. First create the gated log writer, which will
@@ -227,8 +383,14 @@ Usage: watchdog agent [options]
   will run in the foreground as it is designed to run under the supervision of
   the OS process manager Upstart/launchd.
 
+  Sending the agent SIGHUP reloads the configuration files, applying changes
+  to the log level and process config directories without restarting
+  processes. "watchdog reload" does the same.
+
 Options:
 
+  -data-dir=foo            Directory to store agent state in, such as the
+                           journal of process output.
   -config-file=foo         Path to a JSON or TOML file to read configuration from.
                            This can be specified multiple times.
   -config-dir=foo          Path to a directory to read configuration files
@@ -236,7 +398,15 @@ Options:
                            in ".json" or ".toml" as configuration in this
                            directory in alphabetical order.
   -log-level=info          Log level of the agent (debug,info,warn,error).
+  -process-config-dir=foo  Path to a directory of process configuration files.
+                           Every ".json" or ".toml" file is registered as a
+                           process, and the directory is watched for files
+                           being added, changed and removed. This can be
+                           specified multiple times.
   -rpc-addr=127.0.0.1:6673 Address to bind the RPC listener.
+  -upgrade                 Upgrade the agent listening on -rpc-addr in place
+                           to the binary now on disk, without stopping its
+                           processes. Sending the agent SIGUSR2 does the same.
 
 `
 	return strings.TrimSpace(helpText)
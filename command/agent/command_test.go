@@ -3,6 +3,10 @@ package agent
 import (
 	"github.com/hashicorp/serf/testutil"
 	"github.com/mitchellh/cli"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -51,3 +55,81 @@ func TestCommandRun(t *testing.T) {
 		t.Fatalf("timeout")
 	}
 }
+
+func TestCommandRun_reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "agent.json")
+	ioutil.WriteFile(configPath, []byte(`{"log_level": "INFO"}`), 0644)
+
+	processDir := filepath.Join(dir, "processes")
+	os.Mkdir(processDir, 0755)
+	ioutil.WriteFile(filepath.Join(processDir, "web.json"),
+		[]byte(`{"name": "web", "program": "/bin/sleep"}`), 0644)
+
+	shutdownCh := make(chan struct{})
+	defer close(shutdownCh)
+
+	ui := new(cli.MockUi)
+	c := &Command{
+		ShutdownCh: shutdownCh,
+		Ui:         ui,
+	}
+
+	rpcAddr := getRPCAddr()
+	args := []string{
+		"-rpc-addr", rpcAddr,
+		"-config-file", configPath,
+	}
+
+	resultCh := make(chan int)
+	go func() {
+		resultCh <- c.Run(args)
+	}()
+
+	testutil.Yield()
+	time.Sleep(50 * time.Millisecond)
+
+	ioutil.WriteFile(configPath, []byte(`{
+		"log_level": "DEBUG",
+		"process_config_dir": ["`+processDir+`"]
+	}`), 0644)
+
+	client, err := NewRPCClient(rpcAddr)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer client.Close()
+
+	changes, err := client.Reload()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{"log_level: INFO -> DEBUG", "process_config_dir", "registered process web"}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %v", len(expected), changes)
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(changes[i], prefix) {
+			t.Errorf("expected change %q, got %q", prefix, changes[i])
+		}
+	}
+	if c.logFilter.MinLevel != "DEBUG" {
+		t.Errorf("expected log level DEBUG, got %s", c.logFilter.MinLevel)
+	}
+
+	shutdownCh <- struct{}{}
+	select {
+	case code := <-resultCh:
+		if code != 0 {
+			t.Fatalf("bad code: %d", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout")
+	}
+}
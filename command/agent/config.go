@@ -34,10 +34,29 @@ type Config struct {
 	// interface.
 	RPCAddr string `mapstructure:"rpc_addr"`
 
-	// // ConfigDir is the directory to load process configurations from. This
-	// // directory will be watched for changes.
-	// ConfigDir string `mapstructure:"config_dir"`
-	//
+	// DataDir is the directory the agent keeps its state in, such as the
+	// journal of process output. The journal is disabled if it isn't set.
+	DataDir string `mapstructure:"data_dir"`
+
+	// JournalMaxSize is the most output in bytes kept in the journal for each
+	// process. The default is 256MB.
+	JournalMaxSize int64 `mapstructure:"journal_max_size"`
+
+	// JournalMaxAge is how long output is kept in the journal, such as
+	// "72h". The default is 7 days.
+	JournalMaxAge string `mapstructure:"journal_max_age"`
+
+	// ProcessConfigDirs are directories to load process configurations
+	// from. Every ".json" and ".toml" file is registered as a process, and
+	// the directories are watched for files being added, changed and
+	// removed.
+	ProcessConfigDirs []string `mapstructure:"process_config_dir"`
+
+	// LeaveRunning leaves processes running when the agent exits, instead of
+	// stopping them. With a data directory they are adopted when the agent
+	// starts again.
+	LeaveRunning bool `mapstructure:"leave_running"`
+
 	// // LogEntriesToken is used to authenticate the logging from the agent to LE.
 	// // This is only used for sending agent/watchdog logs, not supervised process
 	// // logs.
@@ -122,6 +141,27 @@ func MergeConfig(a, b *Config) *Config {
 		result.RPCAddr = b.RPCAddr
 	}
 
+	if b.DataDir != "" {
+		result.DataDir = b.DataDir
+	}
+
+	if b.JournalMaxSize != 0 {
+		result.JournalMaxSize = b.JournalMaxSize
+	}
+
+	if b.JournalMaxAge != "" {
+		result.JournalMaxAge = b.JournalMaxAge
+	}
+
+	if b.LeaveRunning {
+		result.LeaveRunning = true
+	}
+
+	// Copy the process config dirs
+	result.ProcessConfigDirs = make([]string, 0, len(a.ProcessConfigDirs)+len(b.ProcessConfigDirs))
+	result.ProcessConfigDirs = append(result.ProcessConfigDirs, a.ProcessConfigDirs...)
+	result.ProcessConfigDirs = append(result.ProcessConfigDirs, b.ProcessConfigDirs...)
+
 	return &result
 }
 
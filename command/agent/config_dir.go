@@ -0,0 +1,200 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// configDirPollInterval is how often the process config directories are
+// scanned for changes
+var configDirPollInterval = 2 * time.Second
+
+// configFile is a process config file found in a process config directory
+type configFile struct {
+	// Name is the process registered from the file, empty if it couldn't be
+	// registered
+	Name string
+
+	ModTime time.Time
+	Size    int64
+}
+
+// changed reports whether the file was modified since it was loaded
+func (f configFile) changed(fi os.FileInfo) bool {
+	return !f.ModTime.Equal(fi.ModTime()) || f.Size != fi.Size()
+}
+
+// watchConfigDirs scans the process config directories for changes until
+// the agent shuts down. It must be called with configFilesLock held.
+func (a *Agent) watchConfigDirs() {
+	if a.watching {
+		return
+	}
+	a.watching = true
+
+	shutdownCh := a.ShutdownCh()
+	go func() {
+		for {
+			select {
+			case <-time.After(configDirPollInterval):
+				a.scanConfigDirs()
+			case <-shutdownCh:
+				return
+			}
+		}
+	}()
+}
+
+// scanConfigDirs registers processes for new config files, reloads those
+// whose file changed and deregisters those whose file was removed. It returns
+// a description of each change.
+func (a *Agent) scanConfigDirs() []string {
+	a.configFilesLock.Lock()
+	defer a.configFilesLock.Unlock()
+
+	var changes []string
+
+	found := make(map[string]os.FileInfo)
+	unreadable := make(map[string]bool)
+	var paths []string
+
+	for _, dir := range a.config.ProcessConfigDirs {
+		contents, err := ioutil.ReadDir(dir)
+		if err != nil {
+			// Leave its processes alone until it can be read again
+			a.logger.Printf("[ERR] agent: Unable to read process config dir: %s", err)
+			unreadable[filepath.Clean(dir)] = true
+			continue
+		}
+
+		for _, fi := range contents {
+			if fi.IsDir() || !isProcessConfigFile(fi.Name()) {
+				continue
+			}
+
+			path := filepath.Join(filepath.Clean(dir), fi.Name())
+			found[path] = fi
+			paths = append(paths, path)
+		}
+	}
+
+	// Deregister before registering, so a process moved to another file
+	// doesn't clash with itself
+	for path, f := range a.configFiles {
+		if _, ok := found[path]; ok || unreadable[filepath.Dir(path)] {
+			continue
+		}
+
+		delete(a.configFiles, path)
+		if f.Name == "" {
+			continue
+		}
+
+		a.logger.Printf("[INFO] agent: Process config removed: %s", path)
+		if err := a.DeregisterProcess(f.Name); err != nil {
+			a.logger.Printf("[ERR] agent: Unable to deregister process %s: %s", f.Name, err)
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("deregistered process %s", f.Name))
+	}
+
+	for _, path := range paths {
+		fi := found[path]
+
+		f, known := a.configFiles[path]
+		if known && !f.changed(fi) {
+			continue
+		}
+
+		loaded, change := a.loadConfigFile(path, fi, f.Name)
+		a.configFiles[path] = loaded
+		if change != "" {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes
+}
+
+// loadConfigFile registers the process configured by a file, replacing the
+// process previously registered from it, if any. It returns a description of
+// the change, if one was made.
+func (a *Agent) loadConfigFile(path string, fi os.FileInfo, previous string) (configFile, string) {
+	f := configFile{ModTime: fi.ModTime(), Size: fi.Size()}
+
+	config, err := loadProcessConfig(path)
+	if err != nil {
+		// Keep the previous process until the file is fixed
+		a.logger.Printf("[ERR] agent: Unable to load process config %s: %s", path, err)
+		f.Name = previous
+		return f, ""
+	}
+
+	// Processes restored from the registry are already registered from their
+	// file
+	if previous == "" {
+		if proc := a.dog.FindByName(config.Name); proc != nil {
+			if proc.ConfigPath != path {
+				a.logger.Printf("[ERR] agent: Unable to register %s: process %s is already registered from %s",
+					path, config.Name, proc.ConfigPath)
+				return f, ""
+			}
+
+			f.Name = config.Name
+			return f, ""
+		}
+	}
+
+	change := "registered process %s"
+	wasRunning := false
+	if previous != "" {
+		if proc := a.dog.FindByName(previous); proc != nil {
+			wasRunning = !proc.IsStopped()
+		}
+
+		a.logger.Printf("[INFO] agent: Process config changed: %s", path)
+		if err := a.DeregisterProcess(previous); err != nil {
+			a.logger.Printf("[ERR] agent: Unable to deregister process %s: %s", previous, err)
+		}
+		change = "reloaded process %s"
+	}
+
+	proc, err := a.RegisterProcess(path)
+	if err != nil {
+		a.logger.Printf("[ERR] agent: Unable to register process %s: %s", path, err)
+		return f, ""
+	}
+	f.Name = proc.Name
+
+	if proc.Enabled && (wasRunning || proc.RunAtLoad) {
+		if err := a.LaunchProcess(proc.Name); err != nil {
+			a.logger.Printf("[ERR] agent: Unable to start process %s: %s", proc.Name, err)
+		}
+	}
+
+	return f, fmt.Sprintf(change, proc.Name)
+}
+
+// inConfigDir reports whether a process config file is in one of the process
+// config directories
+func (a *Agent) inConfigDir(path string) bool {
+	for _, dir := range a.config.ProcessConfigDirs {
+		if filepath.Clean(dir) == filepath.Dir(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// isProcessConfigFile reports whether a file in a process config directory
+// is a process config
+func isProcessConfigFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	return strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".toml")
+}
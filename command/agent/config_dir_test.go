@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAgent_processConfigDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	write("web.json", `{"name": "web", "program": "/bin/sleep", "program_arguments": ["5"], "run_at_load": true}`)
+	write("worker.toml", "name = \"worker\"\nprogram = \"/bin/sleep\"\n")
+	write("README.txt", "not a process")
+
+	agent := NewAgent(&Config{ProcessConfigDirs: []string{dir}}, ioutil.Discard)
+	if err := agent.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer agent.Shutdown()
+
+	procs, _ := agent.Processes()
+	if len(procs) != 2 || procs[0].Name != "web" || procs[1].Name != "worker" {
+		t.Fatalf("expected web and worker to be registered, got %d processes", len(procs))
+	}
+	if !procs[0].IsRunning() || procs[1].IsRunning() {
+		t.Fatalf("expected only web to be started at load")
+	}
+
+	// Rename a process, remove one and add another
+	write("worker.toml", "name = \"jobs\"\nprogram = \"/bin/sleep\"\n")
+	os.Remove(filepath.Join(dir, "web.json"))
+	write("cron.json", `{"name": "cron", "program": "/bin/sleep"}`)
+	agent.scanConfigDirs()
+
+	procs, _ = agent.Processes()
+	var names []string
+	for _, proc := range procs {
+		names = append(names, proc.Name)
+	}
+	if len(names) != 2 || names[0] != "cron" || names[1] != "jobs" {
+		t.Fatalf("expected cron and jobs to be registered, got %v", names)
+	}
+
+	// A broken file leaves the process registered
+	write("cron.json", `{"name": `)
+	agent.scanConfigDirs()
+	if agent.dog.FindByName("cron") == nil {
+		t.Fatalf("expected cron to stay registered")
+	}
+
+	// So does one with an invalid outlet
+	write("cron.json", `{"name": "cron", "program": "/bin/sleep", "outlets": {"loggly": {"token": "abc", "min_level": "loud"}}}`)
+	agent.scanConfigDirs()
+	if proc := agent.dog.FindByName("cron"); proc == nil || proc.Outlets != nil {
+		t.Fatalf("expected cron to stay registered without the outlet")
+	}
+}
@@ -21,6 +21,31 @@ func TestDecodeConfig(t *testing.T) {
 	}
 }
 
+func TestDecodeConfig_journal(t *testing.T) {
+	input := `{"data_dir": "/var/lib/watchdog", "journal_max_size": 1048576, "journal_max_age": "24h"}`
+	config, err := DecodeConfigFromJSON(bytes.NewReader([]byte(input)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	config = MergeConfig(DefaultConfig, config)
+	if config.DataDir != "/var/lib/watchdog" || config.JournalMaxSize != 1048576 || config.JournalMaxAge != "24h" {
+		t.Fatalf("bad: %#v", config)
+	}
+}
+
+func TestMergeConfig_processConfigDirs(t *testing.T) {
+	a := &Config{ProcessConfigDirs: []string{"/etc/watchdog/processes"}}
+	b := &Config{ProcessConfigDirs: []string{"/opt/app/processes"}}
+
+	config := MergeConfig(a, b)
+	if len(config.ProcessConfigDirs) != 2 ||
+		config.ProcessConfigDirs[0] != "/etc/watchdog/processes" ||
+		config.ProcessConfigDirs[1] != "/opt/app/processes" {
+		t.Fatalf("bad: %#v", config.ProcessConfigDirs)
+	}
+}
+
 func TestReadConfigPaths_JSON_file(t *testing.T) {
 	tf, err := ioutil.TempFile("", "watchdog.json")
 	if err != nil {
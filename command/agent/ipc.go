@@ -49,6 +49,11 @@ const (
 	stopCommand       = "stop"
 	restartCommand    = "restart"
 	monitorCommand    = "monitor"
+	statusCommand     = "status"
+	logsCommand       = "logs"
+	upgradeCommand    = "upgrade"
+	reloadCommand     = "reload"
+	statsCommand      = "stats"
 )
 
 // Errors
@@ -96,6 +101,135 @@ type startResponse struct {
 	Pids []int
 }
 
+type stopRequest struct {
+	Names []string
+}
+
+type stopResponse struct {
+	Names []string
+}
+
+type statusRequest struct {
+	Names []string
+}
+
+type statusResponse struct {
+	Processes []ProcessStatus
+}
+
+// ProcessStatus is a snapshot of the state of a process
+type ProcessStatus struct {
+	Name           string
+	State          string
+	Pid            int
+	StartedAt      int64
+	LastExitStatus int
+	LastExitReason string
+	Restarts       int
+	DroppedLines   uint64
+
+	// Limits are the resource limits the process runs with
+	Limits []ProcessLimit
+
+	// Nice, IOPriority, CPUAffinity and OOMScoreAdjust are the scheduling
+	// settings the process runs with, empty if unset
+	Nice           string
+	IOPriority     string
+	CPUAffinity    string
+	OOMScoreAdjust string
+
+	// StatusText is the status a process with notify last sent, and MainPid
+	// its main pid, which is Pid unless it sent another
+	StatusText string
+	MainPid    int
+
+	// Adopted is set if the process was adopted from a previous agent, so
+	// its output isn't captured
+	Adopted bool
+}
+
+// ProcessLimit is a resource limit of a process, with "unlimited" for no
+// limit
+type ProcessLimit struct {
+	Resource string
+	Soft     string
+	Hard     string
+}
+
+type statsRequest struct {
+	Names []string
+
+	// History is how many samples to return for each process, the most
+	// recent first. Only the latest is returned if it isn't positive.
+	History int
+}
+
+type statsResponse struct {
+	Processes []ProcessStats
+}
+
+// ProcessStats is the recent resource usage of a process
+type ProcessStats struct {
+	Name  string
+	State string
+	Pid   int
+
+	// Samples are the most recent samples first, which may be of previous
+	// instances of the process
+	Samples []StatsSample
+}
+
+// StatsSample is the resource usage of a process at a point in time. Times
+// are in nanoseconds and sizes in bytes.
+type StatsSample struct {
+	Time          int64
+	Pid           int
+	CPUTime       int64
+	CPUPercent    float64
+	RSS           uint64
+	FDs           int
+	Threads       int
+	ReadBytes     uint64
+	WriteBytes    uint64
+	CgroupMemory  uint64
+	CgroupCPUTime int64
+	CgroupPids    int
+}
+
+// LogsQuery selects output from the journal of a process
+type LogsQuery struct {
+	Name string
+
+	// Since and Until bound the time of output in Unix nanoseconds, if set
+	Since int64
+	Until int64
+
+	// Stream is "stdout" or "stderr", or empty for both
+	Stream string
+
+	// Grep is a regular expression lines must match
+	Grep string
+
+	// Limit returns only the most recent lines, if positive
+	Limit int
+}
+
+type logsResponse struct {
+	Entries []LogEntry
+}
+
+type reloadResponse struct {
+	Changes []string
+}
+
+// LogEntry is a line of output from the journal
+type LogEntry struct {
+	Time   int64
+	Stream string
+	Pid    int
+	Line   string
+}
+
 type monitorRequest struct {
 	LogLevel string
 }
@@ -302,6 +436,24 @@ func (i *AgentIPC) handleRequest(client *IPCClient, reqHeader *requestHeader) er
 	case startCommand:
 		return i.handleStart(client, seq)
 
+	case stopCommand:
+		return i.handleStop(client, seq)
+
+	case statusCommand:
+		return i.handleStatus(client, seq)
+
+	case statsCommand:
+		return i.handleStats(client, seq)
+
+	case logsCommand:
+		return i.handleLogs(client, seq)
+
+	case upgradeCommand:
+		return i.handleUpgrade(client, seq)
+
+	case reloadCommand:
+		return i.handleReload(client, seq)
+
 	default:
 		respHeader := responseHeader{Seq: seq, Error: unsupportedCommand}
 		client.Send(&respHeader, nil)
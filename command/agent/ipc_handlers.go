@@ -2,6 +2,11 @@ package agent
 
 import (
 	"fmt"
+	"github.com/appio/watchdog/journal"
+	"github.com/appio/watchdog/process"
+	"regexp"
+	"strconv"
+	"time"
 )
 
 func (a *AgentIPC) handleRegister(client *IPCClient, seq uint64) error {
@@ -37,14 +42,40 @@ func (a *AgentIPC) handleStart(client *IPCClient, seq uint64) error {
 		return fmt.Errorf("decode failed: %v", err)
 	}
 
+	// Processes which didn't start or become ready are reported in the
+	// error, alongside the pids of those which did
+	procs, err := a.agent.StartProcesses(req.Names...)
+
 	var pids []int
+	for _, proc := range procs {
+		pids = append(pids, proc.PID())
+	}
+
+	// Respond
+	header := responseHeader{
+		Seq:   seq,
+		Error: errToString(err),
+	}
+	resp := startResponse{
+		Pids: pids,
+	}
+	return client.Send(&header, &resp)
+}
+
+func (a *AgentIPC) handleStop(client *IPCClient, seq uint64) error {
+	var req stopRequest
+	if err := client.dec.Decode(&req); err != nil {
+		return fmt.Errorf("decode failed: %v", err)
+	}
+
+	var names []string
 	for _, name := range req.Names {
-		proc, err := a.agent.StartProcess(name)
+		proc, err := a.agent.StopProcess(name)
 		if err != nil {
 			continue
 		}
 
-		pids = append(pids, proc.PID())
+		names = append(names, proc.Name)
 	}
 
 	// Respond
@@ -52,8 +83,200 @@ func (a *AgentIPC) handleStart(client *IPCClient, seq uint64) error {
 		Seq:   seq,
 		Error: errToString(nil),
 	}
-	resp := startResponse{
-		Pids: pids,
+	resp := stopResponse{
+		Names: names,
+	}
+	return client.Send(&header, &resp)
+}
+
+func (a *AgentIPC) handleStatus(client *IPCClient, seq uint64) error {
+	var req statusRequest
+	if err := client.dec.Decode(&req); err != nil {
+		return fmt.Errorf("decode failed: %v", err)
+	}
+
+	procs, err := a.agent.Processes(req.Names...)
+
+	var statuses []ProcessStatus
+	for _, proc := range procs {
+		history := proc.History()
+		status := ProcessStatus{
+			Name:           proc.Name,
+			State:          proc.Status(),
+			Pid:            proc.PID(),
+			LastExitStatus: history.LastExitStatus,
+			LastExitReason: process.ExitReason(history.LastExitStatus),
+			Restarts:       history.Restarts,
+			DroppedLines:   proc.DroppedLines(),
+			StatusText:     proc.StatusText(),
+			MainPid:        proc.MainPID(),
+			Adopted:        proc.Adopted(),
+		}
+		if !history.StartedAt.IsZero() {
+			status.StartedAt = history.StartedAt.Unix()
+		}
+		for _, l := range proc.Limits {
+			status.Limits = append(status.Limits, ProcessLimit{
+				Resource: l.Resource,
+				Soft:     process.FormatLimitValue(l.Soft),
+				Hard:     process.FormatLimitValue(l.Hard),
+			})
+		}
+		if sched := proc.Scheduling; sched != nil {
+			if sched.Nice != nil {
+				status.Nice = strconv.Itoa(*sched.Nice)
+			}
+			status.IOPriority = sched.IOString()
+			status.CPUAffinity = sched.AffinityString()
+			if sched.OOMScoreAdjust != nil {
+				status.OOMScoreAdjust = strconv.Itoa(*sched.OOMScoreAdjust)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	// Respond
+	header := responseHeader{
+		Seq:   seq,
+		Error: errToString(err),
+	}
+	resp := statusResponse{
+		Processes: statuses,
+	}
+	return client.Send(&header, &resp)
+}
+
+func (a *AgentIPC) handleStats(client *IPCClient, seq uint64) error {
+	var req statsRequest
+	if err := client.dec.Decode(&req); err != nil {
+		return fmt.Errorf("decode failed: %v", err)
+	}
+
+	history := req.History
+	if history <= 0 {
+		history = 1
+	}
+
+	procs, err := a.agent.Processes(req.Names...)
+
+	var stats []ProcessStats
+	for _, proc := range procs {
+		ps := ProcessStats{
+			Name:  proc.Name,
+			State: proc.Status(),
+			Pid:   proc.PID(),
+		}
+
+		samples := proc.Stats()
+		for i := len(samples) - 1; i >= 0 && len(ps.Samples) < history; i-- {
+			s := samples[i]
+			ps.Samples = append(ps.Samples, StatsSample{
+				Time:          s.Time.UnixNano(),
+				Pid:           s.Pid,
+				CPUTime:       int64(s.CPUTime),
+				CPUPercent:    s.CPUPercent,
+				RSS:           s.RSS,
+				FDs:           s.FDs,
+				Threads:       s.Threads,
+				ReadBytes:     s.ReadBytes,
+				WriteBytes:    s.WriteBytes,
+				CgroupMemory:  s.CgroupMemory,
+				CgroupCPUTime: int64(s.CgroupCPUTime),
+				CgroupPids:    s.CgroupPids,
+			})
+		}
+		stats = append(stats, ps)
+	}
+
+	// Respond
+	header := responseHeader{
+		Seq:   seq,
+		Error: errToString(err),
+	}
+	resp := statsResponse{
+		Processes: stats,
+	}
+	return client.Send(&header, &resp)
+}
+
+func (a *AgentIPC) handleLogs(client *IPCClient, seq uint64) error {
+	var req LogsQuery
+	if err := client.dec.Decode(&req); err != nil {
+		return fmt.Errorf("decode failed: %v", err)
+	}
+
+	entries, err := a.queryLogs(&req)
+
+	// Respond
+	header := responseHeader{
+		Seq:   seq,
+		Error: errToString(err),
+	}
+	resp := logsResponse{
+		Entries: entries,
+	}
+	return client.Send(&header, &resp)
+}
+
+func (a *AgentIPC) queryLogs(req *LogsQuery) ([]LogEntry, error) {
+	q := &journal.Query{
+		Process: req.Name,
+		Stream:  req.Stream,
+		Limit:   req.Limit,
+	}
+	if req.Since > 0 {
+		q.Since = time.Unix(0, req.Since)
+	}
+	if req.Until > 0 {
+		q.Until = time.Unix(0, req.Until)
+	}
+	if req.Grep != "" {
+		grep, err := regexp.Compile(req.Grep)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid grep pattern: %s", err)
+		}
+		q.Grep = grep
+	}
+
+	records, err := a.agent.Logs(q)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]LogEntry, 0, len(records))
+	for _, r := range records {
+		entries = append(entries, LogEntry{
+			Time:   r.Time.UnixNano(),
+			Stream: r.Stream.String(),
+			Pid:    r.Pid,
+			Line:   string(r.Line),
+		})
+	}
+	return entries, nil
+}
+
+func (a *AgentIPC) handleUpgrade(client *IPCClient, seq uint64) error {
+	// Respond before the upgrade closes the connection
+	header := responseHeader{
+		Seq:   seq,
+		Error: errToString(nil),
+	}
+	err := client.Send(&header, nil)
+
+	a.agent.RequestUpgrade()
+	return err
+}
+
+func (a *AgentIPC) handleReload(client *IPCClient, seq uint64) error {
+	changes, err := a.agent.RequestReload()
+
+	// Respond
+	header := responseHeader{
+		Seq:   seq,
+		Error: errToString(err),
+	}
+	resp := reloadResponse{
+		Changes: changes,
 	}
 	return client.Send(&header, &resp)
 }
@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/appio/watchdog/process"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// registryFile is the name of the registry within the data directory
+const registryFile = "registry.json"
+
+// registryEntry records a registered process and its desired state so it
+// can be restored when the agent restarts
+type registryEntry struct {
+	Name       string `json:"name"`
+	ConfigPath string `json:"config_path"`
+
+	// Enabled and Started are the desired state of the process. A started
+	// process is started again when the agent restarts.
+	Enabled bool `json:"enabled"`
+	Started bool `json:"started"`
+
+	// Restarts carries the restart counter of the process across restarts
+	// of the agent
+	Restarts int `json:"restarts"`
+
+	// Identity is the running instance of the process, which is adopted if
+	// it is still running when the agent restarts
+	Identity *process.Identity `json:"identity,omitempty"`
+}
+
+// registry persists the registered processes in the data directory
+type registry struct {
+	sync.Mutex
+	path    string
+	entries map[string]*registryEntry
+}
+
+// loadRegistry reads the registry from the data directory. A missing
+// registry is empty.
+func loadRegistry(dataDir string) (*registry, error) {
+	r := &registry{
+		path:    filepath.Join(dataDir, registryFile),
+		entries: make(map[string]*registryEntry),
+	}
+
+	data, err := ioutil.ReadFile(r.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r, nil
+		}
+		return nil, fmt.Errorf("error reading registry: %s", err)
+	}
+
+	var entries []*registryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("error decoding registry '%s': %s", r.path, err)
+	}
+	for _, e := range entries {
+		r.entries[e.Name] = e
+	}
+
+	return r, nil
+}
+
+// Entries returns a copy of every entry sorted by name
+func (r *registry) Entries() []registryEntry {
+	r.Lock()
+	defer r.Unlock()
+
+	entries := make([]registryEntry, 0, len(r.entries))
+	for _, e := range r.entries {
+		entries = append(entries, *e)
+	}
+	sort.Sort(byName(entries))
+	return entries
+}
+
+// Update changes the entry for the named process, creating it if needed, and
+// saves the registry
+func (r *registry) Update(name string, update func(*registryEntry)) error {
+	r.Lock()
+	defer r.Unlock()
+
+	e, ok := r.entries[name]
+	if !ok {
+		e = &registryEntry{Name: name}
+		r.entries[name] = e
+	}
+	update(e)
+
+	return r.save()
+}
+
+// Remove deletes the entry for the named process and saves the registry
+func (r *registry) Remove(name string) error {
+	r.Lock()
+	defer r.Unlock()
+
+	delete(r.entries, name)
+	return r.save()
+}
+
+// save writes the registry to a temporary file and renames it into place,
+// so a crash never leaves a partially written registry
+func (r *registry) save() error {
+	entries := make([]registryEntry, 0, len(r.entries))
+	for _, e := range r.entries {
+		entries = append(entries, *e)
+	}
+	sort.Sort(byName(entries))
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := r.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing registry: %s", err)
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		return fmt.Errorf("error writing registry: %s", err)
+	}
+	return nil
+}
+
+type byName []registryEntry
+
+func (b byName) Len() int {
+	return len(b)
+}
+
+func (b byName) Less(i, j int) bool {
+	return b[i].Name < b[j].Name
+}
+
+func (b byName) Swap(i, j int) {
+	b[i], b[j] = b[j], b[i]
+}
@@ -0,0 +1,361 @@
+package agent
+
+import (
+	"github.com/appio/watchdog/journal"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRegistry_roundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := loadRegistry(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(r.Entries()) != 0 {
+		t.Fatalf("expected empty registry")
+	}
+
+	r.Update("web", func(e *registryEntry) {
+		e.ConfigPath = "/etc/watchdog/web.json"
+		e.Enabled = true
+		e.Started = true
+		e.Restarts = 3
+	})
+	r.Update("worker", func(e *registryEntry) {
+		e.ConfigPath = "/etc/watchdog/worker.json"
+	})
+	r.Update("old", func(e *registryEntry) {})
+	r.Remove("old")
+
+	r, err = loadRegistry(dir)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	entries := r.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %#v", entries)
+	}
+	expected := registryEntry{
+		Name:       "web",
+		ConfigPath: "/etc/watchdog/web.json",
+		Enabled:    true,
+		Started:    true,
+		Restarts:   3,
+	}
+	if entries[0] != expected {
+		t.Errorf("expected %#v, got %#v", expected, entries[0])
+	}
+	if entries[1].Name != "worker" || entries[1].Started {
+		t.Errorf("unexpected entry: %#v", entries[1])
+	}
+}
+
+func TestAgent_restoresRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "sleeper.json")
+	ioutil.WriteFile(configPath, []byte(`{
+		"name": "sleeper",
+		"program": "/bin/sleep",
+		"program_arguments": ["5"]
+	}`), 0644)
+
+	idlePath := filepath.Join(dir, "idle.json")
+	ioutil.WriteFile(idlePath, []byte(`{
+		"name": "idle",
+		"program": "/bin/sleep",
+		"program_arguments": ["5"]
+	}`), 0644)
+
+	config := &Config{DataDir: dir}
+
+	agent := NewAgent(config, ioutil.Discard)
+	if err := agent.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := agent.RegisterProcess(configPath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := agent.RegisterProcess(idlePath); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := agent.StartProcess("sleeper"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	agent.Shutdown()
+
+	// A new agent with the same data directory picks up where it left off
+	agent = NewAgent(config, ioutil.Discard)
+	if err := agent.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer agent.Shutdown()
+
+	procs, err := agent.Processes()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(procs) != 2 {
+		t.Fatalf("expected 2 restored processes, got %d", len(procs))
+	}
+	if procs[0].Name != "idle" || procs[0].PID() != 0 {
+		t.Errorf("expected idle to be registered but not started")
+	}
+	if procs[1].Name != "sleeper" || procs[1].PID() == 0 {
+		t.Errorf("expected sleeper to be started")
+	}
+
+	// Stopped processes stay stopped
+	if _, err := agent.StopProcess("sleeper"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, e := range agent.registry.Entries() {
+		if e.Started {
+			t.Errorf("expected %s to be recorded as stopped", e.Name)
+		}
+	}
+}
+
+func TestAgent_adoptsRunningProcess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "sleeper.json")
+	ioutil.WriteFile(configPath, []byte(`{
+		"name": "sleeper",
+		"program": "/bin/sleep",
+		"program_arguments": ["5"]
+	}`), 0644)
+
+	config := &Config{DataDir: dir}
+
+	// The first agent dies without stopping its children
+	crashed := NewAgent(config, ioutil.Discard)
+	if err := crashed.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	crashed.RegisterProcess(configPath)
+	proc, err := crashed.StartProcess("sleeper")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	pid := proc.PID()
+
+	agent := NewAgent(config, ioutil.Discard)
+	if err := agent.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer agent.Shutdown()
+
+	procs, _ := agent.Processes("sleeper")
+	if procs[0].PID() != pid {
+		t.Fatalf("expected pid %d to be adopted, have %d", pid, procs[0].PID())
+	}
+}
+
+func TestAgent_handover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "app.json")
+	ioutil.WriteFile(configPath, []byte(`{
+		"name": "app",
+		"program": "/bin/sh",
+		"program_arguments": ["-c", "echo before; sleep 0.3; echo after"]
+	}`), 0644)
+
+	config := &Config{DataDir: dir}
+
+	old := NewAgent(config, ioutil.Discard)
+	if err := old.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	old.RegisterProcess(configPath)
+	proc, err := old.StartProcess("app")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	pid := proc.PID()
+	time.Sleep(100 * time.Millisecond)
+
+	state := old.handover()
+	if len(state.Processes) != 1 || state.Processes[0].Handover == nil {
+		t.Fatalf("expected app to be handed over: %#v", state)
+	}
+
+	agent := NewAgent(config, ioutil.Discard)
+	agent.inherited = state
+	if err := agent.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer agent.Shutdown()
+
+	procs, _ := agent.Processes("app")
+	if procs[0].PID() != pid {
+		t.Fatalf("expected pid %d to be resumed, have %d", pid, procs[0].PID())
+	}
+	procs[0].Wait()
+
+	// Output from before and after the handover ends up in the same journal
+	deadline := time.Now().Add(time.Second)
+	for {
+		records, _ := agent.Logs(&journal.Query{Process: "app"})
+		if len(records) == 2 && string(records[0].Line) == "before" && string(records[1].Line) == "after" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected output from both agents, got %d records", len(records))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The old agent's pipes must stay open until the new agent is done
+	runtime.KeepAlive(old)
+}
+
+func TestAgent_upgradeFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "app.json")
+	ioutil.WriteFile(configPath, []byte(`{
+		"name": "app",
+		"program": "/bin/sh",
+		"program_arguments": ["-c", "echo before; sleep 0.3; echo after; sleep 5"]
+	}`), 0644)
+
+	agent := NewAgent(&Config{DataDir: dir}, ioutil.Discard)
+	if err := agent.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer agent.Shutdown()
+
+	agent.RegisterProcess(configPath)
+	proc, err := agent.StartProcess("app")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	pid := proc.PID()
+	time.Sleep(100 * time.Millisecond)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer listener.Close()
+	listenerFile, err := listener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer listenerFile.Close()
+
+	if err := agent.Upgrade(filepath.Join(dir, "missing"), listenerFile); err == nil {
+		t.Fatal("expected upgrade to fail")
+	}
+
+	// Processes started from now on don't inherit the RPC listener
+	flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, listenerFile.Fd(), syscall.F_GETFD, 0)
+	if errno != 0 || flags&syscall.FD_CLOEXEC == 0 {
+		t.Fatal("expected RPC listener to be closed on exec again")
+	}
+
+	// The agent carries on supervising the same process
+	select {
+	case <-agent.ShutdownCh():
+		t.Fatal("expected agent to carry on")
+	default:
+	}
+	if proc.PID() != pid || !proc.IsRunning() {
+		t.Fatalf("expected pid %d to still be supervised, have %d", pid, proc.PID())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		records, _ := agent.Logs(&journal.Query{Process: "app"})
+		if len(records) == 2 && string(records[0].Line) == "before" && string(records[1].Line) == "after" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected output from after the upgrade, got %d records", len(records))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAgent_leaveRunning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "sleeper.json")
+	ioutil.WriteFile(configPath, []byte(`{
+		"name": "sleeper",
+		"program": "/bin/sleep",
+		"program_arguments": ["5"]
+	}`), 0644)
+
+	config := &Config{DataDir: dir, LeaveRunning: true}
+
+	agent := NewAgent(config, ioutil.Discard)
+	if err := agent.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	agent.RegisterProcess(configPath)
+	proc, err := agent.StartProcess("sleeper")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	pid := proc.PID()
+	defer syscall.Kill(pid, syscall.SIGKILL)
+
+	if agent.ShutdownTimeout() != 0 {
+		t.Errorf("expected no shutdown timeout, got %s", agent.ShutdownTimeout())
+	}
+	if err := agent.Shutdown(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if proc.PID() != pid || syscall.Kill(pid, 0) != nil {
+		t.Fatalf("expected process %d to be left running", pid)
+	}
+
+	// The next agent adopts it
+	agent = NewAgent(config, ioutil.Discard)
+	if err := agent.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer agent.Shutdown()
+
+	procs, _ := agent.Processes("sleeper")
+	if procs[0].PID() != pid {
+		t.Fatalf("expected pid %d to be adopted, have %d", pid, procs[0].PID())
+	}
+}
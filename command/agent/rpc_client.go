@@ -153,6 +153,90 @@ func (r *RPCClient) Start(names ...string) ([]int, error) {
 	return resp.Pids, err
 }
 
+// Stop stops the named processes. It returns the names of the processes
+// which were stopped.
+func (c *RPCClient) Stop(names ...string) ([]string, error) {
+	header := requestHeader{
+		Command: stopCommand,
+		Seq:     c.getSeq(),
+	}
+	req := stopRequest{
+		Names: names,
+	}
+	var resp stopResponse
+
+	err := c.genericRPC(&header, &req, &resp)
+	return resp.Names, err
+}
+
+// Status returns the status of the named processes, or all processes if no
+// names are given
+func (c *RPCClient) Status(names ...string) ([]ProcessStatus, error) {
+	header := requestHeader{
+		Command: statusCommand,
+		Seq:     c.getSeq(),
+	}
+	req := statusRequest{
+		Names: names,
+	}
+	var resp statusResponse
+
+	err := c.genericRPC(&header, &req, &resp)
+	return resp.Processes, err
+}
+
+// Stats returns the recent resource usage of the named processes, or all
+// processes if no names are given, with up to history samples of each
+func (c *RPCClient) Stats(history int, names ...string) ([]ProcessStats, error) {
+	header := requestHeader{
+		Command: statsCommand,
+		Seq:     c.getSeq(),
+	}
+	req := statsRequest{
+		Names:   names,
+		History: history,
+	}
+	var resp statsResponse
+
+	err := c.genericRPC(&header, &req, &resp)
+	return resp.Processes, err
+}
+
+// Logs returns output from the journal of a process matching the query
+func (c *RPCClient) Logs(query *LogsQuery) ([]LogEntry, error) {
+	header := requestHeader{
+		Command: logsCommand,
+		Seq:     c.getSeq(),
+	}
+	var resp logsResponse
+
+	err := c.genericRPC(&header, query, &resp)
+	return resp.Entries, err
+}
+
+// Upgrade asks the agent to replace itself with its binary on disk without
+// stopping its processes. The connection is closed by the upgrade.
+func (c *RPCClient) Upgrade() error {
+	header := requestHeader{
+		Command: upgradeCommand,
+		Seq:     c.getSeq(),
+	}
+	return c.genericRPC(&header, nil, nil)
+}
+
+// Reload asks the agent to reload its configuration files, returning the
+// changes it made
+func (c *RPCClient) Reload() ([]string, error) {
+	header := requestHeader{
+		Command: reloadCommand,
+		Seq:     c.getSeq(),
+	}
+	var resp reloadResponse
+
+	err := c.genericRPC(&header, nil, &resp)
+	return resp.Changes, err
+}
+
 // handshake is used to perform the initial handshake on connect
 func (c *RPCClient) handshake() error {
 	header := requestHeader{
@@ -1,12 +1,16 @@
 package agent
 
 import (
+	"github.com/appio/watchdog/process"
 	"github.com/hashicorp/serf/testutil"
 	"io"
 	"io/ioutil"
 	"net"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func testRPCClient(t *testing.T) (*RPCClient, *Agent, *AgentIPC) {
@@ -70,3 +74,247 @@ func TestClientRegister(t *testing.T) {
 		t.Errorf("Expected process name to be %s, got %v", "my_app", resp[0])
 	}
 }
+
+func TestClientStatus(t *testing.T) {
+	tf, err := ioutil.TempFile("", "my_app.json")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	tf.Write([]byte(basicConfig))
+	tf.Close()
+	defer os.Remove(tf.Name())
+
+	client, agent, ipc := testRPCClient(t)
+	defer ipc.Shutdown()
+	defer client.Close()
+	defer agent.Shutdown()
+
+	if _, err := client.Register([]string{tf.Name()}, true, true); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	statuses, err := client.Status()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(statuses) != 1 {
+		t.Fatalf("expected 1 process, got %d", len(statuses))
+	}
+	if statuses[0].Name != "my_app" || statuses[0].State != "stopped" {
+		t.Errorf("unexpected status: %#v", statuses[0])
+	}
+
+	if _, err := client.Status("missing"); err == nil {
+		t.Error("expected error for unknown process")
+	}
+}
+
+func TestClientStatus_limits(t *testing.T) {
+	tf, err := ioutil.TempFile("", "my_app.json")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	tf.Write([]byte(`{
+  "name": "my_app",
+  "program": "/usr/local/bin/node",
+  "limits": {"nofile": "1024:4096", "core": 0},
+  "nice": 10,
+  "cpu_affinity": [0, 1, 2]
+}`))
+	tf.Close()
+	defer os.Remove(tf.Name())
+
+	client, agent, ipc := testRPCClient(t)
+	defer ipc.Shutdown()
+	defer client.Close()
+	defer agent.Shutdown()
+
+	if _, err := client.Register([]string{tf.Name()}, true, true); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	statuses, err := client.Status("my_app")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []ProcessLimit{
+		{Resource: "core", Soft: "0", Hard: "0"},
+		{Resource: "nofile", Soft: "1024", Hard: "4096"},
+	}
+	if len(statuses) != 1 || !reflect.DeepEqual(statuses[0].Limits, expected) {
+		t.Fatalf("unexpected status: %#v", statuses)
+	}
+	if s := statuses[0]; s.Nice != "10" || s.CPUAffinity != "0-2" || s.IOPriority != "" || s.OOMScoreAdjust != "" {
+		t.Fatalf("unexpected scheduling: %#v", s)
+	}
+}
+
+func TestClientStats(t *testing.T) {
+	tf, err := ioutil.TempFile("", "my_app.json")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	tf.Write([]byte(`{"name": "sleeper", "program": "/bin/sleep", "program_arguments": ["5"]}`))
+	tf.Close()
+	defer os.Remove(tf.Name())
+
+	client, agent, ipc := testRPCClient(t)
+	defer ipc.Shutdown()
+	defer client.Close()
+	defer agent.Shutdown()
+
+	if _, err := client.Register([]string{tf.Name()}, false, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	proc, err := agent.StartProcess("sleeper")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	// A process which has only just exec'd may not have any memory resident
+	for i := 0; i < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+		proc.Sample()
+	}
+
+	stats, err := client.Stats(2, "sleeper")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(stats) != 1 || stats[0].Pid != proc.PID() || len(stats[0].Samples) != 2 {
+		t.Fatalf("unexpected stats: %#v", stats)
+	}
+	latest := stats[0].Samples[0]
+	if latest.Pid != proc.PID() || latest.RSS == 0 || latest.Time < stats[0].Samples[1].Time {
+		t.Errorf("unexpected latest sample: %#v", latest)
+	}
+}
+
+func TestClientLogs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	client, agent, ipc := testRPCClient(t)
+	defer ipc.Shutdown()
+	defer client.Close()
+	defer agent.Shutdown()
+
+	if _, err := client.Logs(&LogsQuery{Name: "my_app"}); err == nil {
+		t.Fatal("expected error without a data directory")
+	}
+
+	agent.config = &Config{DataDir: dir}
+	if err := agent.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	now := time.Now()
+	for i, line := range []string{"starting", "ERROR failed", "listening"} {
+		agent.journal.Append(&process.Record{
+			Process: "my_app",
+			Pid:     42,
+			Stream:  process.Stdout,
+			Time:    now.Add(time.Duration(i-3) * time.Minute),
+			Line:    []byte(line),
+		})
+	}
+
+	entries, err := client.Logs(&LogsQuery{Name: "my_app", Grep: "ERROR"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(entries) != 1 || entries[0].Line != "ERROR failed" || entries[0].Stream != "stdout" {
+		t.Fatalf("unexpected entries: %#v", entries)
+	}
+
+	entries, _ = client.Logs(&LogsQuery{Name: "my_app", Since: now.Add(-90 * time.Second).UnixNano()})
+	if len(entries) != 1 || entries[0].Line != "listening" {
+		t.Fatalf("unexpected entries: %#v", entries)
+	}
+
+	if _, err := client.Logs(&LogsQuery{Name: "my_app", Grep: "("}); err == nil {
+		t.Fatal("expected error for invalid grep pattern")
+	}
+}
+
+func TestClientStop(t *testing.T) {
+	tf, err := ioutil.TempFile("", "sleeper.json")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	tf.Write([]byte(`{"name": "sleeper", "program": "/bin/sleep", "program_arguments": ["5"]}`))
+	tf.Close()
+	defer os.Remove(tf.Name())
+
+	client, agent, ipc := testRPCClient(t)
+	defer ipc.Shutdown()
+	defer client.Close()
+	defer agent.Shutdown()
+
+	if _, err := client.Register([]string{tf.Name()}, true, true); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := client.Start("sleeper"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	names, err := client.Stop("sleeper", "missing")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(names) != 1 || names[0] != "sleeper" {
+		t.Fatalf("unexpected stopped processes: %v", names)
+	}
+}
+
+func TestClientStart(t *testing.T) {
+	configs := map[string]string{
+		"sleeper": `{"name": "sleeper", "program": "/bin/sleep", "program_arguments": ["5"]}`,
+		"slow": `{"name": "slow", "program": "/bin/sleep", "program_arguments": ["5"],
+			"readiness": {"min_uptime": "1s", "interval": "10ms"}}`,
+		"broken": `{"name": "broken", "program": "/bin/sleep", "program_arguments": ["5"],
+			"timeout": "1s", "readiness": {"exec": ["/bin/false"], "interval": "10ms"}}`,
+	}
+	var paths []string
+	for name, config := range configs {
+		tf, err := ioutil.TempFile("", name+".json")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		tf.Write([]byte(config))
+		tf.Close()
+		defer os.Remove(tf.Name())
+		paths = append(paths, tf.Name())
+	}
+
+	client, agent, ipc := testRPCClient(t)
+	defer ipc.Shutdown()
+	defer client.Close()
+	defer agent.Shutdown()
+
+	if _, err := client.Register(paths, false, false); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The slow and broken processes are waited for at once
+	start := time.Now()
+	pids, err := client.Start("sleeper", "slow", "broken")
+	if elapsed := time.Since(start); elapsed > 1900*time.Millisecond {
+		t.Errorf("processes not started concurrently: took %s", elapsed)
+	}
+
+	if err == nil || !strings.Contains(err.Error(), "process broken not ready") {
+		t.Fatalf("expected readiness error, got: %v", err)
+	}
+	if strings.Contains(err.Error(), "slow") || strings.Contains(err.Error(), "sleeper") {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(pids) != 2 || pids[0] != agent.dog.FindByName("sleeper").PID() || pids[1] != agent.dog.FindByName("slow").PID() {
+		t.Fatalf("unexpected pids: %v", pids)
+	}
+}
@@ -0,0 +1,255 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/appio/watchdog/process"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// An upgrade replaces the running agent with a new binary in place. The agent
+// stops reading process output, leaving it in the pipes, and writes its state
+// to a file. It then execs the new binary, which keeps the agent's pid and
+// file descriptors, so the processes remain its children. The new agent reads
+// the state, takes over the RPC listener and the output pipes and carries on
+// supervising.
+
+// upgradeStateEnv names the file an agent passes its state to its
+// replacement in
+const upgradeStateEnv = "WATCHDOG_UPGRADE_STATE"
+
+// upgradeState is the state passed to the agent replacing this one
+type upgradeState struct {
+	// Listener is the file descriptor of the RPC listener
+	Listener uintptr `json:"listener_fd"`
+
+	Processes []upgradeProcess `json:"processes"`
+}
+
+// upgradeProcess is a running process passed to the new agent
+type upgradeProcess struct {
+	Name       string `json:"name"`
+	ConfigPath string `json:"config_path"`
+	Restarts   int    `json:"restarts"`
+
+	// Handover is set for processes whose output was being captured
+	Handover *process.Handover `json:"handover,omitempty"`
+
+	// Identity is set for adopted processes, which are adopted again
+	Identity *process.Identity `json:"identity,omitempty"`
+}
+
+// UpgradeExecutable returns the binary the agent will be replaced with by an
+// upgrade, checking it is there to be run
+func (a *Agent) UpgradeExecutable() (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("unable to find executable: %s", err)
+	}
+
+	fi, err := os.Stat(executable)
+	if err != nil {
+		return "", fmt.Errorf("unable to find executable: %s", err)
+	}
+	if !fi.Mode().IsRegular() || fi.Mode()&0111 == 0 {
+		return "", fmt.Errorf("%s is not executable", executable)
+	}
+	return executable, nil
+}
+
+// Upgrade replaces the agent with executable, without stopping processes,
+// passing it the RPC listener. It only returns if the upgrade fails, by which
+// time the processes have been taken back and the agent carries on, apart
+// from listening for clients.
+func (a *Agent) Upgrade(executable string, listener *os.File) error {
+	a.logger.Printf("[INFO] agent: Upgrading to %s...", executable)
+
+	state := a.handover()
+	state.Listener = listener.Fd()
+
+	err := a.execUpgrade(executable, state)
+	a.takeBack(state)
+	return err
+}
+
+// execUpgrade writes the state for the new agent and execs it, only
+// returning if that fails
+func (a *Agent) execUpgrade(executable string, state *upgradeState) error {
+	dir := a.config.DataDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	statePath := filepath.Join(dir, fmt.Sprintf("upgrade-%d.json", os.Getpid()))
+
+	data, err := json.Marshal(state)
+	if err == nil {
+		err = ioutil.WriteFile(statePath, data, 0600)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write upgrade state: %s", err)
+	}
+
+	// The output pipes are already left open across exec
+	if err := inheritable(state.Listener); err != nil {
+		os.Remove(statePath)
+		return fmt.Errorf("unable to pass RPC listener: %s", err)
+	}
+
+	env := append(os.Environ(), fmt.Sprintf("%s=%s", upgradeStateEnv, statePath))
+	err = syscall.Exec(executable, os.Args, env)
+
+	os.Remove(statePath)
+	return fmt.Errorf("unable to exec %s: %s", executable, err)
+}
+
+// handover stops capturing output from every running process and delivers
+// what was already captured, returning the state for the new agent
+func (a *Agent) handover() *upgradeState {
+	// Nothing is registered or started once the processes are detached
+	a.stopBackground()
+	a.dog.StopSampling()
+
+	state := new(upgradeState)
+	procs := a.dog.Processes()
+
+	for _, proc := range procs {
+		if proc.PID() == 0 {
+			continue
+		}
+
+		p := upgradeProcess{
+			Name:       proc.Name,
+			ConfigPath: proc.ConfigPath,
+		}
+
+		if h, err := proc.Detach(); err == nil {
+			p.Handover = h
+		} else if id, err := process.Identify(proc.PID()); err == nil {
+			p.Identity = id
+		} else {
+			a.logger.Printf("[ERR] agent: Unable to hand over process %s: %s", proc.Name, err)
+			continue
+		}
+
+		state.Processes = append(state.Processes, p)
+	}
+
+	// Deliver the output read so far, then record the final state
+	a.dog.Detach()
+	for _, proc := range procs {
+		a.updateRegistry(proc, nil)
+	}
+	for i := range state.Processes {
+		if proc := a.dog.FindByName(state.Processes[i].Name); proc != nil {
+			state.Processes[i].Restarts = proc.History().Restarts
+		}
+	}
+
+	if a.journal != nil {
+		a.journal.Close()
+	}
+
+	return state
+}
+
+// takeBack undoes handover when the new agent couldn't be exec'd, resuming
+// each process from its own handover so none is left detached
+func (a *Agent) takeBack(state *upgradeState) {
+	syscall.CloseOnExec(int(state.Listener))
+
+	if a.journal != nil {
+		if err := a.openJournal(); err != nil {
+			a.logger.Printf("[ERR] agent: Unable to reopen journal: %s", err)
+			a.journal = nil
+			a.dog.SetJournal(nil)
+		}
+	}
+	a.dog.Reattach()
+
+	for _, p := range state.Processes {
+		// Adopted processes were never detached
+		if p.Handover == nil {
+			continue
+		}
+
+		proc := a.dog.FindByName(p.Name)
+		if proc == nil {
+			continue
+		}
+		if err := proc.Resume(p.Handover); err != nil {
+			a.logger.Printf("[ERR] agent: Unable to resume process %s: %s", p.Name, err)
+		}
+	}
+
+	if err := a.dog.Subreap(); err != nil {
+		a.logger.Printf("[INFO] agent: Orphaned processes won't be reaped: %s", err)
+	}
+	a.dog.SampleStats()
+	a.restartBackground()
+
+	a.logger.Printf("[INFO] agent: Upgrade abandoned, resumed supervising processes")
+}
+
+// loadUpgradeState reads the state passed by the agent this one replaced, if
+// any. The state file is removed so it can't be used twice.
+func loadUpgradeState() (*upgradeState, error) {
+	path := os.Getenv(upgradeStateEnv)
+	if path == "" {
+		return nil, nil
+	}
+	os.Unsetenv(upgradeStateEnv)
+	defer os.Remove(path)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read upgrade state: %s", err)
+	}
+
+	var state upgradeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("unable to decode upgrade state: %s", err)
+	}
+
+	// Processes started before the listener is taken over mustn't inherit it
+	syscall.CloseOnExec(int(state.Listener))
+	return &state, nil
+}
+
+// resumeProcesses registers the processes handed over by the previous agent
+// and resumes supervising them
+func (a *Agent) resumeProcesses() {
+	for _, p := range a.inherited.Processes {
+		proc, err := a.RegisterProcess(p.ConfigPath)
+		if err != nil {
+			a.logger.Printf("[ERR] agent: Unable to resume process %s: %s", p.Name, err)
+			continue
+		}
+		proc.SetRestarts(p.Restarts)
+
+		if p.Handover != nil {
+			err = proc.Resume(p.Handover)
+		} else {
+			err = proc.Adopt(p.Identity)
+		}
+		if err != nil {
+			a.logger.Printf("[ERR] agent: Unable to resume process %s: %s", p.Name, err)
+			continue
+		}
+
+		a.logger.Printf("[INFO] agent: Resumed process: %s=%d", proc.Name, proc.PID())
+	}
+	a.inherited = nil
+}
+
+// inheritable clears the close-on-exec flag of a file descriptor so it
+// survives exec
+func inheritable(fd uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_SETFD, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
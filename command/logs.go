@@ -0,0 +1,114 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"github.com/appio/watchdog/command/agent"
+	"github.com/mitchellh/cli"
+	"strings"
+	"time"
+)
+
+// LogsCommand queries the journal of a process's output
+type LogsCommand struct {
+	Ui cli.Ui
+}
+
+func (c *LogsCommand) Help() string {
+	helpText := `
+Usage: watchdog logs [options] process_name
+
+  Shows output of a process from the agent's journal, including output from
+  before the agent last restarted. The agent must be started with a data
+  directory for output to be journaled.
+
+Options:
+
+  -since=1h                 Only show output since this long ago, or since a
+                            time such as 2006-01-02T15:04:05Z.
+  -until=10m                Only show output until this long ago, or until a
+                            time.
+  -stream=stderr            Only show output from stdout or stderr.
+  -grep=ERROR               Only show lines matching this regular expression.
+  -n=100                    Only show the most recent lines.
+  -rpc-addr=127.0.0.1:6673  RPC address of the Watchdog agent.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *LogsCommand) Run(args []string) int {
+	var since, until string
+	query := new(agent.LogsQuery)
+
+	cmdFlags := flag.NewFlagSet("logs", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Ui.Output(c.Help()) }
+	cmdFlags.StringVar(&since, "since", "", "since")
+	cmdFlags.StringVar(&until, "until", "", "until")
+	cmdFlags.StringVar(&query.Stream, "stream", "", "stream")
+	cmdFlags.StringVar(&query.Grep, "grep", "", "grep")
+	cmdFlags.IntVar(&query.Limit, "n", 0, "lines")
+	rpcAddr := RPCAddrFlag(cmdFlags)
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(cmdFlags.Args()) != 1 {
+		c.Ui.Error("A single process name must be given")
+		c.Ui.Error("")
+		c.Ui.Error(c.Help())
+		return 1
+	}
+	query.Name = cmdFlags.Arg(0)
+
+	now := time.Now()
+	var err error
+	if query.Since, err = parseLogTime(since, now); err != nil {
+		c.Ui.Error(fmt.Sprintf("Invalid -since: %s", err))
+		return 1
+	}
+	if query.Until, err = parseLogTime(until, now); err != nil {
+		c.Ui.Error(fmt.Sprintf("Invalid -until: %s", err))
+		return 1
+	}
+
+	client, err := RPCClient(*rpcAddr)
+	if err != nil {
+		c.Ui.Error("Error connecting to Watchdog agent")
+		return 1
+	}
+	defer client.Close()
+
+	entries, err := client.Logs(query)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error retrieving logs: %s", err))
+		return 1
+	}
+
+	for _, e := range entries {
+		c.Ui.Output(fmt.Sprintf("%s %s[%d]: %s",
+			time.Unix(0, e.Time).Format(time.RFC3339), e.Stream, e.Pid, e.Line))
+	}
+	return 0
+}
+
+func (c *LogsCommand) Synopsis() string {
+	return "Show journaled output of a process"
+}
+
+// parseLogTime parses either a duration before now or an RFC3339 time into
+// Unix nanoseconds. An empty string is zero.
+func parseLogTime(s string, now time.Time) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d).UnixNano(), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("expected a duration such as 1h or a time such as 2006-01-02T15:04:05Z")
+	}
+	return t.UnixNano(), nil
+}
@@ -0,0 +1,37 @@
+package command
+
+import (
+	"github.com/mitchellh/cli"
+	"testing"
+	"time"
+)
+
+func TestLogsCommand_implements(t *testing.T) {
+	var _ cli.Command = &LogsCommand{}
+}
+
+func TestParseLogTime(t *testing.T) {
+	now := time.Date(2014, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := map[string]time.Time{
+		"1h":                   now.Add(-time.Hour),
+		"90s":                  now.Add(-90 * time.Second),
+		"2014-05-31T08:00:00Z": time.Date(2014, 5, 31, 8, 0, 0, 0, time.UTC),
+	}
+	for input, expected := range cases {
+		actual, err := parseLogTime(input, now)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if actual != expected.UnixNano() {
+			t.Errorf("parseLogTime(%s) = %s, expected %s", input, time.Unix(0, actual).UTC(), expected)
+		}
+	}
+
+	if actual, _ := parseLogTime("", now); actual != 0 {
+		t.Errorf("expected empty time to be zero, got %d", actual)
+	}
+	if _, err := parseLogTime("yesterday", now); err == nil {
+		t.Error("expected error for invalid time")
+	}
+}
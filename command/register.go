@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"github.com/mitchellh/cli"
+	"path/filepath"
 	"strings"
 )
 
@@ -60,6 +61,13 @@ func (c *RegisterCommand) Run(args []string) int {
 		return 1
 	}
 
+	// The agent may be running in another directory
+	for i, path := range configPaths {
+		if abs, err := filepath.Abs(path); err == nil {
+			configPaths[i] = abs
+		}
+	}
+
 	client, err := RPCClient(*rpcAddr)
 	if err != nil {
 		c.Ui.Error("Error connecting to Watchdog agent")
@@ -0,0 +1,65 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mitchellh/cli"
+	"strings"
+)
+
+// ReloadCommand asks the agent to reload its configuration
+type ReloadCommand struct {
+	Ui cli.Ui
+}
+
+func (c *ReloadCommand) Help() string {
+	helpText := `
+Usage: watchdog reload [options]
+
+  Reloads the agent's configuration files, the same as sending it SIGHUP.
+  Changes to the log level and process config directories are applied
+  without restarting processes. Other changes need the agent restarted.
+
+Options:
+
+  -rpc-addr=127.0.0.1:6673  RPC address of the Watchdog agent.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *ReloadCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("reload", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Ui.Output(c.Help()) }
+	rpcAddr := RPCAddrFlag(cmdFlags)
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	client, err := RPCClient(*rpcAddr)
+	if err != nil {
+		c.Ui.Error("Error connecting to Watchdog agent")
+		return 1
+	}
+	defer client.Close()
+
+	changes, err := client.Reload()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error reloading agent: %s", err))
+		return 1
+	}
+
+	if len(changes) == 0 {
+		c.Ui.Output("Configuration reloaded, nothing changed")
+		return 0
+	}
+
+	c.Ui.Output("Configuration reloaded:")
+	for _, change := range changes {
+		c.Ui.Output(fmt.Sprintf("  %s", change))
+	}
+	return 0
+}
+
+func (c *ReloadCommand) Synopsis() string {
+	return "Reload the agent configuration"
+}
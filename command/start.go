@@ -50,6 +50,9 @@ func (c *StartCommand) Run(args []string) int {
 
 	pids, err := client.Start(processNames...)
 	if err != nil {
+		if len(pids) > 0 {
+			c.Ui.Output(fmt.Sprintf("Started processes with PIDs: %v", pids))
+		}
 		c.Ui.Error(fmt.Sprintf("Error starting processes: %s", err))
 		return 1
 	}
@@ -0,0 +1,136 @@
+package command
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/mitchellh/cli"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// StatusCommand shows the status of registered processes
+type StatusCommand struct {
+	Ui cli.Ui
+}
+
+func (c *StatusCommand) Help() string {
+	helpText := `
+Usage: watchdog status [options] [process_name ...]
+
+  Shows the status of registered processes. If no process names are given,
+  every registered process is shown.
+
+Options:
+
+  -rpc-addr=127.0.0.1:6673  RPC address of the Watchdog agent.
+
+  -verbose                  Also show the resource limits and scheduling of
+                            each process, and the status and main pid sent
+                            by processes with notify.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *StatusCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("status", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Ui.Output(c.Help()) }
+	rpcAddr := RPCAddrFlag(cmdFlags)
+	verbose := cmdFlags.Bool("verbose", false, "verbose")
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	client, err := RPCClient(*rpcAddr)
+	if err != nil {
+		c.Ui.Error("Error connecting to Watchdog agent")
+		return 1
+	}
+	defer client.Close()
+
+	statuses, err := client.Status(cmdFlags.Args()...)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error retrieving status: %s", err))
+		return 1
+	}
+
+	var out bytes.Buffer
+	w := tabwriter.NewWriter(&out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATE\tPID\tUPTIME\tRESTARTS\tLAST EXIT\tDROPPED")
+	for _, s := range statuses {
+		uptime := "-"
+		if s.StartedAt > 0 {
+			uptime = time.Since(time.Unix(s.StartedAt, 0)).Truncate(time.Second).String()
+		}
+
+		pid := "-"
+		if s.Pid > 0 {
+			pid = fmt.Sprintf("%d", s.Pid)
+		}
+
+		// Older agents only report the exit status
+		lastExit := s.LastExitReason
+		if lastExit == "" {
+			lastExit = fmt.Sprintf("%d", s.LastExitStatus)
+		}
+
+		// Adopted processes have no output captured, so aren't fully
+		// supervised
+		state := s.State
+		if s.Adopted {
+			state += " (adopted)"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%d\n",
+			s.Name, state, pid, uptime, s.Restarts, lastExit, s.DroppedLines)
+	}
+	w.Flush()
+
+	if *verbose {
+		fmt.Fprintln(&out)
+		w = tabwriter.NewWriter(&out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tLIMIT\tSOFT\tHARD")
+		for _, s := range statuses {
+			for _, l := range s.Limits {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Name, l.Resource, l.Soft, l.Hard)
+			}
+		}
+		w.Flush()
+
+		fmt.Fprintln(&out)
+		w = tabwriter.NewWriter(&out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tNICE\tIO\tCPUS\tOOM SCORE ADJ")
+		for _, s := range statuses {
+			sched := []string{s.Nice, s.IOPriority, s.CPUAffinity, s.OOMScoreAdjust}
+			if strings.Join(sched, "") == "" {
+				continue
+			}
+			for i := range sched {
+				if sched[i] == "" {
+					sched[i] = "-"
+				}
+			}
+			fmt.Fprintf(w, "%s\t%s\n", s.Name, strings.Join(sched, "\t"))
+		}
+		w.Flush()
+
+		fmt.Fprintln(&out)
+		w = tabwriter.NewWriter(&out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tMAIN PID\tSTATUS")
+		for _, s := range statuses {
+			if s.StatusText == "" && s.MainPid == s.Pid {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\n", s.Name, s.MainPid, s.StatusText)
+		}
+		w.Flush()
+	}
+
+	c.Ui.Output(strings.TrimRight(out.String(), "\n"))
+	return 0
+}
+
+func (c *StatusCommand) Synopsis() string {
+	return "Show the status of registered processes"
+}
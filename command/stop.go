@@ -0,0 +1,65 @@
+package command
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mitchellh/cli"
+	"strings"
+)
+
+// StopCommand stops a running process
+type StopCommand struct {
+	Ui cli.Ui
+}
+
+func (c *StopCommand) Help() string {
+	helpText := `
+Usage: watchdog stop [options] <process_name> ...
+
+  Stops a process. It won't be started again when the agent restarts.
+
+Options:
+
+  -rpc-addr=127.0.0.1:6673  RPC address of the Watchdog agent.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *StopCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("stop", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Ui.Output(c.Help()) }
+	rpcAddr := RPCAddrFlag(cmdFlags)
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	processNames := cmdFlags.Args()
+	if len(processNames) == 0 {
+		c.Ui.Error("At least one process name must be supplied.")
+		c.Ui.Error("")
+		c.Ui.Error(c.Help())
+		return 1
+	}
+
+	client, err := RPCClient(*rpcAddr)
+	if err != nil {
+		c.Ui.Error("Error connecting to Watchdog agent")
+		return 1
+	}
+	defer client.Close()
+
+	names, err := client.Stop(processNames...)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error stopping processes: %s", err))
+		return 1
+	}
+
+	c.Ui.Output(fmt.Sprintf(
+		"Successfully stopped processes: %v", names))
+
+	return 0
+}
+
+func (c *StopCommand) Synopsis() string {
+	return "Stop a process"
+}
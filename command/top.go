@@ -0,0 +1,201 @@
+package command
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/appio/watchdog/command/agent"
+	"github.com/mitchellh/cli"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// clearScreen moves the cursor home and clears the terminal
+const clearScreen = "\033[H\033[2J"
+
+// TopCommand shows the resource usage of running processes, refreshing it
+// until interrupted
+type TopCommand struct {
+	Ui         cli.Ui
+	ShutdownCh <-chan struct{}
+}
+
+func (c *TopCommand) Help() string {
+	helpText := `
+Usage: watchdog top [options] [process_name ...]
+
+  Shows the CPU, memory, open files, threads and I/O of running processes,
+  as last sampled by the agent, refreshing until interrupted. If no process
+  names are given, every registered process is shown.
+
+Options:
+
+  -sort=cpu                 Sort by cpu, mem, fds, threads, io or name.
+  -interval=2s              How often to refresh.
+  -n=0                      Exit after this many refreshes, or never if 0.
+  -rpc-addr=127.0.0.1:6673  RPC address of the Watchdog agent.
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (c *TopCommand) Run(args []string) int {
+	var sortBy string
+	var interval time.Duration
+	var iterations int
+
+	cmdFlags := flag.NewFlagSet("top", flag.ContinueOnError)
+	cmdFlags.Usage = func() { c.Ui.Output(c.Help()) }
+	cmdFlags.StringVar(&sortBy, "sort", "cpu", "sort")
+	cmdFlags.DurationVar(&interval, "interval", 2*time.Second, "interval")
+	cmdFlags.IntVar(&iterations, "n", 0, "iterations")
+	rpcAddr := RPCAddrFlag(cmdFlags)
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if _, ok := topSortKeys[sortBy]; !ok {
+		c.Ui.Error(fmt.Sprintf("Invalid -sort: %s", sortBy))
+		return 1
+	}
+	if interval <= 0 {
+		c.Ui.Error("Invalid -interval: must be positive")
+		return 1
+	}
+
+	client, err := RPCClient(*rpcAddr)
+	if err != nil {
+		c.Ui.Error("Error connecting to Watchdog agent")
+		return 1
+	}
+	defer client.Close()
+
+	for i := 0; iterations == 0 || i < iterations; i++ {
+		if i > 0 {
+			select {
+			case <-time.After(interval):
+			case <-c.ShutdownCh:
+				return 0
+			}
+		}
+
+		stats, err := client.Stats(1, cmdFlags.Args()...)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error retrieving stats: %s", err))
+			return 1
+		}
+
+		rows := topRows(stats)
+		sortTopRows(rows, sortBy)
+
+		out := renderTop(rows)
+		if iterations != 1 {
+			out = clearScreen + out
+		}
+		c.Ui.Output(out)
+	}
+	return 0
+}
+
+func (c *TopCommand) Synopsis() string {
+	return "Show the resource usage of running processes"
+}
+
+// topRow is a process shown by top, with its latest sample if it is running
+type topRow struct {
+	Name   string
+	Pid    int
+	Sample *agent.StatsSample
+}
+
+// topRows pairs each process with its latest sample, if it is of the running
+// instance
+func topRows(stats []agent.ProcessStats) []topRow {
+	rows := make([]topRow, 0, len(stats))
+	for _, ps := range stats {
+		row := topRow{Name: ps.Name, Pid: ps.Pid}
+		if ps.Pid != 0 && len(ps.Samples) > 0 && ps.Samples[0].Pid == ps.Pid {
+			row.Sample = &ps.Samples[0]
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// topSortKeys are the values compared to sort by each key, largest first
+var topSortKeys = map[string]func(s *agent.StatsSample) float64{
+	"cpu":     func(s *agent.StatsSample) float64 { return s.CPUPercent },
+	"mem":     func(s *agent.StatsSample) float64 { return float64(s.RSS) },
+	"fds":     func(s *agent.StatsSample) float64 { return float64(s.FDs) },
+	"threads": func(s *agent.StatsSample) float64 { return float64(s.Threads) },
+	"io":      func(s *agent.StatsSample) float64 { return float64(s.ReadBytes + s.WriteBytes) },
+	"name":    nil,
+}
+
+// sortTopRows sorts rows by a key, largest first, followed by processes
+// without a sample. Ties and "name" are sorted by name.
+func sortTopRows(rows []topRow, key string) {
+	value := topSortKeys[key]
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if value != nil {
+			if (a.Sample == nil) != (b.Sample == nil) {
+				return a.Sample != nil
+			}
+			if a.Sample != nil {
+				if va, vb := value(a.Sample), value(b.Sample); va != vb {
+					return va > vb
+				}
+			}
+		}
+		return a.Name < b.Name
+	})
+}
+
+func renderTop(rows []topRow) string {
+	var out bytes.Buffer
+	w := tabwriter.NewWriter(&out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPID\tCPU%\tRSS\tFDS\tTHREADS\tREAD\tWRITE\tCGROUP MEM\tCGROUP PIDS")
+	for _, row := range rows {
+		s := row.Sample
+		if s == nil {
+			pid := "-"
+			if row.Pid > 0 {
+				pid = fmt.Sprintf("%d", row.Pid)
+			}
+			fmt.Fprintf(w, "%s\t%s\t-\t-\t-\t-\t-\t-\t-\t-\n", row.Name, pid)
+			continue
+		}
+
+		cgroupMem, cgroupPids := "-", "-"
+		if s.CgroupPids > 0 {
+			cgroupMem = formatBytes(s.CgroupMemory)
+			cgroupPids = fmt.Sprintf("%d", s.CgroupPids)
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%.1f\t%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			row.Name, s.Pid, s.CPUPercent, formatBytes(s.RSS), s.FDs, s.Threads,
+			formatBytes(s.ReadBytes), formatBytes(s.WriteBytes), cgroupMem, cgroupPids)
+	}
+	w.Flush()
+
+	return strings.TrimRight(out.String(), "\n")
+}
+
+// formatBytes formats a size in bytes with a binary unit
+func formatBytes(n uint64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	value := float64(n)
+	i := -1
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%c", value, units[i])
+}
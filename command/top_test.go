@@ -0,0 +1,68 @@
+package command
+
+import (
+	"github.com/appio/watchdog/command/agent"
+	"github.com/mitchellh/cli"
+	"strings"
+	"testing"
+)
+
+func TestTopCommand_implements(t *testing.T) {
+	var _ cli.Command = &TopCommand{}
+}
+
+func TestTopRows(t *testing.T) {
+	stats := []agent.ProcessStats{
+		{Name: "web", Pid: 10, Samples: []agent.StatsSample{{Pid: 10, CPUPercent: 5, RSS: 300 << 20}}},
+		{Name: "api", Pid: 11, Samples: []agent.StatsSample{{Pid: 11, CPUPercent: 50, RSS: 100 << 20}}},
+		{Name: "cron", Pid: 0, Samples: []agent.StatsSample{{Pid: 9, CPUPercent: 90}}},
+		{Name: "db", Pid: 12, Samples: []agent.StatsSample{{Pid: 8, CPUPercent: 90}}},
+	}
+
+	names := func(rows []topRow) string {
+		var names []string
+		for _, row := range rows {
+			names = append(names, row.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	// Samples of previous instances aren't shown
+	rows := topRows(stats)
+	if rows[2].Sample != nil || rows[3].Sample != nil {
+		t.Fatalf("expected no samples for stopped or restarted processes: %#v", rows)
+	}
+
+	sortTopRows(rows, "cpu")
+	if names(rows) != "api,web,cron,db" {
+		t.Errorf("unexpected cpu order: %s", names(rows))
+	}
+	sortTopRows(rows, "mem")
+	if names(rows) != "web,api,cron,db" {
+		t.Errorf("unexpected mem order: %s", names(rows))
+	}
+	sortTopRows(rows, "name")
+	if names(rows) != "api,cron,db,web" {
+		t.Errorf("unexpected name order: %s", names(rows))
+	}
+
+	out := renderTop(rows)
+	if !strings.Contains(out, "300.0M") || !strings.Contains(out, "50.0") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	cases := map[uint64]string{
+		0:         "0B",
+		1023:      "1023B",
+		1536:      "1.5K",
+		5 << 30:   "5.0G",
+		1<<64 - 1: "16.0E",
+	}
+	for n, expected := range cases {
+		if actual := formatBytes(n); actual != expected {
+			t.Errorf("formatBytes(%d) = %s, expected %s", n, actual, expected)
+		}
+	}
+}
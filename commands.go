@@ -22,18 +22,49 @@ func init() {
 			}, nil
 		},
 
+		"logs": func() (cli.Command, error) {
+			return &command.LogsCommand{
+				Ui: ui,
+			}, nil
+		},
+
 		"register": func() (cli.Command, error) {
 			return &command.RegisterCommand{
 				Ui: ui,
 			}, nil
 		},
 
+		"reload": func() (cli.Command, error) {
+			return &command.ReloadCommand{
+				Ui: ui,
+			}, nil
+		},
+
 		"start": func() (cli.Command, error) {
 			return &command.StartCommand{
 				Ui: ui,
 			}, nil
 		},
 
+		"status": func() (cli.Command, error) {
+			return &command.StatusCommand{
+				Ui: ui,
+			}, nil
+		},
+
+		"stop": func() (cli.Command, error) {
+			return &command.StopCommand{
+				Ui: ui,
+			}, nil
+		},
+
+		"top": func() (cli.Command, error) {
+			return &command.TopCommand{
+				Ui:         ui,
+				ShutdownCh: makeShutdownCh(),
+			}, nil
+		},
+
 		"version": func() (cli.Command, error) {
 			return &command.VersionCommand{
 				Revision:          GitCommit,
@@ -0,0 +1,538 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/appio/watchdog/process"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The journal keeps the output of every process on disk so it can be
+// queried after it has scrolled past, including across agent restarts.
+//
+// Each process has a directory of append-only segment files, named by the
+// time of their first record. Every line of a segment is one JSON encoded
+// record. When a segment grows past the segment size a new one is started,
+// and the oldest segments are deleted once the process exceeds its retention
+// limits. Retention is also applied periodically, so the output of a process
+// which has gone quiet still expires.
+
+const (
+	// DefaultSegmentSize is the size at which a new segment is started
+	DefaultSegmentSize = 8 << 20
+
+	// DefaultMaxSize is the most output retained per process
+	DefaultMaxSize = 256 << 20
+
+	// DefaultMaxAge is how long output is retained
+	DefaultMaxAge = 7 * 24 * time.Hour
+
+	// maxEntrySize bounds a single encoded record when reading segments
+	maxEntrySize = 16 << 20
+
+	segmentExt = ".log"
+)
+
+// retainInterval is how often retention is applied to every journal
+var retainInterval = time.Minute
+
+// Config controls where the journal is stored and how much is retained
+type Config struct {
+	// Dir is the directory the journal is stored in
+	Dir string
+
+	// SegmentSize is the size at which a new segment is started
+	SegmentSize int64
+
+	// MaxSize is the most output retained per process. Whole segments are
+	// deleted, oldest first, to stay under it.
+	MaxSize int64
+
+	// MaxAge is how long output is retained. Segments are deleted once
+	// every record in them is older than this.
+	MaxAge time.Duration
+}
+
+// Query selects records from a process's journal
+type Query struct {
+	// Process is the name of the process to read
+	Process string
+
+	// Since and Until bound the time of records returned, if not zero
+	Since time.Time
+	Until time.Time
+
+	// Stream only returns records from this stream, if not empty
+	Stream string
+
+	// Grep only returns records whose line matches, if not nil
+	Grep *regexp.Regexp
+
+	// Limit returns only the most recent matching records, if positive
+	Limit int
+}
+
+// entry is the on disk representation of a record
+type entry struct {
+	Time   int64  `json:"t"`
+	Stream string `json:"s"`
+	Pid    int    `json:"p"`
+	Seq    uint64 `json:"q"`
+	Line   string `json:"l"`
+}
+
+// segment is a single file of a process's journal
+type segment struct {
+	path  string
+	start time.Time
+	size  int64
+
+	// last is the time of the last record written to the segment
+	last time.Time
+}
+
+// Journal stores process output on disk
+type Journal struct {
+	sync.Mutex
+	config    Config
+	processes map[string]*processJournal
+	closed    bool
+	stop      chan struct{}
+}
+
+// processJournal is the journal of a single process
+type processJournal struct {
+	sync.Mutex
+	dir      string
+	config   *Config
+	segments []*segment
+	active   *os.File
+}
+
+// Open opens the journal in the configured directory, creating it if needed
+func Open(config Config) (*Journal, error) {
+	if config.Dir == "" {
+		return nil, fmt.Errorf("journal directory is required")
+	}
+	if config.SegmentSize <= 0 {
+		config.SegmentSize = DefaultSegmentSize
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultMaxSize
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = DefaultMaxAge
+	}
+
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating journal directory: %s", err)
+	}
+
+	j := &Journal{
+		config:    config,
+		processes: make(map[string]*processJournal),
+		stop:      make(chan struct{}),
+	}
+	go j.retainLoop()
+	return j, nil
+}
+
+// Append writes a record to the journal of its process
+func (j *Journal) Append(r *process.Record) error {
+	pj, err := j.process(r.Process, true)
+	if err != nil {
+		return err
+	}
+	return pj.append(r)
+}
+
+// Query returns the records of a process matching the query, oldest first.
+// A process with no journal has no records.
+func (j *Journal) Query(q *Query) ([]*process.Record, error) {
+	pj, err := j.process(q.Process, false)
+	if err != nil || pj == nil {
+		return nil, err
+	}
+	return pj.query(q)
+}
+
+// Close closes every open segment. Records can no longer be appended.
+func (j *Journal) Close() error {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.closed {
+		return nil
+	}
+	j.closed = true
+	close(j.stop)
+	for _, pj := range j.processes {
+		pj.close()
+	}
+	return nil
+}
+
+// process returns the journal for the named process, loading its existing
+// segments the first time it is used. Unless create is set, it returns nil
+// if the process has no journal yet.
+func (j *Journal) process(name string, create bool) (*processJournal, error) {
+	j.Lock()
+	defer j.Unlock()
+
+	if j.closed {
+		return nil, fmt.Errorf("journal is closed")
+	}
+	if name == "" {
+		return nil, fmt.Errorf("process name is required")
+	}
+
+	if pj, ok := j.processes[name]; ok {
+		return pj, nil
+	}
+
+	pj := &processJournal{
+		dir:    filepath.Join(j.config.Dir, url.PathEscape(name)),
+		config: &j.config,
+	}
+	if !create {
+		if _, err := os.Stat(pj.dir); os.IsNotExist(err) {
+			return nil, nil
+		}
+	}
+	if err := pj.load(); err != nil {
+		return nil, err
+	}
+	j.processes[name] = pj
+	return pj, nil
+}
+
+// retainLoop applies retention to every journal each retainInterval until
+// the journal is closed
+func (j *Journal) retainLoop() {
+	ticker := time.NewTicker(retainInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			j.retain(time.Now())
+		case <-j.stop:
+			return
+		}
+	}
+}
+
+// retain applies retention to the journal of every process on disk,
+// including those which haven't been written to since the agent started
+func (j *Journal) retain(now time.Time) {
+	infos, err := ioutil.ReadDir(j.config.Dir)
+	if err != nil {
+		return
+	}
+
+	for _, fi := range infos {
+		if !fi.IsDir() {
+			continue
+		}
+		name, err := url.PathUnescape(fi.Name())
+		if err != nil {
+			continue
+		}
+
+		pj, err := j.process(name, false)
+		if err != nil || pj == nil {
+			continue
+		}
+		pj.Lock()
+		pj.retain(now)
+		pj.expire(now)
+		pj.Unlock()
+	}
+}
+
+// load reads the existing segments of the journal and applies retention
+func (pj *processJournal) load() error {
+	infos, err := ioutil.ReadDir(pj.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("error reading journal: %s", err)
+	}
+
+	for _, fi := range infos {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+
+		nanos, err := strconv.ParseInt(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		pj.segments = append(pj.segments, &segment{
+			path:  filepath.Join(pj.dir, name),
+			start: time.Unix(0, nanos),
+			size:  fi.Size(),
+			last:  fi.ModTime(),
+		})
+	}
+	sort.Sort(byStart(pj.segments))
+
+	now := time.Now()
+	pj.retain(now)
+	pj.expire(now)
+	return nil
+}
+
+func (pj *processJournal) append(r *process.Record) error {
+	data, err := json.Marshal(&entry{
+		Time:   r.Time.UnixNano(),
+		Stream: r.Stream.String(),
+		Pid:    r.Pid,
+		Seq:    r.Seq,
+		Line:   string(r.Line),
+	})
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	pj.Lock()
+	defer pj.Unlock()
+
+	var last *segment
+	if len(pj.segments) > 0 {
+		last = pj.segments[len(pj.segments)-1]
+	}
+
+	if last == nil || (last.size > 0 && last.size+int64(len(data)) > pj.config.SegmentSize) {
+		if err := pj.rotate(r.Time); err != nil {
+			return err
+		}
+		last = pj.segments[len(pj.segments)-1]
+	} else if pj.active == nil {
+		if err := pj.reopen(last); err != nil {
+			return err
+		}
+	}
+
+	// Each record is written whole so readers never see half of one, unless
+	// the agent dies mid-write
+	n, err := pj.active.Write(data)
+	last.size += int64(n)
+	if r.Time.After(last.last) {
+		last.last = r.Time
+	}
+	return err
+}
+
+// reopen opens the newest segment for appending after a restart. If the
+// agent died part way through writing a record, the torn record is ended so
+// it doesn't swallow the next one.
+func (pj *processJournal) reopen(last *segment) error {
+	f, err := os.OpenFile(last.path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening journal segment: %s", err)
+	}
+
+	if last.size > 0 {
+		b := make([]byte, 1)
+		if _, err := f.ReadAt(b, last.size-1); err == nil && b[0] != '\n' {
+			n, _ := f.Write([]byte{'\n'})
+			last.size += int64(n)
+		}
+	}
+
+	pj.active = f
+	return nil
+}
+
+// rotate starts a new segment for records from start onwards
+func (pj *processJournal) rotate(start time.Time) error {
+	if err := os.MkdirAll(pj.dir, 0755); err != nil {
+		return fmt.Errorf("error creating journal: %s", err)
+	}
+
+	if pj.active != nil {
+		pj.active.Close()
+		pj.active = nil
+	}
+
+	// Segments must sort after the one before, even if the clock went back
+	if n := len(pj.segments); n > 0 && !start.After(pj.segments[n-1].start) {
+		start = pj.segments[n-1].start.Add(time.Nanosecond)
+	}
+
+	path := filepath.Join(pj.dir, fmt.Sprintf("%020d%s", start.UnixNano(), segmentExt))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("error creating journal segment: %s", err)
+	}
+
+	pj.active = f
+	pj.segments = append(pj.segments, &segment{path: path, start: start, last: start})
+	pj.retain(time.Now())
+	return nil
+}
+
+// retain deletes the oldest segments until the journal is within its size
+// and age limits. The newest segment is always kept.
+func (pj *processJournal) retain(now time.Time) {
+	var total int64
+	for _, s := range pj.segments {
+		total += s.size
+	}
+
+	cutoff := now.Add(-pj.config.MaxAge)
+	for len(pj.segments) > 1 {
+		oldest, next := pj.segments[0], pj.segments[1]
+		if total <= pj.config.MaxSize && !next.start.Before(cutoff) {
+			break
+		}
+
+		os.Remove(oldest.path)
+		total -= oldest.size
+		pj.segments = pj.segments[1:]
+	}
+}
+
+// expire deletes the journal once the last record in its newest segment is
+// older than the age limit, which retain doesn't as it is used while
+// appending
+func (pj *processJournal) expire(now time.Time) {
+	if len(pj.segments) != 1 || !pj.segments[0].last.Before(now.Add(-pj.config.MaxAge)) {
+		return
+	}
+
+	if pj.active != nil {
+		pj.active.Close()
+		pj.active = nil
+	}
+	os.Remove(pj.segments[0].path)
+	pj.segments = nil
+	os.Remove(pj.dir)
+}
+
+func (pj *processJournal) query(q *Query) ([]*process.Record, error) {
+	// Take a copy of the segments so appends can continue while reading
+	pj.Lock()
+	segments := make([]segment, len(pj.segments))
+	for i, s := range pj.segments {
+		segments[i] = *s
+	}
+	pj.Unlock()
+
+	var records []*process.Record
+	for i, s := range segments {
+		if !q.Until.IsZero() && s.start.After(q.Until) {
+			break
+		}
+		if !q.Since.IsZero() && i+1 < len(segments) && segments[i+1].start.Before(q.Since) {
+			continue
+		}
+
+		var err error
+		if records, err = readSegment(s.path, q, records); err != nil {
+			return nil, err
+		}
+	}
+
+	if q.Limit > 0 && len(records) > q.Limit {
+		records = records[len(records)-q.Limit:]
+	}
+	return records, nil
+}
+
+// readSegment appends the records of a segment matching the query to records
+func readSegment(path string, q *Query, records []*process.Record) ([]*process.Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		// Retention may have removed it since the segments were listed
+		if os.IsNotExist(err) {
+			return records, nil
+		}
+		return records, fmt.Errorf("error reading journal segment: %s", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxEntrySize)
+	for scanner.Scan() {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// A torn write from a crash, skip it
+			continue
+		}
+
+		t := time.Unix(0, e.Time)
+		if !q.Since.IsZero() && t.Before(q.Since) {
+			continue
+		}
+		if !q.Until.IsZero() && t.After(q.Until) {
+			continue
+		}
+		if q.Stream != "" && e.Stream != q.Stream {
+			continue
+		}
+		if q.Grep != nil && !q.Grep.MatchString(e.Line) {
+			continue
+		}
+
+		stream, _ := process.ParseStream(e.Stream)
+		records = append(records, &process.Record{
+			Process: q.Process,
+			Pid:     e.Pid,
+			Stream:  stream,
+			Time:    t,
+			Seq:     e.Seq,
+			Line:    []byte(e.Line),
+		})
+
+		// Only the most recent records are kept, so don't hold on to more
+		// than twice the limit
+		if q.Limit > 0 && len(records) >= 2*q.Limit {
+			records = append(records[:0], records[len(records)-q.Limit:]...)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return records, fmt.Errorf("error reading journal segment: %s", err)
+	}
+	return records, nil
+}
+
+func (pj *processJournal) close() {
+	pj.Lock()
+	defer pj.Unlock()
+
+	if pj.active != nil {
+		pj.active.Close()
+		pj.active = nil
+	}
+}
+
+type byStart []*segment
+
+func (s byStart) Len() int {
+	return len(s)
+}
+
+func (s byStart) Less(i, j int) bool {
+	return s[i].start.Before(s[j].start)
+}
+
+func (s byStart) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
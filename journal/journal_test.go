@@ -0,0 +1,237 @@
+package journal
+
+import (
+	"github.com/appio/watchdog/process"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func testJournal(t *testing.T, config Config) *Journal {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	config.Dir = dir
+
+	j, err := Open(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return j
+}
+
+func testRecord(t time.Time, stream process.Stream, line string) *process.Record {
+	return &process.Record{
+		Process: "my_app",
+		Pid:     42,
+		Stream:  stream,
+		Time:    t,
+		Line:    []byte(line),
+	}
+}
+
+func lines(records []*process.Record) []string {
+	var out []string
+	for _, r := range records {
+		out = append(out, string(r.Line))
+	}
+	return out
+}
+
+func assertLines(t *testing.T, records []*process.Record, expected ...string) {
+	actual := lines(records)
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, actual)
+		}
+	}
+}
+
+func TestJournal_query(t *testing.T) {
+	j := testJournal(t, Config{})
+	defer os.RemoveAll(j.config.Dir)
+	defer j.Close()
+
+	base := time.Now().Add(-time.Hour)
+	j.Append(testRecord(base, process.Stdout, "starting"))
+	j.Append(testRecord(base.Add(time.Minute), process.Stderr, "ERROR connection refused"))
+	j.Append(testRecord(base.Add(2*time.Minute), process.Stdout, "listening"))
+	j.Append(testRecord(base.Add(3*time.Minute), process.Stderr, "ERROR timeout"))
+
+	all, err := j.Query(&Query{Process: "my_app"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertLines(t, all, "starting", "ERROR connection refused", "listening", "ERROR timeout")
+
+	if all[1].Stream != process.Stderr || all[1].Pid != 42 || !all[1].Time.Equal(base.Add(time.Minute)) {
+		t.Errorf("record not preserved: %#v", all[1])
+	}
+
+	errors, _ := j.Query(&Query{Process: "my_app", Grep: regexp.MustCompile("ERROR")})
+	assertLines(t, errors, "ERROR connection refused", "ERROR timeout")
+
+	stdout, _ := j.Query(&Query{Process: "my_app", Stream: "stdout"})
+	assertLines(t, stdout, "starting", "listening")
+
+	window, _ := j.Query(&Query{
+		Process: "my_app",
+		Since:   base.Add(30 * time.Second),
+		Until:   base.Add(2 * time.Minute),
+	})
+	assertLines(t, window, "ERROR connection refused", "listening")
+
+	last, _ := j.Query(&Query{Process: "my_app", Limit: 1})
+	assertLines(t, last, "ERROR timeout")
+}
+
+func TestJournal_reopen(t *testing.T) {
+	j := testJournal(t, Config{})
+	defer os.RemoveAll(j.config.Dir)
+
+	now := time.Now()
+	j.Append(testRecord(now, process.Stdout, "before restart"))
+	j.Close()
+
+	if err := j.Append(testRecord(now, process.Stdout, "closed")); err == nil {
+		t.Fatal("expected error appending to closed journal")
+	}
+
+	j, err := Open(j.config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer j.Close()
+
+	j.Append(testRecord(now.Add(time.Second), process.Stdout, "after restart"))
+
+	records, err := j.Query(&Query{Process: "my_app"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertLines(t, records, "before restart", "after restart")
+}
+
+func TestJournal_retention(t *testing.T) {
+	j := testJournal(t, Config{SegmentSize: 100, MaxSize: 250})
+	defer os.RemoveAll(j.config.Dir)
+	defer j.Close()
+
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		j.Append(testRecord(now.Add(time.Duration(i)*time.Second), process.Stdout, "a line of output"))
+	}
+
+	segments, _ := filepath.Glob(filepath.Join(j.config.Dir, "my_app", "*"+segmentExt))
+	if len(segments) < 2 || len(segments) > 4 {
+		t.Fatalf("expected old segments to be removed, have %d", len(segments))
+	}
+
+	records, _ := j.Query(&Query{Process: "my_app"})
+	if len(records) == 0 || len(records) == 20 {
+		t.Fatalf("expected some records to be retained, got %d", len(records))
+	}
+	if !records[len(records)-1].Time.Equal(now.Add(19 * time.Second)) {
+		t.Errorf("expected newest record to be retained")
+	}
+}
+
+func TestJournal_maxAge(t *testing.T) {
+	j := testJournal(t, Config{SegmentSize: 1, MaxAge: time.Hour})
+	defer os.RemoveAll(j.config.Dir)
+	defer j.Close()
+
+	now := time.Now()
+	j.Append(testRecord(now.Add(-3*time.Hour), process.Stdout, "ancient"))
+	j.Append(testRecord(now.Add(-2*time.Hour), process.Stdout, "older"))
+	j.Append(testRecord(now.Add(-90*time.Minute), process.Stdout, "old"))
+	j.Append(testRecord(now, process.Stdout, "new"))
+
+	// A segment is only removed once the segment after it is also too old,
+	// as until then it may hold newer records
+	records, _ := j.Query(&Query{Process: "my_app"})
+	assertLines(t, records, "old", "new")
+}
+
+func TestJournal_expire(t *testing.T) {
+	j := testJournal(t, Config{MaxAge: time.Hour})
+	defer os.RemoveAll(j.config.Dir)
+	defer j.Close()
+
+	j.Append(testRecord(time.Now().Add(-30*time.Minute), process.Stdout, "last words"))
+
+	// The process goes quiet, so its only segment is never rotated
+	j.retain(time.Now())
+	records, _ := j.Query(&Query{Process: "my_app"})
+	assertLines(t, records, "last words")
+
+	j.retain(time.Now().Add(time.Hour))
+	records, _ = j.Query(&Query{Process: "my_app"})
+	assertLines(t, records)
+	if _, err := os.Stat(filepath.Join(j.config.Dir, "my_app")); !os.IsNotExist(err) {
+		t.Errorf("expected the journal to be removed, got %v", err)
+	}
+
+	// It can still be written to again
+	j.Append(testRecord(time.Now(), process.Stdout, "back"))
+	records, _ = j.Query(&Query{Process: "my_app"})
+	assertLines(t, records, "back")
+}
+
+func TestJournal_tornWrite(t *testing.T) {
+	j := testJournal(t, Config{})
+	defer os.RemoveAll(j.config.Dir)
+	defer j.Close()
+
+	now := time.Now()
+	j.Append(testRecord(now, process.Stdout, "complete"))
+
+	// Simulate the agent dying part way through a write
+	segments, _ := filepath.Glob(filepath.Join(j.config.Dir, "my_app", "*"+segmentExt))
+	f, _ := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte(`{"t":1,"s":"std`))
+	f.Close()
+
+	records, err := j.Query(&Query{Process: "my_app"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	assertLines(t, records, "complete")
+
+	// Records appended after a restart aren't lost to the torn one
+	j.Close()
+	j, err = Open(j.config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	j.Append(testRecord(now, process.Stdout, "after restart"))
+
+	records, _ = j.Query(&Query{Process: "my_app"})
+	assertLines(t, records, "complete", "after restart")
+}
+
+func TestJournal_unknownProcess(t *testing.T) {
+	j := testJournal(t, Config{})
+	defer os.RemoveAll(j.config.Dir)
+	defer j.Close()
+
+	records, err := j.Query(&Query{Process: "missing"})
+	if err != nil || len(records) != 0 {
+		t.Fatalf("expected no records, got %v, %v", records, err)
+	}
+
+	// Reading doesn't create a journal for it
+	if _, err := os.Stat(filepath.Join(j.config.Dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("expected no journal directory, got %v", err)
+	}
+	if len(j.processes) != 0 {
+		t.Errorf("expected no journals, got %d", len(j.processes))
+	}
+}
@@ -0,0 +1,114 @@
+package outlet
+
+import (
+	"fmt"
+	"github.com/appio/watchdog/process"
+	"regexp"
+	"strings"
+)
+
+// Every outlet accepts the following filter keys alongside its own
+// configuration, so each outlet can receive a different subset of output:
+//
+//	min_level  Only send records at or above this level, e.g. "error".
+//	           Records without a parsed level are not sent.
+//	match      Comma separated field=value pairs which must all match, e.g.
+//	           "stream=stderr,service=billing"
+//	include    Only send lines matching this regular expression
+//	exclude    Don't send lines matching this regular expression
+//
+// Levels and fields come from parsing the process output, see the process
+// log_format option.
+
+// Filter decides which records are delivered to an outlet
+type Filter struct {
+	MinLevel string
+	Match    map[string]string
+	Include  *regexp.Regexp
+	Exclude  *regexp.Regexp
+}
+
+// NewFilter builds a Filter from the filter keys of an outlet config. It
+// returns nil if the config has no filter keys.
+func NewFilter(config map[string]string) (*Filter, error) {
+	f := new(Filter)
+	empty := true
+
+	if level := configString(config, "min_level", ""); level != "" {
+		f.MinLevel = process.NormalizeLevel(level)
+		if process.LevelRank(f.MinLevel) < 0 {
+			return nil, fmt.Errorf("invalid min_level '%s', must be one of %v",
+				level, process.Levels)
+		}
+		empty = false
+	}
+
+	if match := configString(config, "match", ""); match != "" {
+		f.Match = make(map[string]string)
+		for _, pair := range strings.Split(match, ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+				return nil, fmt.Errorf("invalid match '%s', expected field=value", pair)
+			}
+			f.Match[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+		empty = false
+	}
+
+	var err error
+	if include := configString(config, "include", ""); include != "" {
+		if f.Include, err = regexp.Compile(include); err != nil {
+			return nil, fmt.Errorf("invalid include: %s", err)
+		}
+		empty = false
+	}
+	if exclude := configString(config, "exclude", ""); exclude != "" {
+		if f.Exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, fmt.Errorf("invalid exclude: %s", err)
+		}
+		empty = false
+	}
+
+	if empty {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// Allow returns whether the record passes the filter
+func (f *Filter) Allow(r *process.Record) bool {
+	if f.MinLevel != "" {
+		rank := process.LevelRank(r.Level)
+		if rank < 0 || rank < process.LevelRank(f.MinLevel) {
+			return false
+		}
+	}
+
+	for field, expected := range f.Match {
+		if actual, ok := r.FieldString(field); !ok || actual != expected {
+			return false
+		}
+	}
+
+	if f.Include != nil && !f.Include.Match(r.Line) {
+		return false
+	}
+	if f.Exclude != nil && f.Exclude.Match(r.Line) {
+		return false
+	}
+
+	return true
+}
+
+// filteredOutlet only passes records allowed by its filter to the outlet
+type filteredOutlet struct {
+	Outlet
+	filter *Filter
+}
+
+func (o *filteredOutlet) Write(r *process.Record) error {
+	if !o.filter.Allow(r) {
+		return nil
+	}
+	return o.Outlet.Write(r)
+}
@@ -0,0 +1,154 @@
+package outlet
+
+import (
+	"github.com/appio/watchdog/process"
+	"testing"
+)
+
+type mockOutlet struct {
+	records []*process.Record
+}
+
+func (m *mockOutlet) Write(r *process.Record) error {
+	m.records = append(m.records, r)
+	return nil
+}
+
+func (m *mockOutlet) Close() error {
+	return nil
+}
+
+func parsedRecord(line string) *process.Record {
+	r := testRecord(line)
+	process.ParseRecord(process.LogFormatAuto, r)
+	return r
+}
+
+func TestNewFilter_empty(t *testing.T) {
+	f, err := NewFilter(map[string]string{"token": "abc"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if f != nil {
+		t.Fatalf("expected no filter, got %#v", f)
+	}
+}
+
+func TestNewFilter_invalid(t *testing.T) {
+	for _, config := range []map[string]string{
+		{"min_level": "loud"},
+		{"match": "nonsense"},
+		{"include": "("},
+		{"exclude": "("},
+	} {
+		if _, err := NewFilter(config); err == nil {
+			t.Errorf("expected error for %v", config)
+		}
+	}
+}
+
+func TestFilter_minLevel(t *testing.T) {
+	f, err := NewFilter(map[string]string{"min_level": "error"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := map[string]bool{
+		`{"level":"info","msg":"hello"}`:    false,
+		`{"level":"error","msg":"failed"}`:  true,
+		`{"level":60,"msg":"bunyan fatal"}`: true,
+		`level=warning msg="slow request"`:  false,
+		`level=crit msg="on fire"`:          true,
+		`no level at all`:                   false,
+	}
+	for line, expected := range cases {
+		if actual := f.Allow(parsedRecord(line)); actual != expected {
+			t.Errorf("Allow(%s) = %v, expected %v", line, actual, expected)
+		}
+	}
+}
+
+func TestFilter_match(t *testing.T) {
+	f, err := NewFilter(map[string]string{"match": "service=billing, stream=stdout"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !f.Allow(parsedRecord(`{"service":"billing","msg":"charged"}`)) {
+		t.Error("expected matching record to be allowed")
+	}
+	if f.Allow(parsedRecord(`{"service":"search","msg":"found"}`)) {
+		t.Error("expected record with other field value to be rejected")
+	}
+
+	r := parsedRecord(`{"service":"billing"}`)
+	r.Stream = process.Stderr
+	if f.Allow(r) {
+		t.Error("expected record on other stream to be rejected")
+	}
+}
+
+func TestFilter_includeExclude(t *testing.T) {
+	f, err := NewFilter(map[string]string{"include": "^GET ", "exclude": "/health"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := map[string]bool{
+		"GET /index.html":  true,
+		"GET /health":      false,
+		"POST /index.html": false,
+	}
+	for line, expected := range cases {
+		if actual := f.Allow(testRecord(line)); actual != expected {
+			t.Errorf("Allow(%s) = %v, expected %v", line, actual, expected)
+		}
+	}
+}
+
+func TestNew_filtered(t *testing.T) {
+	mock := &mockOutlet{}
+	Outlets["mock"] = func(string, map[string]string) (Outlet, error) {
+		return mock, nil
+	}
+	defer delete(Outlets, "mock")
+
+	o, err := New("paging", "my_app", map[string]string{
+		"type":      "mock",
+		"min_level": "error",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	o.Write(parsedRecord(`{"level":"info"}`))
+	o.Write(parsedRecord(`{"level":"error"}`))
+
+	if len(mock.records) != 1 || mock.records[0].Level != "error" {
+		t.Errorf("expected only the error to be written, got %v", mock.records)
+	}
+}
+
+func TestNew_unknownType(t *testing.T) {
+	if _, err := New("carrier_pigeon", "my_app", map[string]string{}); err == nil {
+		t.Error("expected error for unknown outlet type")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate("loggly", "my_app", map[string]string{"token": "abc"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	invalid := []map[string]string{
+		{"token": "abc", "min_level": "loud"},
+		{"token": "abc", "include": "("},
+		{"type": "carrier_pigeon"},
+		{},
+	}
+	for _, config := range invalid {
+		if err := Validate("loggly", "my_app", config); err == nil {
+			t.Errorf("expected error validating %v", config)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package outlet
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// l2met style measurements are embedded in log lines as key=value tokens
+// where the key is prefixed by the measurement type:
+//
+//	count#requests=1 measure#db.latency=20ms sample#queue.depth=4 unique#user=bob
+//
+// An optional source=<name> token overrides the metric source for every
+// measurement on that line.
+
+// MetricType is the kind of l2met measurement found in a log line
+type MetricType int
+
+const (
+	MetricCount MetricType = iota
+	MetricMeasure
+	MetricSample
+	MetricUnique
+)
+
+func (t MetricType) String() string {
+	switch t {
+	case MetricCount:
+		return "count"
+	case MetricMeasure:
+		return "measure"
+	case MetricSample:
+		return "sample"
+	case MetricUnique:
+		return "unique"
+	}
+	return "unknown"
+}
+
+// Measurement is a single metric token parsed from a log line
+type Measurement struct {
+	Type   MetricType
+	Name   string
+	Source string
+	Value  float64
+
+	// Raw is the unparsed value, used to count distinct values of unique#
+	Raw string
+}
+
+// ParseMeasurements extracts every l2met measurement from a log line.
+func ParseMeasurements(line string) []*Measurement {
+	if !strings.Contains(line, "#") {
+		return nil
+	}
+
+	var source string
+	var result []*Measurement
+
+	for _, token := range strings.Fields(line) {
+		// Counters may omit their value, in which case they count as one
+		key, raw := token, ""
+		if eq := strings.IndexByte(token, '='); eq == 0 {
+			continue
+		} else if eq > 0 {
+			key, raw = token[:eq], strings.Trim(token[eq+1:], `"'`)
+		}
+
+		if key == "source" {
+			source = raw
+			continue
+		}
+
+		hash := strings.IndexByte(key, '#')
+		if hash <= 0 || hash == len(key)-1 {
+			continue
+		}
+
+		var kind MetricType
+		switch key[:hash] {
+		case "count":
+			kind = MetricCount
+		case "measure":
+			kind = MetricMeasure
+		case "sample":
+			kind = MetricSample
+		case "unique":
+			kind = MetricUnique
+		default:
+			continue
+		}
+
+		m := &Measurement{Type: kind, Name: key[hash+1:], Raw: raw}
+		if kind != MetricUnique {
+			value, ok := parseMetricValue(raw)
+			if !ok {
+				if kind != MetricCount || raw != "" {
+					continue
+				}
+				value = 1
+			}
+			m.Value = value
+		}
+		result = append(result, m)
+	}
+
+	for _, m := range result {
+		m.Source = source
+	}
+	return result
+}
+
+// parseMetricValue parses the numeric prefix of a value, ignoring any unit
+// suffix such as "ms" or "MB".
+func parseMetricValue(raw string) (float64, bool) {
+	end := 0
+	for end < len(raw) {
+		c := raw[end]
+		if (c >= '0' && c <= '9') || c == '.' || c == '-' || c == '+' || c == 'e' || c == 'E' {
+			// Don't treat the start of a unit like "evt" as an exponent
+			if (c == 'e' || c == 'E') && (end == 0 || end+1 >= len(raw) || !isNumberByte(raw[end+1])) {
+				break
+			}
+			end++
+			continue
+		}
+		break
+	}
+
+	value, err := strconv.ParseFloat(raw[:end], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+	return value, true
+}
+
+func isNumberByte(c byte) bool {
+	return (c >= '0' && c <= '9') || c == '-' || c == '+'
+}
+
+// metricKey identifies an aggregate within a flush interval
+type metricKey struct {
+	Type   MetricType
+	Name   string
+	Source string
+}
+
+// Aggregate is the summary of a metric over a single flush interval
+type Aggregate struct {
+	metricKey
+
+	Count      int
+	Sum        float64
+	Min        float64
+	Max        float64
+	SumSquares float64
+	Last       float64
+
+	uniques map[string]struct{}
+}
+
+// Value returns the single value representation of the aggregate: the total
+// of counters, the last sample, the number of distinct uniques or the mean of
+// measurements.
+func (a *Aggregate) Value() float64 {
+	switch a.Type {
+	case MetricCount:
+		return a.Sum
+	case MetricSample:
+		return a.Last
+	case MetricUnique:
+		return float64(len(a.uniques))
+	}
+	if a.Count == 0 {
+		return 0
+	}
+	return a.Sum / float64(a.Count)
+}
+
+// aggregator collects measurements between flushes
+type aggregator struct {
+	sync.Mutex
+	metrics map[metricKey]*Aggregate
+}
+
+func newAggregator() *aggregator {
+	return &aggregator{metrics: make(map[metricKey]*Aggregate)}
+}
+
+func (a *aggregator) Add(m *Measurement) {
+	a.Lock()
+	defer a.Unlock()
+
+	key := metricKey{m.Type, m.Name, m.Source}
+	agg, ok := a.metrics[key]
+	if !ok {
+		agg = &Aggregate{metricKey: key, Min: m.Value, Max: m.Value}
+		if m.Type == MetricUnique {
+			agg.uniques = make(map[string]struct{})
+		}
+		a.metrics[key] = agg
+	}
+
+	agg.Count++
+	agg.Sum += m.Value
+	agg.SumSquares += m.Value * m.Value
+	agg.Min = math.Min(agg.Min, m.Value)
+	agg.Max = math.Max(agg.Max, m.Value)
+	agg.Last = m.Value
+
+	if agg.uniques != nil {
+		agg.uniques[m.Raw] = struct{}{}
+	}
+}
+
+// Flush returns the aggregates collected since the last flush, sorted by
+// name, and resets the aggregator.
+func (a *aggregator) Flush() []*Aggregate {
+	a.Lock()
+	metrics := a.metrics
+	a.metrics = make(map[metricKey]*Aggregate)
+	a.Unlock()
+
+	result := make([]*Aggregate, 0, len(metrics))
+	for _, agg := range metrics {
+		result = append(result, agg)
+	}
+	sort.Sort(aggregates(result))
+	return result
+}
+
+type aggregates []*Aggregate
+
+func (a aggregates) Len() int {
+	return len(a)
+}
+
+func (a aggregates) Less(i, j int) bool {
+	if a[i].Name != a[j].Name {
+		return a[i].Name < a[j].Name
+	}
+	if a[i].Type != a[j].Type {
+		return a[i].Type < a[j].Type
+	}
+	return a[i].Source < a[j].Source
+}
+
+func (a aggregates) Swap(i, j int) {
+	a[i], a[j] = a[j], a[i]
+}
@@ -0,0 +1,100 @@
+package outlet
+
+import (
+	"testing"
+)
+
+func TestParseMeasurements(t *testing.T) {
+	line := `at=info source=web.1 count#requests measure#db.latency=20.5ms sample#queue=4 unique#user="bob" other=1 measure#bad=abc`
+	ms := ParseMeasurements(line)
+
+	if len(ms) != 4 {
+		t.Fatalf("expected 4 measurements, got %d", len(ms))
+	}
+
+	expected := []struct {
+		kind  MetricType
+		name  string
+		value float64
+	}{
+		{MetricCount, "requests", 1},
+		{MetricMeasure, "db.latency", 20.5},
+		{MetricSample, "queue", 4},
+		{MetricUnique, "user", 0},
+	}
+	for i, e := range expected {
+		m := ms[i]
+		if m.Type != e.kind || m.Name != e.name || m.Value != e.value {
+			t.Errorf("unexpected measurement %d: %#v", i, m)
+		}
+		if m.Source != "web.1" {
+			t.Errorf("expected source web.1, got %s", m.Source)
+		}
+	}
+
+	if ms[3].Raw != "bob" {
+		t.Errorf("expected unique value bob, got %s", ms[3].Raw)
+	}
+}
+
+func TestParseMeasurements_none(t *testing.T) {
+	if ms := ParseMeasurements("GET /index.html 200"); len(ms) != 0 {
+		t.Fatalf("expected no measurements, got %v", ms)
+	}
+}
+
+func TestParseMetricValue(t *testing.T) {
+	cases := map[string]float64{
+		"10":      10,
+		"1.5GB":   1.5,
+		"-3ms":    -3,
+		"2e3":     2000,
+		"5events": 5,
+	}
+	for raw, expected := range cases {
+		value, ok := parseMetricValue(raw)
+		if !ok || value != expected {
+			t.Errorf("parseMetricValue(%q) = %v, %v; expected %v", raw, value, ok, expected)
+		}
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	a := newAggregator()
+	for _, line := range []string{
+		"count#hits=2 measure#latency=10 sample#depth=1 unique#user=a",
+		"count#hits=3 measure#latency=30 sample#depth=7 unique#user=b",
+		"unique#user=a",
+	} {
+		for _, m := range ParseMeasurements(line) {
+			a.Add(m)
+		}
+	}
+
+	aggs := a.Flush()
+	if len(aggs) != 4 {
+		t.Fatalf("expected 4 aggregates, got %d", len(aggs))
+	}
+
+	values := make(map[string]float64)
+	for _, agg := range aggs {
+		values[agg.Name] = agg.Value()
+	}
+
+	if values["hits"] != 5 {
+		t.Errorf("expected hits=5, got %v", values["hits"])
+	}
+	if values["latency"] != 20 {
+		t.Errorf("expected latency=20, got %v", values["latency"])
+	}
+	if values["depth"] != 7 {
+		t.Errorf("expected depth=7, got %v", values["depth"])
+	}
+	if values["user"] != 2 {
+		t.Errorf("expected user=2, got %v", values["user"])
+	}
+
+	if len(a.Flush()) != 0 {
+		t.Error("expected aggregator to be reset after flush")
+	}
+}
@@ -0,0 +1,225 @@
+package outlet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/appio/watchdog/process"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultLibratoURL is the Librato metrics endpoint used when none is
+	// configured
+	DefaultLibratoURL = "https://metrics-api.librato.com/v1/metrics"
+
+	// libratoMaxGauges is the number of gauges sent in a single request
+	libratoMaxGauges = 300
+)
+
+// LibratoOutlet extracts l2met style measurements from process output,
+// aggregates them over each flush interval and submits them to a Librato
+// compatible metrics API. Lines without measurements are ignored.
+//
+// Supported configuration keys:
+//
+//	user            Librato account email (required)
+//	token           Librato API token (required)
+//	url             Metrics endpoint, defaults to DefaultLibratoURL
+//	source          Metric source, defaults to the hostname
+//	prefix          Prefix added to every metric name
+//	flush_interval  Aggregation period, default 60s
+type LibratoOutlet struct {
+	endpoint      string
+	user          string
+	token         string
+	source        string
+	prefix        string
+	flushInterval time.Duration
+
+	processName string
+
+	client  *http.Client
+	metrics *aggregator
+	stop    chan struct{}
+	done    chan struct{}
+
+	closeOnce sync.Once
+}
+
+// NewLibratoOutlet constructs a LibratoOutlet from the process outlet config.
+func NewLibratoOutlet(processName string, config map[string]string) (Outlet, error) {
+	user := configString(config, "user", "")
+	token := configString(config, "token", "")
+	if user == "" || token == "" {
+		return nil, fmt.Errorf("librato: user and token are required")
+	}
+
+	flushInterval, err := configDuration(config, "flush_interval", 60*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("librato: %s", err)
+	}
+	if flushInterval <= 0 {
+		return nil, fmt.Errorf("librato: flush_interval must be positive")
+	}
+
+	prefix := configString(config, "prefix", "")
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+
+	o := &LibratoOutlet{
+		endpoint:      configString(config, "url", DefaultLibratoURL),
+		user:          user,
+		token:         token,
+		source:        configString(config, "source", hostname()),
+		prefix:        prefix,
+		flushInterval: flushInterval,
+		processName:   processName,
+		client:        &http.Client{Timeout: 30 * time.Second},
+		metrics:       newAggregator(),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go o.run()
+
+	return o, nil
+}
+
+// Write extracts any measurements from the line into the current interval.
+func (o *LibratoOutlet) Write(r *process.Record) error {
+	for _, m := range ParseMeasurements(string(r.Line)) {
+		o.metrics.Add(m)
+	}
+	return nil
+}
+
+// Close submits the current interval and stops the outlet
+func (o *LibratoOutlet) Close() error {
+	o.closeOnce.Do(func() {
+		close(o.stop)
+	})
+	<-o.done
+	return nil
+}
+
+func (o *LibratoOutlet) run() {
+	defer close(o.done)
+
+	ticker := time.NewTicker(o.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			o.flush()
+		case <-o.stop:
+			o.flush()
+			return
+		}
+	}
+}
+
+// flush submits the aggregates collected since the last flush
+func (o *LibratoOutlet) flush() {
+	aggs := o.metrics.Flush()
+	if len(aggs) == 0 {
+		return
+	}
+
+	measureTime := time.Now().Unix()
+	for len(aggs) > 0 {
+		n := len(aggs)
+		if n > libratoMaxGauges {
+			n = libratoMaxGauges
+		}
+
+		if err := o.post(measureTime, aggs[:n]); err != nil {
+			log.Printf("[ERR] outlet.librato: Failed to submit %d metrics for %s: %v",
+				n, o.processName, err)
+		}
+		aggs = aggs[n:]
+	}
+}
+
+type libratoGauge struct {
+	Name       string   `json:"name"`
+	Source     string   `json:"source,omitempty"`
+	Value      *float64 `json:"value,omitempty"`
+	Count      int      `json:"count,omitempty"`
+	Sum        *float64 `json:"sum,omitempty"`
+	Min        *float64 `json:"min,omitempty"`
+	Max        *float64 `json:"max,omitempty"`
+	SumSquares *float64 `json:"sum_squares,omitempty"`
+}
+
+type libratoPayload struct {
+	Source      string          `json:"source"`
+	MeasureTime int64           `json:"measure_time"`
+	Gauges      []*libratoGauge `json:"gauges"`
+}
+
+// gauge converts an aggregate into a Librato gauge. Measurements are sent as
+// complex gauges so Librato can derive the mean and spread; everything else
+// is sent as a single value.
+func (o *LibratoOutlet) gauge(agg *Aggregate) *libratoGauge {
+	g := &libratoGauge{
+		Name:   o.prefix + agg.Name,
+		Source: agg.Source,
+	}
+
+	if agg.Type == MetricMeasure {
+		sum, min, max, sumSquares := agg.Sum, agg.Min, agg.Max, agg.SumSquares
+		g.Count = agg.Count
+		g.Sum = &sum
+		g.Min = &min
+		g.Max = &max
+		g.SumSquares = &sumSquares
+		return g
+	}
+
+	value := agg.Value()
+	g.Value = &value
+	return g
+}
+
+// post sends a single batch of gauges to the metrics endpoint
+func (o *LibratoOutlet) post(measureTime int64, aggs []*Aggregate) error {
+	payload := libratoPayload{
+		Source:      o.source,
+		MeasureTime: measureTime,
+	}
+	for _, agg := range aggs {
+		payload.Gauges = append(payload.Gauges, o.gauge(agg))
+	}
+
+	body, err := json.Marshal(&payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", o.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(o.user, o.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package outlet
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLibratoOutlet_implements(t *testing.T) {
+	var _ Outlet = new(LibratoOutlet)
+}
+
+func TestLibratoOutlet_requiresCredentials(t *testing.T) {
+	if _, err := NewLibratoOutlet("my_app", map[string]string{"user": "me@example.com"}); err == nil {
+		t.Fatal("expected error without a token")
+	}
+}
+
+func TestLibratoOutlet_submit(t *testing.T) {
+	payloads := make(chan *libratoPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, token, ok := r.BasicAuth()
+		if !ok || user != "me@example.com" || token != "secret" {
+			t.Errorf("unexpected credentials: %s %s", user, token)
+		}
+
+		var payload libratoPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("err: %s", err)
+		}
+		payloads <- &payload
+	}))
+	defer server.Close()
+
+	o, err := NewLibratoOutlet("my_app", map[string]string{
+		"url":            server.URL,
+		"user":           "me@example.com",
+		"token":          "secret",
+		"source":         "host-1",
+		"prefix":         "my_app",
+		"flush_interval": "1h",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	o.Write(testRecord("count#requests=1 measure#latency=10ms"))
+	o.Write(testRecord("nothing to see here"))
+	o.Write(testRecord("count#requests=1 measure#latency=30ms"))
+	o.Close()
+
+	var payload *libratoPayload
+	select {
+	case payload = <-payloads:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for metrics")
+	}
+
+	if payload.Source != "host-1" {
+		t.Errorf("expected source host-1, got %s", payload.Source)
+	}
+	if len(payload.Gauges) != 2 {
+		t.Fatalf("expected 2 gauges, got %d", len(payload.Gauges))
+	}
+
+	latency, requests := payload.Gauges[0], payload.Gauges[1]
+	if latency.Name != "my_app.latency" || latency.Count != 2 || *latency.Sum != 40 || *latency.Max != 30 {
+		t.Errorf("unexpected latency gauge: %#v", latency)
+	}
+	if requests.Name != "my_app.requests" || *requests.Value != 2 {
+		t.Errorf("unexpected requests gauge: %#v", requests)
+	}
+}
@@ -0,0 +1,256 @@
+package outlet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/appio/watchdog/process"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultLogglyURL is the Loggly bulk endpoint used when none is configured
+	DefaultLogglyURL = "https://logs-01.loggly.com/bulk"
+
+	// logglyMaxBatchBytes keeps each bulk request under Loggly's 5MB limit
+	logglyMaxBatchBytes = 4 * 1024 * 1024
+)
+
+// LogglyOutlet posts newline delimited batches of process output to the
+// Loggly bulk endpoint.
+//
+// Supported configuration keys:
+//
+//	token           Loggly customer token (required)
+//	url             Bulk endpoint, defaults to DefaultLogglyURL
+//	tags            Comma separated tags, defaults to the process name and hostname
+//	batch_size      Maximum number of lines per request, default 500
+//	flush_interval  Maximum time to hold a partial batch, default 5s
+//	queue_size      Number of lines to buffer before dropping, default 10000
+//	gzip            Whether to gzip request bodies, default true
+type LogglyOutlet struct {
+	endpoint      string
+	batchSize     int
+	flushInterval time.Duration
+	gzip          bool
+
+	processName string
+	hostname    string
+
+	client  *http.Client
+	lines   chan []byte
+	done    chan struct{}
+	dropped uint64
+
+	closeOnce sync.Once
+}
+
+// NewLogglyOutlet constructs a LogglyOutlet from the process outlet config.
+func NewLogglyOutlet(processName string, config map[string]string) (Outlet, error) {
+	token := configString(config, "token", "")
+	if token == "" {
+		return nil, fmt.Errorf("loggly: token is required")
+	}
+
+	host := hostname()
+
+	var tags []string
+	for _, tag := range strings.Split(configString(config, "tags", processName+","+host), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, url.PathEscape(tag))
+		}
+	}
+
+	endpoint := strings.TrimRight(configString(config, "url", DefaultLogglyURL), "/")
+	endpoint = fmt.Sprintf("%s/%s/", endpoint, url.PathEscape(token))
+	if len(tags) > 0 {
+		endpoint = fmt.Sprintf("%stag/%s/", endpoint, strings.Join(tags, ","))
+	}
+
+	batchSize, err := configInt(config, "batch_size", 500)
+	if err != nil {
+		return nil, fmt.Errorf("loggly: %s", err)
+	}
+	queueSize, err := configInt(config, "queue_size", 10000)
+	if err != nil {
+		return nil, fmt.Errorf("loggly: %s", err)
+	}
+	flushInterval, err := configDuration(config, "flush_interval", 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("loggly: %s", err)
+	}
+	useGzip, err := configBool(config, "gzip", true)
+	if err != nil {
+		return nil, fmt.Errorf("loggly: %s", err)
+	}
+
+	if batchSize < 1 || queueSize < 1 || flushInterval <= 0 {
+		return nil, fmt.Errorf("loggly: batch_size, queue_size and flush_interval must be positive")
+	}
+
+	o := &LogglyOutlet{
+		endpoint:      endpoint,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		gzip:          useGzip,
+		processName:   processName,
+		hostname:      host,
+		client:        &http.Client{Timeout: 30 * time.Second},
+		lines:         make(chan []byte, queueSize),
+		done:          make(chan struct{}),
+	}
+	go o.run()
+
+	return o, nil
+}
+
+// Endpoint returns the URL batches are posted to
+func (o *LogglyOutlet) Endpoint() string {
+	return o.endpoint
+}
+
+// Dropped returns the number of lines dropped because the queue was full
+func (o *LogglyOutlet) Dropped() uint64 {
+	return atomic.LoadUint64(&o.dropped)
+}
+
+// Write queues a line for delivery. Lines which are not already JSON are
+// wrapped in a JSON object so Loggly can index them.
+func (o *LogglyOutlet) Write(r *process.Record) error {
+	event := o.encode(r)
+
+	select {
+	case o.lines <- event:
+	default:
+		atomic.AddUint64(&o.dropped, 1)
+	}
+	return nil
+}
+
+// Close flushes any queued lines and stops the outlet
+func (o *LogglyOutlet) Close() error {
+	o.closeOnce.Do(func() {
+		close(o.lines)
+	})
+	<-o.done
+	return nil
+}
+
+// encode returns the record as a single line JSON document
+func (o *LogglyOutlet) encode(r *process.Record) []byte {
+	trimmed := bytes.TrimSpace(r.Line)
+	if len(trimmed) > 0 && trimmed[0] == '{' && json.Valid(trimmed) {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, trimmed); err == nil {
+			return buf.Bytes()
+		}
+	}
+
+	event, _ := json.Marshal(map[string]interface{}{
+		"message":   string(r.Line),
+		"process":   o.processName,
+		"pid":       r.Pid,
+		"stream":    r.Stream.String(),
+		"hostname":  o.hostname,
+		"timestamp": r.Time.UTC().Format(time.RFC3339Nano),
+	})
+	return event
+}
+
+func (o *LogglyOutlet) run() {
+	defer close(o.done)
+
+	ticker := time.NewTicker(o.flushInterval)
+	defer ticker.Stop()
+
+	var batch [][]byte
+	var size int
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := o.post(batch); err != nil {
+			log.Printf("[ERR] outlet.loggly: Failed to send %d lines for %s: %v",
+				len(batch), o.processName, err)
+		}
+		batch = nil
+		size = 0
+	}
+
+	for {
+		select {
+		case line, ok := <-o.lines:
+			if !ok {
+				flush()
+				return
+			}
+
+			if size+len(line)+1 > logglyMaxBatchBytes {
+				flush()
+			}
+			batch = append(batch, line)
+			size += len(line) + 1
+
+			if len(batch) >= o.batchSize {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// post sends a batch of lines to the bulk endpoint
+func (o *LogglyOutlet) post(batch [][]byte) error {
+	var body bytes.Buffer
+	var w io.Writer = &body
+
+	var zw *gzip.Writer
+	if o.gzip {
+		zw = gzip.NewWriter(&body)
+		w = zw
+	}
+
+	for _, line := range batch {
+		w.Write(line)
+		w.Write([]byte{'\n'})
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest("POST", o.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	if o.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	return nil
+}
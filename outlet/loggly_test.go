@@ -0,0 +1,148 @@
+package outlet
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type logglyRequest struct {
+	path     string
+	encoding string
+	lines    []string
+}
+
+func testLogglyServer(t *testing.T) (*httptest.Server, chan *logglyRequest) {
+	reqs := make(chan *logglyRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("err: %s", err)
+				return
+			}
+			body = zr
+		}
+
+		raw, err := ioutil.ReadAll(body)
+		if err != nil {
+			t.Errorf("err: %s", err)
+			return
+		}
+
+		reqs <- &logglyRequest{
+			path:     r.URL.EscapedPath(),
+			encoding: r.Header.Get("Content-Encoding"),
+			lines:    strings.Split(strings.TrimRight(string(raw), "\n"), "\n"),
+		}
+	}))
+	return server, reqs
+}
+
+func TestLogglyOutlet_implements(t *testing.T) {
+	var _ Outlet = new(LogglyOutlet)
+}
+
+func TestLogglyOutlet_requiresToken(t *testing.T) {
+	if _, err := NewLogglyOutlet("my_app", map[string]string{}); err == nil {
+		t.Fatal("expected error without a token")
+	}
+}
+
+func TestLogglyOutlet_defaultTags(t *testing.T) {
+	o, err := NewLogglyOutlet("my_app", map[string]string{"token": "abc"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer o.Close()
+
+	expected := DefaultLogglyURL + "/abc/tag/my_app," + hostname() + "/"
+	if actual := o.(*LogglyOutlet).Endpoint(); actual != expected {
+		t.Fatalf("expected endpoint %s, got %s", expected, actual)
+	}
+}
+
+func TestLogglyOutlet_batch(t *testing.T) {
+	server, reqs := testLogglyServer(t)
+	defer server.Close()
+
+	o, err := NewLogglyOutlet("my_app", map[string]string{
+		"url":        server.URL + "/bulk",
+		"token":      "abc",
+		"tags":       "web, production",
+		"batch_size": "3",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer o.Close()
+
+	o.Write(testRecord("plain line"))
+	o.Write(testRecord(`{"level":"info", "msg":"json line"}`))
+	o.Write(testRecord("third line"))
+
+	var req *logglyRequest
+	select {
+	case req = <-reqs:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for batch")
+	}
+
+	if req.path != "/bulk/abc/tag/web,production/" {
+		t.Errorf("unexpected path: %s", req.path)
+	}
+	if req.encoding != "gzip" {
+		t.Errorf("expected gzip body, got %q", req.encoding)
+	}
+	if len(req.lines) != 3 {
+		t.Fatalf("expected 3 lines, got %v", req.lines)
+	}
+
+	var wrapped map[string]interface{}
+	if err := json.Unmarshal([]byte(req.lines[0]), &wrapped); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if wrapped["message"] != "plain line" || wrapped["process"] != "my_app" || wrapped["stream"] != "stdout" {
+		t.Errorf("unexpected wrapped line: %v", wrapped)
+	}
+
+	if req.lines[1] != `{"level":"info","msg":"json line"}` {
+		t.Errorf("expected JSON line to pass through, got %s", req.lines[1])
+	}
+}
+
+func TestLogglyOutlet_flushOnClose(t *testing.T) {
+	server, reqs := testLogglyServer(t)
+	defer server.Close()
+
+	o, err := NewLogglyOutlet("my_app", map[string]string{
+		"url":            server.URL,
+		"token":          "abc",
+		"gzip":           "false",
+		"flush_interval": "1h",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	o.Write(testRecord("only line"))
+	o.Close()
+
+	select {
+	case req := <-reqs:
+		if req.encoding != "" {
+			t.Errorf("expected plain body, got %q", req.encoding)
+		}
+		if len(req.lines) != 1 {
+			t.Errorf("expected 1 line, got %v", req.lines)
+		}
+	default:
+		t.Fatal("expected batch to be flushed on close")
+	}
+}
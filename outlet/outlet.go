@@ -0,0 +1,135 @@
+package outlet
+
+import (
+	"fmt"
+	"github.com/appio/watchdog/process"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Outlets are drains for process output. Each process may configure any
+// number of outlets by type name in its configuration file, and every line of
+// output from that process is delivered to each of them.
+//
+// Outlets must never block the caller on network I/O, as the caller is the
+// path which drains a child process's stdout and stderr.
+
+// Outlet receives process output and delivers it to an external service.
+type Outlet interface {
+	// Write queues a single line of output for delivery.
+	Write(r *process.Record) error
+
+	// Close flushes any pending output and releases the outlet's resources.
+	Close() error
+}
+
+// Factory constructs an Outlet for the named process from its configuration.
+type Factory func(processName string, config map[string]string) (Outlet, error)
+
+// Outlets is the mapping of all the available outlet types.
+var Outlets = map[string]Factory{
+	"librato": NewLibratoOutlet,
+	"loggly":  NewLogglyOutlet,
+}
+
+// New constructs an outlet for the named process. The outlet type is taken
+// from the "type" key of the config if set, otherwise name is the type. This
+// allows a process to send output to more than one outlet of the same type,
+// each with its own filter.
+func New(name, processName string, config map[string]string) (Outlet, error) {
+	kind := configString(config, "type", name)
+	factory, ok := Outlets[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown outlet type: %s", kind)
+	}
+
+	filter, err := NewFilter(config)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+
+	o, err := factory(processName, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter != nil {
+		o = &filteredOutlet{Outlet: o, filter: filter}
+	}
+	return o, nil
+}
+
+// Validate checks the config of an outlet, including its filter, by
+// constructing it and closing it again before anything is written
+func Validate(name, processName string, config map[string]string) error {
+	o, err := New(name, processName, config)
+	if err != nil {
+		return err
+	}
+	return o.Close()
+}
+
+// hostname returns the hostname of this machine, or "localhost" if it can't
+// be determined.
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "localhost"
+	}
+	return name
+}
+
+// configString returns the value for key, or def if it is not set.
+func configString(config map[string]string, key, def string) string {
+	if v := strings.TrimSpace(config[key]); v != "" {
+		return v
+	}
+	return def
+}
+
+// configInt parses the value for key as an integer, or returns def if it is
+// not set.
+func configInt(config map[string]string, key string, def int) (int, error) {
+	v := strings.TrimSpace(config[key])
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s': %s", key, v, err)
+	}
+	return n, nil
+}
+
+// configBool parses the value for key as a boolean, or returns def if it is
+// not set.
+func configBool(config map[string]string, key string, def bool) (bool, error) {
+	v := strings.TrimSpace(config[key])
+	if v == "" {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s '%s': %s", key, v, err)
+	}
+	return b, nil
+}
+
+// configDuration parses the value for key as a duration, or returns def if it
+// is not set.
+func configDuration(config map[string]string, key string, def time.Duration) (time.Duration, error) {
+	v := strings.TrimSpace(config[key])
+	if v == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s': %s", key, v, err)
+	}
+	return d, nil
+}
@@ -0,0 +1,16 @@
+package outlet
+
+import (
+	"github.com/appio/watchdog/process"
+	"time"
+)
+
+func testRecord(line string) *process.Record {
+	return &process.Record{
+		Process: "my_app",
+		Pid:     42,
+		Stream:  process.Stdout,
+		Time:    time.Now(),
+		Line:    []byte(line),
+	}
+}
@@ -0,0 +1,266 @@
+package process
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// capture reads the stdout and stderr pipes of a running process into its
+// output pipeline. The agent owns the read end of each pipe, so it can hand
+// them over to a new agent without the process noticing.
+type capture struct {
+	framer  *framer
+	grouper *multilineGrouper
+	streams [2]*captureStream
+	wg      sync.WaitGroup
+	pid     int
+
+	// exited is set once the process has exited and its pipes are being
+	// drained, after which a detached capture can't be reattached
+	mu     sync.Mutex
+	exited bool
+
+	// logReady is closed once a line matches the readiness log pattern
+	logReady chan struct{}
+}
+
+// captureStream is one output stream of a captured process
+type captureStream struct {
+	file     *os.File
+	writer   *lineWriter
+	detached bool
+}
+
+// newCapture builds the output pipeline of a process backwards from its
+// buffer. Records are framed, grouped by the process's multiline rule,
+// redacted, parsed according to its log format and delivered to outputChan
+// according to its overflow policy. Lines are matched against its readiness
+// log pattern as they are framed.
+func newCapture(p *Process, outputChan chan *Record) *capture {
+	queue := &outputQueue{
+		out:     outputChan,
+		policy:  p.OutputOverflow,
+		dropped: &p.dropped,
+	}
+	emit := queue.Push
+
+	if p.LogFormat != LogFormatNone {
+		emit = parseStage(p.LogFormat, emit)
+	}
+
+	if p.Redactor != nil {
+		emit = redactStage(p.Redactor, emit)
+	}
+
+	c := new(capture)
+	if p.Multiline != nil {
+		c.grouper = newMultilineGrouper(p.Multiline, emit)
+		emit = c.grouper.Push
+	}
+
+	if p.Readiness != nil && p.Readiness.LogPattern != nil {
+		c.logReady = make(chan struct{})
+		emit = readyLogStage(p.Readiness.LogPattern, c.logReady, emit)
+	}
+
+	c.framer = &framer{name: p.Name, emit: emit}
+	for _, stream := range []Stream{Stdout, Stderr} {
+		c.streams[stream] = &captureStream{
+			writer: newLineWriter(c.framer, stream, p.MaxLineLength, p.PartialLineTimeout),
+		}
+	}
+	return c
+}
+
+// pipes creates a pipe for each stream, returning the write ends for the
+// process
+func (c *capture) pipes() (stdout *os.File, stderr *os.File, err error) {
+	var w [2]*os.File
+	for i, s := range c.streams {
+		r, pw, err := os.Pipe()
+		if err != nil {
+			c.closePipes(w[:i]...)
+			return nil, nil, err
+		}
+		s.file = r
+		w[i] = pw
+	}
+	return w[Stdout], w[Stderr], nil
+}
+
+// closePipes closes the given write ends and every read end
+func (c *capture) closePipes(files ...*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+	for _, s := range c.streams {
+		if s.file != nil {
+			s.file.Close()
+		}
+	}
+}
+
+// start copies from the read end of each pipe until the process and
+// anything it started close their end, or the capture is detached
+func (c *capture) start(pid int, seq uint64) {
+	c.pid = pid
+	c.framer.setPid(pid)
+	c.framer.seq = seq
+
+	for _, s := range c.streams {
+		c.wg.Add(1)
+		go c.copy(s)
+	}
+}
+
+func (c *capture) copy(s *captureStream) {
+	defer c.wg.Done()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := s.file.Read(buf)
+		if n > 0 {
+			s.writer.Write(buf[:n])
+		}
+		if err == nil {
+			continue
+		}
+
+		// A detached pipe is left open for whoever takes it over
+		if !os.IsTimeout(err) {
+			s.file.Close()
+		}
+		return
+	}
+}
+
+// pipeDrainTimeout is how long to wait for the pipes of an exited process
+// to be closed. Descendants which outlive it may hold them open.
+var pipeDrainTimeout = time.Second
+
+// wait blocks until both pipes are closed, then flushes any output still
+// held back waiting for a newline or the rest of a multiline group. If they
+// are still open after timeout it returns, and output from whatever holds
+// them open is captured until they are closed.
+func (c *capture) wait(timeout time.Duration) {
+	c.mu.Lock()
+	c.exited = true
+	c.mu.Unlock()
+
+	closed := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		c.flush()
+	case <-time.After(timeout):
+		go func() {
+			<-closed
+			c.flush()
+		}()
+	}
+}
+
+func (c *capture) flush() {
+	for _, s := range c.streams {
+		if !s.detached {
+			s.writer.Close()
+		}
+	}
+	if c.grouper != nil {
+		c.grouper.Flush()
+	}
+}
+
+// detach stops reading output, leaving whatever the process writes from now
+// on in the pipes. It returns duplicates of the read ends, which aren't
+// closed on exec, and the last sequence number. Output already read is
+// flushed through the pipeline first.
+func (c *capture) detach() (stdout uintptr, stderr uintptr, seq uint64, err error) {
+	for _, s := range c.streams {
+		s.detached = true
+		s.file.SetReadDeadline(time.Now())
+	}
+	c.wg.Wait()
+
+	for _, s := range c.streams {
+		s.writer.flushPartial()
+	}
+	if c.grouper != nil {
+		c.grouper.Flush()
+	}
+
+	c.framer.Lock()
+	seq = c.framer.seq
+	c.framer.Unlock()
+
+	var fds [2]uintptr
+	for i, s := range c.streams {
+		if fds[i], err = dup(s.file); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	for _, s := range c.streams {
+		s.file.Close()
+	}
+
+	return fds[Stdout], fds[Stderr], seq, nil
+}
+
+// reattach reads output again from the duplicates of the read ends returned
+// by detach, when they weren't taken over after all. It returns false,
+// closing them, if the process has exited since.
+func (c *capture) reattach(stdout, stderr uintptr) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fds := []uintptr{stdout, stderr}
+	if c.exited {
+		for _, fd := range fds {
+			syscall.Close(int(fd))
+		}
+		return false
+	}
+
+	for i, fd := range fds {
+		c.streams[i].file = adoptPipe(fd, Stream(i))
+		c.streams[i].detached = false
+	}
+	for _, s := range c.streams {
+		c.wg.Add(1)
+		go c.copy(s)
+	}
+	return true
+}
+
+// adoptPipe takes over the read end of a pipe handed over by detach, which
+// is closed on exec again so processes started from now on don't inherit it
+func adoptPipe(fd uintptr, stream Stream) *os.File {
+	syscall.CloseOnExec(int(fd))
+	// Non-blocking files can be detached again for the next upgrade
+	syscall.SetNonblock(int(fd), true)
+	return os.NewFile(fd, stream.String())
+}
+
+// dup duplicates the file descriptor of a file
+func dup(f *os.File) (uintptr, error) {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var fd int
+	var dupErr error
+	err = conn.Control(func(orig uintptr) {
+		fd, dupErr = syscall.Dup(int(orig))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return uintptr(fd), dupErr
+}
@@ -0,0 +1,269 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// cgroupRoot is where the cgroup v2 hierarchy is mounted
+var cgroupRoot = "/sys/fs/cgroup"
+
+// cgroup is the cgroup v2 group a process runs in, beneath the agent's own
+type cgroup struct {
+	path string
+}
+
+// agentLeaf is the cgroup the agent moves into so controllers can be
+// enabled for the process cgroups beside it, as a cgroup with processes in
+// it can't delegate controllers to its children
+const agentLeaf = "agent"
+
+// delegateLock serializes enabling controllers in the agent's cgroup
+var delegateLock sync.Mutex
+
+// processCgroup returns the cgroup for the named process, which is kept for
+// every instance of the process
+func processCgroup(name string) (*cgroup, error) {
+	base, err := agentCgroup()
+	if err != nil {
+		return nil, err
+	}
+
+	return &cgroup{
+		path: filepath.Join(base, "watchdog-"+url.PathEscape(name)),
+	}, nil
+}
+
+// agentCgroup returns the path of the cgroup process cgroups are created
+// in, the agent's own unless it moved into its leaf
+func agentCgroup() (string, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return "", fmt.Errorf("cgroup v2 is not available")
+	}
+
+	self, err := selfCgroup()
+	if err != nil {
+		return "", err
+	}
+	if filepath.Base(self) == agentLeaf {
+		self = filepath.Dir(self)
+	}
+	return filepath.Join(cgroupRoot, self), nil
+}
+
+// delegate enables controllers for the process cgroups in the agent's
+// cgroup. If the agent's cgroup has processes in it, which the kernel
+// doesn't allow in a cgroup delegating controllers, they are moved into
+// the agent's leaf first.
+func delegate(controllers []string) error {
+	if len(controllers) == 0 {
+		return nil
+	}
+
+	base, err := agentCgroup()
+	if err != nil {
+		return err
+	}
+
+	delegateLock.Lock()
+	defer delegateLock.Unlock()
+
+	available, err := ioutil.ReadFile(filepath.Join(base, "cgroup.controllers"))
+	if err != nil {
+		return err
+	}
+	enabled, err := ioutil.ReadFile(filepath.Join(base, "cgroup.subtree_control"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var missing []string
+	for _, c := range controllers {
+		if !hasField(available, c) {
+			return fmt.Errorf("the %s controller is not delegated to %s", c, base)
+		}
+		if !hasField(enabled, c) {
+			missing = append(missing, "+"+c)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	control := filepath.Join(base, "cgroup.subtree_control")
+	change := []byte(strings.Join(missing, " "))
+	err = ioutil.WriteFile(control, change, 0644)
+	if pathErr, ok := err.(*os.PathError); ok && pathErr.Err == syscall.EBUSY {
+		if err := moveToLeaf(base); err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(control, change, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to enable cgroup controllers: %s", err)
+	}
+	return nil
+}
+
+// moveToLeaf moves the processes in the agent's cgroup into its leaf
+func moveToLeaf(base string) error {
+	leaf := &cgroup{path: filepath.Join(base, agentLeaf)}
+	if err := os.MkdirAll(leaf.path, 0755); err != nil {
+		return fmt.Errorf("unable to create agent cgroup: %s", err)
+	}
+
+	pids, err := (&cgroup{path: base}).pids()
+	if err != nil {
+		return err
+	}
+	for _, pid := range pids {
+		err := ioutil.WriteFile(filepath.Join(leaf.path, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644)
+		if pathErr, ok := err.(*os.PathError); ok && pathErr.Err == syscall.ESRCH {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("unable to move %d to agent cgroup: %s", pid, err)
+		}
+	}
+	return nil
+}
+
+func hasField(data []byte, field string) bool {
+	for _, f := range strings.Fields(string(data)) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// selfCgroup reads the agent's own cgroup v2 path from /proc
+func selfCgroup() (string, error) {
+	data, err := ioutil.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "0::") {
+			return line[3:], nil
+		}
+	}
+	return "", fmt.Errorf("agent is not in a cgroup v2 hierarchy")
+}
+
+// attach creates the cgroup and has the process started in it. The returned
+// file must be kept open until the process has started.
+func (cg *cgroup) attach(attr *syscall.SysProcAttr) (*os.File, error) {
+	if err := os.MkdirAll(cg.path, 0755); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.Open(cg.path)
+	if err != nil {
+		return nil, err
+	}
+
+	attr.UseCgroupFD = true
+	attr.CgroupFD = int(dir.Fd())
+	return dir, nil
+}
+
+// setLimits enables the controllers the limits need and writes them to the
+// cgroup
+func (cg *cgroup) setLimits(limits *CgroupLimits) error {
+	if err := delegate(limits.controllers()); err != nil {
+		return err
+	}
+
+	for name, value := range limits.files() {
+		path := filepath.Join(cg.path, name)
+		err := ioutil.WriteFile(path, []byte(value), 0644)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to set %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+// oomKills is how many processes in the cgroup the OOM killer has killed
+func (cg *cgroup) oomKills() uint64 {
+	data, err := ioutil.ReadFile(filepath.Join(cg.path, "memory.events"))
+	if err != nil {
+		return 0
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			n, _ := strconv.ParseUint(fields[1], 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+// signal sends a signal to every process in the cgroup. SIGKILL uses
+// cgroup.kill where the kernel has it, which also catches processes forking
+// while they are killed.
+func (cg *cgroup) signal(sig syscall.Signal) error {
+	if sig == syscall.SIGKILL {
+		err := ioutil.WriteFile(filepath.Join(cg.path, "cgroup.kill"), []byte("1"), 0644)
+		if err == nil {
+			return nil
+		}
+	}
+
+	pids, err := cg.pids()
+	if err != nil {
+		return err
+	}
+	for _, pid := range pids {
+		syscall.Kill(pid, sig)
+	}
+	return nil
+}
+
+// pids lists the processes in the cgroup
+func (cg *cgroup) pids() ([]int, error) {
+	data, err := ioutil.ReadFile(filepath.Join(cg.path, "cgroup.procs"))
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []int
+	for _, field := range strings.Fields(string(data)) {
+		if pid, err := strconv.Atoi(field); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids, nil
+}
+
+// populated reports whether any process is left in the cgroup
+func (cg *cgroup) populated() bool {
+	data, err := ioutil.ReadFile(filepath.Join(cg.path, "cgroup.events"))
+	if err != nil {
+		return false
+	}
+	return bytes.Contains(data, []byte("populated 1"))
+}
+
+// remove deletes the cgroup once it is empty
+func (cg *cgroup) remove() {
+	os.Remove(cg.path)
+}
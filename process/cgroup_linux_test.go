@@ -0,0 +1,109 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCgroup_signal(t *testing.T) {
+	root, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	defer func(old string) { cgroupRoot = old }(cgroupRoot)
+	cgroupRoot = root
+	ioutil.WriteFile(filepath.Join(root, "cgroup.controllers"), nil, 0644)
+
+	cg, err := processCgroup("web/api")
+	if err != nil {
+		t.Skipf("agent is not in a cgroup v2 hierarchy: %s", err)
+	}
+	if filepath.Base(cg.path) != "watchdog-web%2Fapi" {
+		t.Fatalf("unexpected cgroup path: %s", cg.path)
+	}
+	os.MkdirAll(cg.path, 0755)
+
+	sleep := exec.Command("/bin/sleep", "5")
+	if err := sleep.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer sleep.Process.Kill()
+
+	// A fake cgroup, which the kernel doesn't maintain
+	ioutil.WriteFile(filepath.Join(cg.path, "cgroup.procs"), []byte(strconv.Itoa(sleep.Process.Pid)+"\n"), 0644)
+	ioutil.WriteFile(filepath.Join(cg.path, "cgroup.events"), []byte("populated 1\nfrozen 0\n"), 0644)
+
+	if !cg.populated() {
+		t.Fatalf("expected cgroup to be populated")
+	}
+	if err := cg.signal(syscall.SIGTERM); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- sleep.Wait() }()
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatalf("expected process in cgroup to be signalled")
+	}
+}
+
+func TestCgroup_setLimits(t *testing.T) {
+	root, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(root)
+
+	defer func(old string) { cgroupRoot = old }(cgroupRoot)
+	cgroupRoot = root
+	ioutil.WriteFile(filepath.Join(root, "cgroup.controllers"), nil, 0644)
+
+	base, err := agentCgroup()
+	if err != nil {
+		t.Skipf("agent is not in a cgroup v2 hierarchy: %s", err)
+	}
+	os.MkdirAll(base, 0755)
+	ioutil.WriteFile(filepath.Join(base, "cgroup.controllers"), []byte("cpu memory pids\n"), 0644)
+
+	cg, err := processCgroup("web")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	os.MkdirAll(cg.path, 0755)
+
+	limits := &CgroupLimits{MemoryMax: 64 << 20, PidsMax: 10}
+	if err := cg.setLimits(limits); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	control, _ := ioutil.ReadFile(filepath.Join(base, "cgroup.subtree_control"))
+	if string(control) != "+memory +pids" {
+		t.Fatalf("unexpected controllers enabled: %q", control)
+	}
+	for name, expected := range map[string]string{"memory.max": "67108864", "pids.max": "10", "cpu.max": "max"} {
+		if data, _ := ioutil.ReadFile(filepath.Join(cg.path, name)); string(data) != expected {
+			t.Errorf("expected %s to be %q, got %q", name, expected, data)
+		}
+	}
+
+	// A controller which isn't delegated to the agent
+	ioutil.WriteFile(filepath.Join(base, "cgroup.controllers"), []byte("pids\n"), 0644)
+	if err := cg.setLimits(limits); err == nil {
+		t.Fatalf("expected error without the memory controller")
+	}
+
+	ioutil.WriteFile(filepath.Join(cg.path, "memory.events"), []byte("low 0\nhigh 3\nmax 5\noom 1\noom_kill 1\n"), 0644)
+	if n := cg.oomKills(); n != 1 {
+		t.Errorf("expected 1 OOM kill, got %d", n)
+	}
+}
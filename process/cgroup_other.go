@@ -0,0 +1,39 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// cgroup is only supported on Linux
+type cgroup struct{}
+
+func processCgroup(name string) (*cgroup, error) {
+	return nil, fmt.Errorf("cgroups are not supported on this platform")
+}
+
+func (cg *cgroup) attach(attr *syscall.SysProcAttr) (*os.File, error) {
+	return nil, fmt.Errorf("cgroups are not supported on this platform")
+}
+
+func (cg *cgroup) setLimits(limits *CgroupLimits) error {
+	return fmt.Errorf("cgroups are not supported on this platform")
+}
+
+func (cg *cgroup) oomKills() uint64 {
+	return 0
+}
+
+func (cg *cgroup) signal(sig syscall.Signal) error {
+	return nil
+}
+
+func (cg *cgroup) populated() bool {
+	return false
+}
+
+func (cg *cgroup) remove() {}
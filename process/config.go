@@ -4,9 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 	// "fmt"
-	// "github.com/BurntSushi/toml"
+	"github.com/BurntSushi/toml"
 	"github.com/mitchellh/mapstructure"
 	"io"
 	// "os"
@@ -58,6 +61,12 @@ type ProcessConfig struct {
 	// Watchdog will not restart the process unless you manually tell it to do so.
 	KeepAlive bool `mapstructure:"keep_alive"`
 
+	// KillOrphans is used to kill descendants of the process left running
+	// once it exits, which the agent reaps as a child subreaper. By default
+	// they are left to run and reaped when they exit. Only supported on
+	// Linux.
+	KillOrphans bool `mapstructure:"kill_orphans"`
+
 	// RunAtLoad key is used to control whether your process is launched once
 	// at the time the config is loaded. The default is true.
 	RunAtLoad bool `mapstructure:"run_at_load"`
@@ -66,19 +75,123 @@ type ProcessConfig struct {
 	// to chdir(2) to before running the process.
 	WorkingDirectory string `mapstructure:"working_directory"`
 
+	// RootDirectory is an optional directory to chroot(2) to before running
+	// the process, which needs root. The program is looked up inside it.
+	RootDirectory string `mapstructure:"root_directory"`
+
+	// Umask is the octal file mode creation mask of the process, such as
+	// "0002". By default it inherits the agent's.
+	Umask string `mapstructure:"umask"`
+
+	// Stdin is what the process reads as its standard input: "null" for the
+	// null device, which is the default, the path of a file, or "pipe:" and
+	// the path of a named pipe the agent creates and keeps open, such as
+	// "pipe:/run/worker.stdin". Anything written to the named pipe is read by
+	// the process.
+	Stdin string `mapstructure:"stdin"`
+
 	// EnvironmentVariables key is used to specify additional environmental
 	// variables to be set before running the process.
 	EnvironmentVariables map[string]string `mapstructure:"environment_variables"`
 
+	// Readiness optionally checks when the process is ready after starting,
+	// such as by its port accepting connections. It is "starting" until then,
+	// and starting it only succeeds once it is ready.
+	Readiness *ReadinessConfig `mapstructure:"readiness"`
+
+	// Notify gives the process a socket to send notifications to, as with
+	// systemd's sd_notify, named by NOTIFY_SOCKET in its environment. It is
+	// ready once it sends READY=1, and any other readiness checks pass. Only
+	// supported on Linux.
+	Notify bool `mapstructure:"notify"`
+
+	// WatchdogInterval is how often a process with notify must send
+	// WATCHDOG=1 once it is ready, such as "10s", which is set as
+	// WATCHDOG_USEC in its environment. A process which misses it is sent
+	// SIGABRT and restarted.
+	WatchdogInterval string `mapstructure:"watchdog_interval"`
+
+	// Timeout is how long the process has to become ready, such as "30s",
+	// after which it is stopped and fails to start. The default is 1m.
+	Timeout string `mapstructure:"timeout"`
+
 	// KillSignal is used to specify which os.Signal to send to the process to
 	// instruct it to exit gracefully. Default is SIGKILL.
 	KillSignal string `mapstructure:"kill_signal"`
 
 	// KillTimeout is used to specify the amount of time to wait for the process
-	// to safely exit after sending KillSignal before sending a SIGTERM. The
+	// to safely exit after sending KillSignal before sending a SIGKILL. The
 	// default is 10s.
 	KillTimeout string `mapstructure:"kill_timeout"`
 
+	// KillMode decides which processes are signalled when the process is
+	// stopped. "group" signals the process group it leads, which includes
+	// its children, "main" only the process itself, and "cgroup" every
+	// process in its own cgroup, falling back to "group" without cgroup v2.
+	// The default is "group".
+	KillMode string `mapstructure:"kill_mode"`
+
+	// Limits sets resource limits for the process, keyed by resource: nofile,
+	// nproc, core, as, stack, cpu and memlock. Each is a number, "unlimited",
+	// "soft:hard" or a map with soft and hard keys, and sizes may have a K, M,
+	// G or T suffix. Raising a hard limit needs root.
+	Limits map[string]interface{} `mapstructure:"limits"`
+
+	// MemoryMax is the most memory the process can use, such as "512M" or
+	// "max". It is killed by the OOM killer if it can't be kept below it,
+	// which is reported as its exit status. Like the other cgroup limits it
+	// needs cgroup v2, with the controller delegated to the agent, and the
+	// process fails to start if it can't be applied.
+	MemoryMax string `mapstructure:"memory_max"`
+
+	// MemoryHigh is the memory use above which the process is throttled and
+	// its memory reclaimed.
+	MemoryHigh string `mapstructure:"memory_high"`
+
+	// CPUWeight is the process's share of CPU time relative to others, from
+	// 1 to 10000. The default weight is 100.
+	CPUWeight int `mapstructure:"cpu_weight"`
+
+	// CPUMax caps the CPU time of the process, as a percentage of one CPU
+	// such as "50%" or "200%", or a quota and period in microseconds such as
+	// "50000 100000".
+	CPUMax string `mapstructure:"cpu_max"`
+
+	// PidsMax is the most processes and threads the process can have.
+	PidsMax int `mapstructure:"pids_max"`
+
+	// Nice is the nice value of the process, from -20, the most favourable
+	// to the process, to 19. Lowering it below the agent's needs root.
+	Nice *int `mapstructure:"nice"`
+
+	// IOClass is the IO scheduling class of the process, "realtime",
+	// "best-effort" or "idle", and IOPriority its priority within the class
+	// from 0, the highest, to 7. Only supported on Linux.
+	IOClass    string `mapstructure:"io_class"`
+	IOPriority *int   `mapstructure:"io_priority"`
+
+	// CPUAffinity restricts the process to some CPUs, given as a list such
+	// as [0, 1] or a string of CPUs and ranges such as "0-3,8". Only
+	// supported on Linux.
+	CPUAffinity interface{} `mapstructure:"cpu_affinity"`
+
+	// OOMScoreAdjust makes the OOM killer more likely to pick the process,
+	// up to 1000, or less likely, down to -1000 which exempts it. Lowering
+	// it needs root. Only supported on Linux.
+	OOMScoreAdjust *int `mapstructure:"oom_score_adjust"`
+
+	// Sandbox optionally runs the process in new namespaces, with a private
+	// /tmp, read-only paths, no_new_privs and a limited set of
+	// capabilities. Only supported on Linux, and mostly only as root.
+	Sandbox *SandboxConfig `mapstructure:"sandbox"`
+
+	// RestartRules restart the process when its resource usage stays above a
+	// threshold, such as "rss > 1.5G for 5m", "cpu > 95% for 10m" or
+	// "fds > 1000". The metrics are rss, memory (of its cgroup), cpu, fds
+	// and threads, which are sampled every 5s. The process is restarted
+	// gracefully, as if it were stopped and started.
+	RestartRules []string `mapstructure:"restart_rules"`
+
 	// ThrottleInterval specifies the amount of time to wait before respawning the
 	// process after it exits, if it is set to KeepAlive. The default value is
 	// 10s.
@@ -91,6 +204,43 @@ type ProcessConfig struct {
 	// Outlets specifies a an outlet type by key and value of configuration to
 	// be passed to that outlet when being constructed.
 	Outlets map[string]map[string]string
+
+	// OutputBufferSize is the number of lines of output buffered for this
+	// process while waiting to be sent to outlets. The default is 1024.
+	OutputBufferSize int `mapstructure:"output_buffer_size"`
+
+	// OutputOverflow specifies what to do with output when the buffer is full:
+	// "drop-oldest" (the default) and "drop-newest" discard output so the
+	// process never stalls, while "block" stops the process until the buffer
+	// drains.
+	OutputOverflow string `mapstructure:"output_overflow"`
+
+	// MaxLineLength is the longest line of output, in bytes, sent to outlets
+	// as a single line. Longer lines are split. The default is 16384.
+	MaxLineLength int `mapstructure:"max_line_length"`
+
+	// PartialLineTimeout is how long to wait for the newline ending a line of
+	// output before sending what has been written so far, so prompts and
+	// progress output aren't held back indefinitely. The default is 1s.
+	PartialLineTimeout string `mapstructure:"partial_line_timeout"`
+
+	// Multiline optionally groups related lines of output, such as the lines
+	// of a stack trace, into a single line before they are sent to outlets.
+	Multiline *MultilineConfig `mapstructure:"multiline"`
+
+	// LogFormat optionally parses each line of output into fields so outlets
+	// can filter on them. It is one of "json", "logfmt" or "auto", which
+	// detects either format line by line.
+	LogFormat string `mapstructure:"log_format"`
+
+	// Redact masks secrets in output before it is sent to outlets or shown by
+	// the agent, using built-in rules for common credential formats and any
+	// additional patterns.
+	Redact *RedactConfig `mapstructure:"redact"`
+
+	// SecretEnvironmentVariables lists the keys of EnvironmentVariables whose
+	// values are secret. Their values are always masked in output.
+	SecretEnvironmentVariables []string `mapstructure:"secret_environment_variables"`
 }
 
 // IsValid returns whether the config is valid for starting a process.
@@ -106,6 +256,140 @@ func (p *ProcessConfig) IsValid() bool {
 	return true
 }
 
+// Validate checks the optional keys of the config are well formed, returning
+// the first problem found.
+func (p *ProcessConfig) Validate() error {
+	if _, err := ParseOverflowPolicy(p.OutputOverflow); err != nil {
+		return err
+	}
+
+	if p.OutputBufferSize < 0 {
+		return fmt.Errorf("invalid output_buffer_size: %d", p.OutputBufferSize)
+	}
+
+	if p.MaxLineLength < 0 {
+		return fmt.Errorf("invalid max_line_length: %d", p.MaxLineLength)
+	}
+
+	if p.PartialLineTimeout != "" {
+		if timeout, err := time.ParseDuration(p.PartialLineTimeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid partial_line_timeout: %s", p.PartialLineTimeout)
+		}
+	}
+
+	if _, err := ParseLogFormat(p.LogFormat); err != nil {
+		return err
+	}
+
+	if _, err := ParseKillMode(p.KillMode); err != nil {
+		return err
+	}
+
+	if _, err := ParseLimits(p.Limits); err != nil {
+		return err
+	}
+
+	if _, err := ParseCgroupLimits(p); err != nil {
+		return err
+	}
+
+	for _, rule := range p.RestartRules {
+		if _, err := ParseRestartRule(rule); err != nil {
+			return err
+		}
+	}
+
+	if _, err := ParseSandbox(p.Sandbox); err != nil {
+		return err
+	}
+
+	if _, err := ParseScheduling(p); err != nil {
+		return err
+	}
+
+	if p.RootDirectory != "" && !filepath.IsAbs(p.RootDirectory) {
+		return fmt.Errorf("root directory %s is not absolute", p.RootDirectory)
+	}
+
+	if _, err := ParseUmask(p.Umask); err != nil {
+		return err
+	}
+
+	if _, err := ParseStdin(p.Stdin); err != nil {
+		return err
+	}
+
+	if _, err := NewReadiness(p.Readiness, p.Notify); err != nil {
+		return err
+	}
+
+	if p.WatchdogInterval != "" {
+		if !p.Notify {
+			return fmt.Errorf("watchdog_interval requires notify")
+		}
+		if interval, err := time.ParseDuration(p.WatchdogInterval); err != nil || interval <= 0 {
+			return fmt.Errorf("invalid watchdog_interval: %s", p.WatchdogInterval)
+		}
+	}
+
+	// The notify socket isn't reachable from another network namespace
+	if p.Notify && p.Sandbox != nil {
+		for _, ns := range p.Sandbox.Namespaces {
+			if strings.ToLower(ns) == "network" {
+				return fmt.Errorf("notify can't be used with a network namespace")
+			}
+		}
+	}
+
+	if p.Timeout != "" {
+		if timeout, err := time.ParseDuration(p.Timeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid timeout: %s", p.Timeout)
+		}
+	}
+
+	if p.Multiline != nil {
+		if _, err := NewMultilineRule(p.Multiline); err != nil {
+			return err
+		}
+	}
+
+	for _, key := range p.SecretEnvironmentVariables {
+		if _, ok := p.EnvironmentVariables[key]; !ok {
+			return fmt.Errorf("secret environment variable %s is not set", key)
+		}
+	}
+
+	if _, err := NewRedactor(p.Redact, p.secretValues()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ParseUmask parses an octal umask, returning nil if it isn't set
+func ParseUmask(s string) (*int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	mask, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mask > 0777 {
+		return nil, fmt.Errorf("invalid umask: %s", s)
+	}
+	umask := int(mask)
+	return &umask, nil
+}
+
+// secretValues returns the values of the secret environment variables
+func (p *ProcessConfig) secretValues() []string {
+	var values []string
+	for _, key := range p.SecretEnvironmentVariables {
+		if value, ok := p.EnvironmentVariables[key]; ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // LoadConfigFile loads a process configuration from a file on disk.
 func LoadConfigFile(path string) (*ProcessConfig, error) {
 	conf, err := decodeConfigFile(path)
@@ -117,6 +401,10 @@ func LoadConfigFile(path string) (*ProcessConfig, error) {
 		return nil, fmt.Errorf("configuration is incomplete")
 	}
 
+	if err := conf.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration '%s': %s", path, err)
+	}
+
 	return conf, nil
 }
 
@@ -154,7 +442,27 @@ func DecodeConfigFromJSON(r io.Reader) (*ProcessConfig, error) {
 
 // DecodeConfigFromTOML loads a ProcessConfig from a TOML file
 func DecodeConfigFromTOML(r io.Reader) (*ProcessConfig, error) {
-	return new(ProcessConfig), nil
+	var raw interface{}
+	if _, err := toml.DecodeReader(r, &raw); err != nil {
+		return nil, err
+	}
+
+	// Decode
+	var md mapstructure.Metadata
+	var result ProcessConfig
+	msdec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Metadata: &md,
+		Result:   &result,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := msdec.Decode(raw); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
 }
 
 func decodeConfigFile(path string) (*ProcessConfig, error) {
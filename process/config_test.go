@@ -3,7 +3,9 @@ package process
 import (
 	"io/ioutil"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 var testConfigJSON string = `{
@@ -74,3 +76,115 @@ func TestConfigLoadFromJSON(t *testing.T) {
 		t.Errorf("Expected kill signal=%v, got %v", actual, expected)
 	}
 }
+
+func TestConfigDecodeFromTOML(t *testing.T) {
+	input := `
+name = "my_app"
+program = "/usr/local/bin/node"
+program_arguments = ["app.js", "--port=8000"]
+keep_alive = true
+
+[environment_variables]
+HOSTNAME = "myapp.example.com"
+`
+	config, err := DecodeConfigFromTOML(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if config.Name != "my_app" || len(config.ProgramArguments) != 2 || !config.KeepAlive {
+		t.Fatalf("bad: %#v", config)
+	}
+	if config.EnvironmentVariables["HOSTNAME"] != "myapp.example.com" {
+		t.Fatalf("bad: %#v", config.EnvironmentVariables)
+	}
+}
+
+func TestConfigDecodeMultiline(t *testing.T) {
+	config, err := DecodeConfigFromJSON(strings.NewReader(`{
+		"name": "my_app",
+		"program": "/usr/local/bin/node",
+		"multiline": {
+			"continuation_pattern": "^\\s+at ",
+			"max_lines": 50,
+			"timeout": "1s"
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if config.Multiline == nil || config.Multiline.MaxLines != 50 {
+		t.Fatalf("bad: %#v", config.Multiline)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	proc := NewProcessFromConfig(config)
+	if proc.Multiline == nil || proc.Multiline.Timeout != time.Second {
+		t.Errorf("expected multiline rule on process, got %#v", proc.Multiline)
+	}
+}
+
+func TestConfigDecodeChildOptions(t *testing.T) {
+	config, err := DecodeConfigFromJSON(strings.NewReader(`{
+		"name": "my_app",
+		"program": "/usr/local/bin/node",
+		"umask": "0002",
+		"root_directory": "/srv/my_app",
+		"stdin": "pipe:/run/my_app.stdin"
+	}`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	proc := NewProcessFromConfig(config)
+	if proc.Umask == nil || *proc.Umask != 02 || proc.RootDirectory != "/srv/my_app" {
+		t.Errorf("unexpected process: %#v", proc)
+	}
+	if proc.Stdin == nil || !proc.Stdin.Pipe || proc.Stdin.Path != "/run/my_app.stdin" {
+		t.Errorf("unexpected stdin: %#v", proc.Stdin)
+	}
+
+	invalid := []string{
+		`{"umask": "0999"}`,
+		`{"umask": "1777"}`,
+		`{"root_directory": "srv"}`,
+		`{"stdin": "input.txt"}`,
+	}
+	for _, in := range invalid {
+		config, err := DecodeConfigFromJSON(strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := config.Validate(); err == nil {
+			t.Errorf("expected error validating %s", in)
+		}
+	}
+}
+
+func TestConfigValidate_output(t *testing.T) {
+	invalid := []string{
+		`{"output_overflow": "spill"}`,
+		`{"output_buffer_size": -1}`,
+		`{"max_line_length": -1}`,
+		`{"partial_line_timeout": "soon"}`,
+		`{"multiline": {"start_pattern": "("}}`,
+		`{"multiline": {"start_pattern": "^\\S", "timeout": "-1s"}}`,
+		`{"log_format": "xml"}`,
+		`{"redact": {"patterns": ["("]}}`,
+	}
+	for _, in := range invalid {
+		config, err := DecodeConfigFromJSON(strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := config.Validate(); err == nil {
+			t.Errorf("expected error validating %s", in)
+		}
+	}
+}
@@ -1,62 +1,317 @@
 package process
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"syscall"
 )
 
-// outputWriter is a simple io.Writer which writes to a channel
-type outputWriter struct {
-	out chan<- []byte
-}
+type DefaultRunner struct{}
 
-func (w *outputWriter) Write(b []byte) (n int, err error) {
-	w.out <- b
-	return len(b), nil
-}
+// Exec launches the given process. Its stdout and stderr are captured into
+// line records and delivered to outputChan, see newCapture.
+func (r *DefaultRunner) Exec(p *Process, outputChan chan *Record, done chan int) (proc *os.Process, err error) {
+	executable, err := lookPath(p)
+	if err != nil {
+		return nil, err
+	}
 
-type DefaultRunner struct{}
+	if p.Notify {
+		if p.notify, err = listenNotify(p); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err != nil {
+				p.notify.Close()
+				p.notify = nil
+			}
+		}()
+	}
+
+	var stdin *os.File
+	if p.Stdin != nil {
+		if stdin, err = p.Stdin.open(); err != nil {
+			return nil, err
+		}
+		// The process has its own copy once started
+		defer stdin.Close()
+	}
 
-// Exec launches the given process
-func (r *DefaultRunner) Exec(p *Process, outputChan chan []byte, done chan int) (proc *os.Process, err error) {
-	var exitStatus int = 0
+	c := newCapture(p, outputChan)
+	stdout, stderr, err := c.pipes()
+	if err != nil {
+		return nil, err
+	}
 
-	executable, err := exec.LookPath(p.Command[0])
+	cmd, status, err := r.command(p, executable, stdin, stdout, stderr)
 	if err != nil {
+		c.closePipes(stdout, stderr)
 		return nil, err
 	}
 
-	cmd := exec.Command(executable, p.Command[1:]...)
-	cmd.Env = append(cmd.Env, p.formattedEnv()...)
+	// Start the process in its own cgroup, if it has one. Its cgroup limits
+	// can't be applied without one.
+	p.cgroup = nil
+	if p.KillMode == KillModeCgroup || p.CgroupLimits != nil {
+		dir, err := r.cgroup(p, cmd)
+		if err != nil && p.CgroupLimits != nil {
+			if status != nil {
+				closeShim(cmd, status)
+			}
+			c.closePipes(stdout, stderr)
+			return nil, fmt.Errorf("unable to apply cgroup limits: %s", err)
+		}
+		if err != nil {
+			fmt.Println("Falling back to process group:", err)
+		} else {
+			defer dir.Close()
+		}
+	}
 
-	writer := &outputWriter{outputChan}
-	cmd.Stderr = writer
-	cmd.Stdout = writer
+	// Processes killed by the OOM killer are told apart by the count of OOM
+	// kills in their cgroup
+	var oomKills uint64
+	if p.cgroup != nil {
+		oomKills = p.cgroup.oomKills()
+	}
+
+	err = r.start(cmd, status)
+	if err != nil && p.cgroup != nil && p.CgroupLimits == nil {
+		// Older kernels can't start a process in a cgroup
+		fmt.Println("Falling back to process group:", err)
+		p.cgroup = nil
+		if cmd, status, err = r.command(p, executable, stdin, stdout, stderr); err == nil {
+			err = r.start(cmd, status)
+		}
+	}
 
-	if err := cmd.Start(); err != nil {
+	// The process has its own copy of the write ends now
+	stdout.Close()
+	stderr.Close()
+	if err != nil {
+		c.closePipes()
 		return nil, err
 	}
 
 	p.setPid(cmd.Process.Pid)
+	p.capture = c
+	c.start(cmd.Process.Pid, 0)
+	if p.notify != nil {
+		go p.notify.serve(p)
+	}
 
-	go func(cmd *exec.Cmd) {
-		defer func() {
-			p.setPid(0)
-		}()
-
+	go func(cmd *exec.Cmd, cg *cgroup) {
 		// Wait for the process to exit
 		err := cmd.Wait()
-		if err != nil {
-			switch err.(type) {
-			case *exec.ExitError:
-				exitStatus = err.(*exec.ExitError).Sys().(syscall.WaitStatus).ExitStatus()
-			case *os.PathError:
-				exitStatus = 127
-			}
+		untrackChild(cmd.Process.Pid)
+
+		status := exitStatus(err)
+		if cg != nil && status == 128+int(syscall.SIGKILL) && cg.oomKills() > oomKills {
+			status = OOMKilledExitStatus
 		}
-		done <- exitStatus
-	}(cmd)
+		done <- r.finish(p, c, status)
+	}(cmd, p.cgroup)
 
 	return cmd.Process, nil
 }
+
+// cgroup creates the cgroup of a process, applying its limits, and has cmd
+// started in it. The returned file must be kept open until it has started.
+func (r *DefaultRunner) cgroup(p *Process, cmd *exec.Cmd) (*os.File, error) {
+	cg, err := processCgroup(p.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := cg.attach(cmd.SysProcAttr)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.CgroupLimits != nil {
+		if err := cg.setLimits(p.CgroupLimits); err != nil {
+			dir.Close()
+			return nil, err
+		}
+	}
+
+	p.cgroup = cg
+	return dir, nil
+}
+
+// lookPath finds the executable of a process, inside its root directory if
+// it has one
+func lookPath(p *Process) (string, error) {
+	if p.RootDirectory == "" {
+		return exec.LookPath(p.Command[0])
+	}
+
+	file := p.Command[0]
+	if strings.Contains(file, "/") {
+		if !filepath.IsAbs(file) {
+			return "", fmt.Errorf("exec: %q must be absolute with a root directory", file)
+		}
+		if err := findExecutable(filepath.Join(p.RootDirectory, file)); err != nil {
+			return "", &exec.Error{Name: file, Err: err}
+		}
+		return file, nil
+	}
+
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		path := filepath.Join(dir, file)
+		if findExecutable(filepath.Join(p.RootDirectory, path)) == nil {
+			return path, nil
+		}
+	}
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
+
+// findExecutable checks a file can be executed, as exec.LookPath does
+func findExecutable(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() || fi.Mode()&0111 == 0 {
+		return os.ErrPermission
+	}
+	return nil
+}
+
+// command builds the command for a process, leading its own process group.
+// If the process has settings applied by the shim, it is started by the shim
+// and the status pipe of the shim is returned too.
+func (r *DefaultRunner) command(p *Process, executable string, stdin, stdout, stderr *os.File) (*exec.Cmd, *os.File, error) {
+	cmd := exec.Command(executable, p.Command[1:]...)
+	cmd.Env = append(cmd.Env, p.formattedEnv()...)
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", ProcessNameEnv, p.Name))
+	if p.notify != nil {
+		cmd.Env = append(cmd.Env, p.notify.env(p)...)
+	}
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if p.Sandbox != nil {
+		if err := p.Sandbox.setAttr(cmd.SysProcAttr); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	spec := newExecSpec(p)
+	if spec == nil {
+		return cmd, nil, nil
+	}
+
+	status, err := shimCommand(cmd, spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cmd, status, nil
+}
+
+// start starts a command, tracking it as a child so it isn't mistaken for
+// an orphan. A command started by the shim has started once the shim has
+// exec'd it.
+func (r *DefaultRunner) start(cmd *exec.Cmd, status *os.File) error {
+	forkLock.RLock()
+	err := cmd.Start()
+	if err == nil {
+		trackChild(cmd.Process.Pid)
+	}
+	forkLock.RUnlock()
+
+	if status == nil {
+		return err
+	}
+	if err != nil {
+		closeShim(cmd, status)
+		return err
+	}
+
+	if err := shimStatus(cmd, status); err != nil {
+		cmd.Wait()
+		untrackChild(cmd.Process.Pid)
+		return err
+	}
+	return nil
+}
+
+// Resume captures the output of a process started by a previous agent from
+// the pipes it handed over, and waits for the process to exit.
+func (r *DefaultRunner) Resume(p *Process, h *Handover, outputChan chan *Record, done chan int) (*os.Process, error) {
+	proc, err := os.FindProcess(h.Pid)
+	if err != nil {
+		return nil, err
+	}
+
+	c := newCapture(p, outputChan)
+	for i, fd := range []uintptr{h.Stdout, h.Stderr} {
+		c.streams[i].file = adoptPipe(fd, Stream(i))
+	}
+
+	trackChild(h.Pid)
+	p.setPid(h.Pid)
+	p.capture = c
+	c.start(h.Pid, h.Seq)
+
+	// The process still sends to the socket of the agent it was handed over
+	// from, which had the same pid
+	p.resumeNotify()
+
+	go func() {
+		// The process is a child of this agent, which replaced the previous
+		// one in place, unless the previous agent reaped it while handing
+		// over
+		status := UnknownExitStatus
+		if state, err := proc.Wait(); err == nil {
+			status = waitStatus(state.Sys().(syscall.WaitStatus))
+		}
+		untrackChild(h.Pid)
+
+		done <- r.finish(p, c, status)
+	}()
+
+	return proc, nil
+}
+
+// finish waits for the output of an exited process to be captured
+func (r *DefaultRunner) finish(p *Process, c *capture, status int) int {
+	p.setPid(0)
+	c.wait(pipeDrainTimeout)
+	return status
+}
+
+// exitStatus converts the error from waiting for a process to its exit status
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	switch err.(type) {
+	case *exec.ExitError:
+		return waitStatus(err.(*exec.ExitError).Sys().(syscall.WaitStatus))
+	case *os.PathError:
+		return 127
+	}
+	return 0
+}
+
+// waitStatus converts the status of an exited process to its exit status,
+// which for a process killed by a signal is 128 plus the signal, as in the
+// shell
+func waitStatus(ws syscall.WaitStatus) int {
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ws.ExitStatus()
+}
@@ -0,0 +1,145 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// copyWithLibraries copies an executable and the shared libraries it links
+// into a root directory
+func copyWithLibraries(t *testing.T, root, executable string) {
+	out, err := exec.Command("ldd", executable).Output()
+	if err != nil {
+		t.Skipf("unable to list libraries: %s", err)
+	}
+
+	files := []string{executable}
+	for _, field := range strings.Fields(string(out)) {
+		if strings.HasPrefix(field, "/") {
+			files = append(files, field)
+		}
+	}
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		path := filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := ioutil.WriteFile(path, data, 0755); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+}
+
+// shellRoot returns a root directory with only a shell in it
+func shellRoot(t *testing.T) string {
+	if os.Getuid() != 0 {
+		t.Skip("chroot needs root")
+	}
+
+	root, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	sh, err := filepath.EvalSymlinks("/bin/sh")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	copyWithLibraries(t, root, sh)
+	os.MkdirAll(filepath.Join(root, "bin"), 0755)
+	if _, err := os.Stat(filepath.Join(root, "bin", "sh")); err != nil {
+		os.Symlink(sh, filepath.Join(root, "bin", "sh"))
+	}
+	return root
+}
+
+func TestExec_rootDirectory(t *testing.T) {
+	root := shellRoot(t)
+	defer os.RemoveAll(root)
+	os.Mkdir(filepath.Join(root, "data"), 0777)
+
+	proc := NewProcess("chrooted", "sh", "-c", "echo $PWD; echo > /data/file; cd /data && echo *")
+	proc.RootDirectory = root
+	umask := 0077
+	proc.Umask = &umask
+
+	outChan := make(chan *Record, 10)
+	statusChan := make(chan int, 1)
+
+	runner := &DefaultRunner{}
+	if _, err := runner.Exec(proc, outChan, statusChan); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	select {
+	case <-statusChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Exec timed out")
+	}
+
+	var lines []string
+	for len(outChan) > 0 {
+		lines = append(lines, string((<-outChan).Line))
+	}
+	if strings.Join(lines, ",") != "/,file" {
+		t.Fatalf("unexpected output: %q", lines)
+	}
+
+	fi, err := os.Stat(filepath.Join(root, "data", "file"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("unexpected mode: %s", fi.Mode())
+	}
+
+	// The program must be inside the root directory
+	proc = NewProcess("chrooted", "ls")
+	proc.RootDirectory = root
+	if _, err := runner.Exec(proc, outChan, statusChan); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestExec_rootDirectoryScheduling(t *testing.T) {
+	root := shellRoot(t)
+	defer os.RemoveAll(root)
+
+	// There is no /proc in the root directory to set oom_score_adj through
+	proc := NewProcess("chrooted", "sh", "-c", "while :; do :; done")
+	proc.RootDirectory = root
+	adjust := 300
+	proc.Scheduling = &Scheduling{OOMScoreAdjust: &adjust}
+
+	outChan := make(chan *Record, 10)
+	statusChan := make(chan int, 1)
+
+	runner := &DefaultRunner{}
+	cmd, err := runner.Exec(proc, outChan, statusChan)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer func() {
+		cmd.Kill()
+		<-statusChan
+	}()
+
+	data, err := ioutil.ReadFile(filepath.Join("/proc", strconv.Itoa(cmd.Pid), "oom_score_adj"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if strings.TrimSpace(string(data)) != "300" {
+		t.Fatalf("unexpected oom_score_adj: %s", data)
+	}
+}
@@ -1,6 +1,7 @@
 package process
 
 import (
+	"fmt"
 	"testing"
 	"time"
 )
@@ -8,7 +9,7 @@ import (
 func TestExec(t *testing.T) {
 	proc := NewProcess("echo", "/bin/echo", "-n", "Hello World")
 
-	outChan := make(chan []byte, 1)
+	outChan := make(chan *Record, 1)
 	statusChan := make(chan int, 1)
 
 	runner := &DefaultRunner{}
@@ -16,10 +17,10 @@ func TestExec(t *testing.T) {
 
 	select {
 	case out := <-outChan:
-		if string(out) == "Hello World" {
+		if string(out.Line) == "Hello World" {
 			t.Logf("Received correct output")
 		} else {
-			t.Errorf("Unexpected output: %s", string(out))
+			t.Errorf("Unexpected output: %s", string(out.Line))
 		}
 
 	case <-time.After(1 * time.Second):
@@ -37,3 +38,295 @@ func TestExec(t *testing.T) {
 		t.Error("Exec timed out")
 	}
 }
+
+func TestExec_streams(t *testing.T) {
+	proc := NewProcess("sh", "/bin/sh", "-c", "echo out; echo err >&2; echo again")
+
+	outChan := make(chan *Record, 10)
+	statusChan := make(chan int, 1)
+
+	runner := &DefaultRunner{}
+	if _, err := runner.Exec(proc, outChan, statusChan); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	select {
+	case <-statusChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Exec timed out")
+	}
+
+	if len(outChan) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(outChan))
+	}
+
+	var records []*Record
+	for len(outChan) > 0 {
+		records = append(records, <-outChan)
+	}
+
+	streams := map[string]Stream{}
+	for _, r := range records {
+		streams[string(r.Line)] = r.Stream
+		if r.Process != "sh" || r.Pid == 0 || r.Time.IsZero() {
+			t.Errorf("record missing identity: %#v", r)
+		}
+	}
+	if streams["out"] != Stdout || streams["err"] != Stderr || streams["again"] != Stdout {
+		t.Errorf("unexpected streams: %v", streams)
+	}
+
+	for i := 1; i < len(records); i++ {
+		if records[i].Seq <= records[i-1].Seq {
+			t.Errorf("expected increasing sequence numbers, got %d then %d",
+				records[i-1].Seq, records[i].Seq)
+		}
+	}
+}
+
+func testLineWriter(maxLength int, timeout time.Duration) (*lineWriter, chan *Record) {
+	out := make(chan *Record, 10)
+	f := &framer{name: "test", pid: 1, emit: func(r *Record) { out <- r }}
+	return newLineWriter(f, Stdout, maxLength, timeout), out
+}
+
+func TestLineWriter_framing(t *testing.T) {
+	w, out := testLineWriter(0, 0)
+
+	w.Write([]byte("one\ntw"))
+	w.Write([]byte("o\r\nthr"))
+	w.Write([]byte("ee\n"))
+
+	for _, expected := range []string{"one", "two", "three"} {
+		select {
+		case r := <-out:
+			if string(r.Line) != expected || r.Partial {
+				t.Errorf("expected line %q, got %q (partial=%v)", expected, r.Line, r.Partial)
+			}
+		default:
+			t.Fatalf("missing line %q", expected)
+		}
+	}
+}
+
+func TestLineWriter_maxLength(t *testing.T) {
+	w, out := testLineWriter(4, 0)
+
+	w.Write([]byte("abcdefghij\n"))
+
+	for _, expected := range []string{"abcd", "efgh", "ij"} {
+		r := <-out
+		if string(r.Line) != expected {
+			t.Errorf("expected %q, got %q", expected, r.Line)
+		}
+	}
+}
+
+func TestLineWriter_partialTimeout(t *testing.T) {
+	w, out := testLineWriter(0, 20*time.Millisecond)
+
+	w.Write([]byte("Password: "))
+
+	select {
+	case r := <-out:
+		if string(r.Line) != "Password: " || !r.Partial {
+			t.Errorf("unexpected record: %q (partial=%v)", r.Line, r.Partial)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("partial line was not flushed")
+	}
+}
+
+func TestLineWriter_close(t *testing.T) {
+	w, out := testLineWriter(0, time.Hour)
+
+	w.Write([]byte("no newline"))
+	w.Close()
+
+	select {
+	case r := <-out:
+		if string(r.Line) != "no newline" {
+			t.Errorf("unexpected record: %q", r.Line)
+		}
+	default:
+		t.Fatal("expected remaining output to be flushed on close")
+	}
+}
+
+func testQueue(policy OverflowPolicy, size int) (*outputQueue, *uint64) {
+	var dropped uint64
+	return &outputQueue{
+		out:     make(chan *Record, size),
+		policy:  policy,
+		dropped: &dropped,
+	}, &dropped
+}
+
+func TestOutputQueue_dropNewest(t *testing.T) {
+	q, dropped := testQueue(OverflowDropNewest, 2)
+
+	for i := uint64(1); i <= 3; i++ {
+		q.Push(&Record{Seq: i})
+	}
+
+	if *dropped != 1 {
+		t.Errorf("expected 1 dropped record, got %d", *dropped)
+	}
+	if first := <-q.out; first.Seq != 1 {
+		t.Errorf("expected oldest record to be kept, got %d", first.Seq)
+	}
+}
+
+func TestOutputQueue_dropOldest(t *testing.T) {
+	q, dropped := testQueue(OverflowDropOldest, 2)
+
+	for i := uint64(1); i <= 3; i++ {
+		q.Push(&Record{Seq: i})
+	}
+
+	if *dropped != 1 {
+		t.Errorf("expected 1 dropped record, got %d", *dropped)
+	}
+	if first := <-q.out; first.Seq != 2 {
+		t.Errorf("expected oldest record to be dropped, got %d", first.Seq)
+	}
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	for input, expected := range map[string]OverflowPolicy{
+		"":            OverflowDropOldest,
+		"drop-oldest": OverflowDropOldest,
+		"drop-newest": OverflowDropNewest,
+		"Block":       OverflowBlock,
+	} {
+		actual, err := ParseOverflowPolicy(input)
+		if err != nil || actual != expected {
+			t.Errorf("ParseOverflowPolicy(%q) = %v, %v", input, actual, err)
+		}
+	}
+
+	if _, err := ParseOverflowPolicy("explode"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+func benchmarkOutputQueue(b *testing.B, policy OverflowPolicy) {
+	q, dropped := testQueue(policy, DefaultOutputBufferSize)
+	f := &framer{name: "bench", pid: 1, emit: q.Push}
+	w := newLineWriter(f, Stdout, 0, 0)
+
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-q.out:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	defer close(stop)
+
+	line := []byte("GET /index.html 200 OK in 12ms\n")
+	b.SetBytes(int64(len(line)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.Write(line)
+	}
+	b.ReportMetric(float64(*dropped), "dropped")
+}
+
+func BenchmarkOutputQueue_block(b *testing.B) {
+	benchmarkOutputQueue(b, OverflowBlock)
+}
+
+func BenchmarkOutputQueue_dropOldest(b *testing.B) {
+	benchmarkOutputQueue(b, OverflowDropOldest)
+}
+
+func BenchmarkOutputQueue_dropNewest(b *testing.B) {
+	benchmarkOutputQueue(b, OverflowDropNewest)
+}
+
+// benchmarkExecThroughput measures how quickly output from a child writing as
+// fast as it can makes it through the runner to a consumer.
+func benchmarkExecThroughput(b *testing.B, policy OverflowPolicy) {
+	const size = 4 * 1024 * 1024
+
+	var dropped uint64
+	b.SetBytes(size)
+	for i := 0; i < b.N; i++ {
+		proc := NewProcess("yes", "/bin/sh", "-c", fmt.Sprintf("yes | head -c %d", size))
+		proc.OutputOverflow = policy
+
+		outChan := make(chan *Record, DefaultOutputBufferSize)
+		statusChan := make(chan int, 1)
+
+		runner := &DefaultRunner{}
+		if _, err := runner.Exec(proc, outChan, statusChan); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+
+	consume:
+		for {
+			select {
+			case <-outChan:
+			case <-statusChan:
+				break consume
+			}
+		}
+		dropped += proc.DroppedLines()
+	}
+	b.ReportMetric(float64(dropped)/float64(b.N), "dropped/op")
+}
+
+func BenchmarkExecThroughput_block(b *testing.B) {
+	benchmarkExecThroughput(b, OverflowBlock)
+}
+
+func BenchmarkExecThroughput_dropOldest(b *testing.B) {
+	benchmarkExecThroughput(b, OverflowDropOldest)
+}
+
+func TestExec_signaled(t *testing.T) {
+	proc := NewProcess("sh", "/bin/sh", "-c", "kill -9 $$")
+
+	statusChan := make(chan int, 1)
+	runner := &DefaultRunner{}
+	if _, err := runner.Exec(proc, make(chan *Record, 1), statusChan); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	select {
+	case status := <-statusChan:
+		if status != 137 {
+			t.Errorf("expected exit status 137, got %d", status)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Exec timed out")
+	}
+}
+
+func TestExec_umask(t *testing.T) {
+	proc := NewProcess("sh", "/bin/sh", "-c", "umask")
+	umask := 027
+	proc.Umask = &umask
+
+	outChan := make(chan *Record, 10)
+	statusChan := make(chan int, 1)
+
+	runner := &DefaultRunner{}
+	if _, err := runner.Exec(proc, outChan, statusChan); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	select {
+	case <-statusChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Exec timed out")
+	}
+
+	if line := string((<-outChan).Line); line != "0027" {
+		t.Fatalf("unexpected umask: %s", line)
+	}
+}
@@ -0,0 +1,142 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Handover is the state of a running process passed from one agent to the
+// agent replacing it, so the process can keep running and have its output
+// captured without noticing the agent changed.
+type Handover struct {
+	Pid       int       `json:"pid"`
+	StartedAt time.Time `json:"started_at"`
+
+	// Seq is the sequence number of the last record read from the process
+	Seq uint64 `json:"seq"`
+
+	// Stdout and Stderr are the file descriptors of the read ends of the
+	// process's output pipes. They are left open across exec.
+	Stdout uintptr `json:"stdout_fd"`
+	Stderr uintptr `json:"stderr_fd"`
+}
+
+// Resumer is implemented by runners which can resume capturing a process
+// handed over by a previous agent
+type Resumer interface {
+	Resume(*Process, *Handover, chan *Record, chan int) (*os.Process, error)
+}
+
+// Detach stops capturing output from the running process, without stopping
+// it, so it can be handed over to a new agent. Output written from now on is
+// left in the pipes for the new agent to read. If the process exits before
+// it is resumed, its exit status may be lost.
+func (p *Process) Detach() (*Handover, error) {
+	replyChan := make(chan error)
+	c := &processCommand{Command: COMMAND_DETACH, Reply: replyChan}
+	p.manage <- c
+	if err := <-c.Reply; err != nil {
+		return nil, err
+	}
+	return c.Handover, nil
+}
+
+// Resume takes over a running process handed over by a previous agent
+func (p *Process) Resume(h *Handover) error {
+	replyChan := make(chan error)
+	c := &processCommand{Command: COMMAND_RESUME, Reply: replyChan, Handover: h}
+	p.manage <- c
+	return <-c.Reply
+}
+
+func (p *Process) detach() (*Handover, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.capture == nil || p.PID() == 0 {
+		return nil, fmt.Errorf("process output is not being captured: %s", p.Name)
+	}
+
+	stdout, stderr, seq, err := p.capture.detach()
+	if err != nil {
+		return nil, err
+	}
+	p.detached = p.capture
+
+	// The next agent listens for notifications and expects keepalives again
+	// once it has resumed
+	p.stopKeepalive()
+	if p.notify != nil {
+		p.notify.Close()
+		p.notify = nil
+	}
+
+	return &Handover{
+		Pid:       p.PID(),
+		StartedAt: p.StartedAt,
+		Seq:       seq,
+		Stdout:    stdout,
+		Stderr:    stderr,
+	}, nil
+}
+
+func (p *Process) resume(h *Handover) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.runner == nil {
+		p.runner = &DefaultRunner{}
+	}
+	r, ok := p.runner.(Resumer)
+	if !ok {
+		return fmt.Errorf("runner can't resume processes: %s", p.Name)
+	}
+
+	// A process detached for an upgrade which failed is still this agent's
+	// child, so only its output and notifications are taken back. If it has
+	// exited since, its exit has already been handled.
+	if c := p.detached; c != nil && c.pid == h.Pid {
+		p.detached = nil
+		if !c.reattach(h.Stdout, h.Stderr) {
+			return fmt.Errorf("process exited while it was handed over: %s", p.Name)
+		}
+		p.resumeNotify()
+		p.armKeepalive()
+		return nil
+	}
+
+	if p.PID() != 0 {
+		return fmt.Errorf("process is already running: %s", p.Name)
+	}
+
+	proc, err := r.Resume(p, h, p.outputChan, p.done)
+	if err != nil {
+		return err
+	}
+
+	p.proc = proc
+	p.cgroup = existingCgroup(p)
+	p.stateMu.Lock()
+	p.StartedAt = h.StartedAt
+	p.stateMu.Unlock()
+	p.runs++
+	p.setStatus(ProcessRunning)
+	p.armKeepalive()
+	return nil
+}
+
+// resumeNotify listens for notifications from a resumed process again
+func (p *Process) resumeNotify() {
+	if !p.Notify {
+		return
+	}
+
+	n, err := listenNotify(p)
+	if err != nil {
+		fmt.Printf("Unable to receive notifications from %s: %s\n", p.Name, err)
+		return
+	}
+	p.notify = n
+	go n.serve(p)
+}
@@ -0,0 +1,135 @@
+package process
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProcessDetachResume(t *testing.T) {
+	proc := NewProcess("sh", "/bin/sh", "-c", "echo before; sleep 0.3; echo after")
+	proc.Run()
+	if err := proc.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	select {
+	case r := <-proc.OutputChan():
+		if string(r.Line) != "before" {
+			t.Fatalf("unexpected output: %s", r.Line)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for output")
+	}
+
+	h, err := proc.Detach()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if h.Pid != proc.PID() || h.Seq != 1 {
+		t.Fatalf("unexpected handover: %#v", h)
+	}
+
+	// A new agent takes over the same process
+	resumed := NewProcess("sh", "/bin/sh", "-c", "echo before; sleep 0.3; echo after")
+	resumed.Run()
+	if err := resumed.Resume(h); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if resumed.PID() != h.Pid || !resumed.IsRunning() {
+		t.Fatalf("expected resumed process to be running with pid %d", h.Pid)
+	}
+
+	select {
+	case r := <-resumed.OutputChan():
+		if string(r.Line) != "after" || r.Seq != 2 || r.Pid != h.Pid {
+			t.Fatalf("unexpected record: %#v", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for resumed output")
+	}
+
+	// Both instances wait for the process here, unlike after an exec, so
+	// which of them sees it exit isn't tested
+
+	if len(proc.OutputChan()) != 0 {
+		t.Error("expected no output to reach the detached process")
+	}
+}
+
+func TestProcessDetachResume_sameProcess(t *testing.T) {
+	proc := NewProcess("sh", "/bin/sh", "-c", "echo before; sleep 0.3; echo after")
+	proc.Run()
+	if err := proc.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	<-proc.OutputChan()
+
+	h, err := proc.Detach()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The upgrade failed, so the process is taken back by the same agent
+	if err := proc.Resume(h); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The pipes aren't inherited by processes started from now on
+	for _, fd := range []uintptr{h.Stdout, h.Stderr} {
+		flags, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_GETFD, 0)
+		if errno != 0 || flags&syscall.FD_CLOEXEC == 0 {
+			t.Fatalf("expected fd %d to be closed on exec", fd)
+		}
+	}
+
+	select {
+	case r := <-proc.OutputChan():
+		if string(r.Line) != "after" || r.Seq != 2 || r.Pid != h.Pid {
+			t.Fatalf("unexpected record: %#v", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for resumed output")
+	}
+
+	// Its exit is still seen
+	deadline := time.Now().Add(2 * time.Second)
+	for proc.PID() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected process to exit")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProcessDetachResume_exited(t *testing.T) {
+	proc := NewProcess("sh", "/bin/sh", "-c", "echo before; sleep 0.1")
+	proc.Run()
+	if err := proc.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	<-proc.OutputChan()
+
+	h, err := proc.Detach()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	proc.Wait()
+
+	// Its exit was handled while it was detached, so it isn't taken back
+	if err := proc.Resume(h); err == nil {
+		t.Fatal("expected error resuming an exited process")
+	}
+	if proc.PID() != 0 {
+		t.Fatalf("expected process to stay exited, have pid %d", proc.PID())
+	}
+}
+
+func TestProcessDetach_notRunning(t *testing.T) {
+	proc := NewProcess("sh", "/bin/sh")
+	proc.Run()
+
+	if _, err := proc.Detach(); err == nil {
+		t.Error("expected error detaching a stopped process")
+	}
+}
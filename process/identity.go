@@ -0,0 +1,58 @@
+package process
+
+import (
+	"time"
+)
+
+// Identity identifies a running process more reliably than its pid alone,
+// which the kernel reuses. A process is the same one seen earlier only if
+// its pid, start time and command line all match.
+type Identity struct {
+	Pid int `json:"pid"`
+
+	// StartTime is when the process started, in clock ticks since boot
+	StartTime uint64 `json:"start_time"`
+
+	// Cmdline is the process's command line as the kernel reports it
+	Cmdline []string `json:"cmdline"`
+}
+
+// Matches returns whether both identities are the same process
+func (id *Identity) Matches(other *Identity) bool {
+	if id == nil || other == nil {
+		return false
+	}
+	if id.Pid != other.Pid || id.StartTime != other.StartTime {
+		return false
+	}
+	if len(id.Cmdline) != len(other.Cmdline) {
+		return false
+	}
+	for i := range id.Cmdline {
+		if id.Cmdline[i] != other.Cmdline[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// adoptPollInterval is how often an adopted process is checked for exit.
+// It isn't a child of the agent, so it can't be waited on.
+var adoptPollInterval = time.Second
+
+// watchAdopted polls an adopted process until it exits, then reports an
+// unknown exit status on done
+func watchAdopted(p *Process, id *Identity, done chan int) {
+	for {
+		time.Sleep(adoptPollInterval)
+
+		current, err := Identify(id.Pid)
+		if err == nil && current.Matches(id) && !isZombie(id.Pid) {
+			continue
+		}
+
+		p.setPid(0)
+		done <- UnknownExitStatus
+		return
+	}
+}
@@ -0,0 +1,96 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the kernel's USER_HZ, which is 100 on every architecture Go
+// supports
+const clockTicks = 100
+
+// Identify reads the identity of a running process from /proc
+func Identify(pid int) (*Identity, error) {
+	fields, err := procStat(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	// starttime is the 22nd field of stat, the 20th after the command name
+	startTime, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time for pid %d: %s", pid, err)
+	}
+
+	cmdline, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	id := &Identity{Pid: pid, StartTime: startTime}
+	for _, arg := range bytes.Split(bytes.TrimRight(cmdline, "\x00"), []byte{0}) {
+		id.Cmdline = append(id.Cmdline, string(arg))
+	}
+	return id, nil
+}
+
+// StartedAt returns the wall clock time the process started
+func (id *Identity) StartedAt() time.Time {
+	boot, err := bootTime()
+	if err != nil {
+		return time.Time{}
+	}
+	return boot.Add(time.Duration(id.StartTime) * time.Second / clockTicks)
+}
+
+// procStat returns the fields of /proc/<pid>/stat following the command
+// name, which is parenthesised and may itself contain spaces
+func procStat(pid int) ([]string, error) {
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return nil, fmt.Errorf("invalid stat for pid %d", pid)
+	}
+
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 20 {
+		return nil, fmt.Errorf("invalid stat for pid %d", pid)
+	}
+	return fields, nil
+}
+
+// isZombie returns whether the process has exited but not been reaped
+func isZombie(pid int) bool {
+	fields, err := procStat(pid)
+	return err == nil && fields[0] == "Z"
+}
+
+// bootTime reads when the system booted from /proc/stat
+func bootTime() (time.Time, error) {
+	data, err := ioutil.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "btime ") {
+			secs, err := strconv.ParseInt(strings.TrimSpace(line[6:]), 10, 64)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return time.Unix(secs, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("boot time not found in /proc/stat")
+}
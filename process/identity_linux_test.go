@@ -0,0 +1,79 @@
+package process
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestIdentify(t *testing.T) {
+	id, err := Identify(os.Getpid())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if id.StartTime == 0 {
+		t.Error("expected a start time")
+	}
+	if len(id.Cmdline) != len(os.Args) || id.Cmdline[0] != os.Args[0] {
+		t.Errorf("expected cmdline %v, got %v", os.Args, id.Cmdline)
+	}
+	if since := time.Since(id.StartedAt()); since < 0 || since > time.Hour {
+		t.Errorf("unexpected start time: %s", id.StartedAt())
+	}
+
+	if !id.Matches(&Identity{Pid: id.Pid, StartTime: id.StartTime, Cmdline: id.Cmdline}) {
+		t.Error("expected identity to match itself")
+	}
+	if id.Matches(&Identity{Pid: id.Pid, StartTime: id.StartTime + 1, Cmdline: id.Cmdline}) {
+		t.Error("expected a reused pid not to match")
+	}
+
+	if _, err := Identify(0); err == nil {
+		t.Error("expected error identifying missing process")
+	}
+}
+
+func TestProcessAdopt(t *testing.T) {
+	defer func(interval time.Duration) {
+		adoptPollInterval = interval
+	}(adoptPollInterval)
+	adoptPollInterval = 10 * time.Millisecond
+
+	// Stand in for a process left running by a previous agent
+	cmd := exec.Command("/bin/sleep", "5")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	id, err := Identify(cmd.Process.Pid)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	proc := NewProcess("sleeper", "/bin/sleep", "5")
+	proc.Run()
+	if err := proc.Adopt(id); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if proc.PID() != cmd.Process.Pid || !proc.IsRunning() || !proc.Adopted() {
+		t.Fatalf("expected adopted process to be running with pid %d", cmd.Process.Pid)
+	}
+	if err := proc.Adopt(id); err == nil {
+		t.Error("expected error adopting a running process")
+	}
+
+	cmd.Process.Kill()
+	go cmd.Wait()
+
+	select {
+	case <-proc.waitChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for adopted process to exit")
+	}
+
+	if proc.PID() != 0 || proc.LastExitStatus != UnknownExitStatus || proc.Adopted() {
+		t.Errorf("expected process to have exited, pid %d status %d", proc.PID(), proc.LastExitStatus)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"fmt"
+	"time"
+)
+
+// Identify is only supported on Linux, where /proc is available
+func Identify(pid int) (*Identity, error) {
+	return nil, fmt.Errorf("process identity is not supported on this platform")
+}
+
+// StartedAt is unknown on platforms without /proc
+func (id *Identity) StartedAt() time.Time {
+	return time.Time{}
+}
+
+func isZombie(pid int) bool {
+	return false
+}
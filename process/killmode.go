@@ -0,0 +1,104 @@
+package process
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// KillMode controls which processes are signalled when a process is
+// stopped, mirroring systemd's KillMode
+type KillMode int
+
+const (
+	// KillModeGroup signals the process group the process leads, which
+	// includes any children it started unless they moved to their own group
+	KillModeGroup KillMode = iota
+
+	// KillModeMain signals only the main process
+	KillModeMain
+
+	// KillModeCgroup signals every process in the process's cgroup, which
+	// nothing it starts can leave. It needs cgroup v2, and falls back to
+	// KillModeGroup without it.
+	KillModeCgroup
+)
+
+func (m KillMode) String() string {
+	switch m {
+	case KillModeGroup:
+		return "group"
+	case KillModeMain:
+		return "main"
+	case KillModeCgroup:
+		return "cgroup"
+	}
+	return "unknown"
+}
+
+// ParseKillMode parses the name of a kill mode
+func ParseKillMode(s string) (KillMode, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "group", "process-group", "process_group":
+		return KillModeGroup, nil
+	case "main":
+		return KillModeMain, nil
+	case "cgroup", "control-group", "control_group":
+		return KillModeCgroup, nil
+	}
+	return KillModeGroup, fmt.Errorf("unknown kill mode: %s", s)
+}
+
+// signalTree sends a signal to the instance of the process with the given
+// pid, and whatever else the kill mode includes. Every process is started
+// leading its own process group, but one started by an older agent may not
+// be, so the main process is signalled if the group doesn't exist.
+func (p *Process) signalTree(pid int, sig syscall.Signal) error {
+	// The shim is init of a pid namespace, and signals what is in it
+	if p.Sandbox.pidNamespace() {
+		return syscall.Kill(pid, sig)
+	}
+
+	switch p.KillMode {
+	case KillModeCgroup:
+		if p.cgroup != nil {
+			return p.cgroup.signal(sig)
+		}
+		fallthrough
+	case KillModeGroup:
+		err := syscall.Kill(-pid, sig)
+		if err != syscall.ESRCH {
+			return err
+		}
+	}
+	return syscall.Kill(pid, sig)
+}
+
+// treeAlive reports whether anything the kill mode includes is still
+// running after the main process with the given pid exited
+func (p *Process) treeAlive(pid int) bool {
+	switch p.KillMode {
+	case KillModeCgroup:
+		if p.cgroup != nil {
+			return p.cgroup.populated()
+		}
+		fallthrough
+	case KillModeGroup:
+		return syscall.Kill(-pid, 0) == nil
+	}
+	return false
+}
+
+// existingCgroup returns the cgroup a process taken over from a previous
+// agent is running in, if any
+func existingCgroup(p *Process) *cgroup {
+	if p.KillMode != KillModeCgroup && p.CgroupLimits == nil {
+		return nil
+	}
+
+	cg, err := processCgroup(p.Name)
+	if err != nil || !cg.populated() {
+		return nil
+	}
+	return cg
+}
@@ -0,0 +1,74 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseKillMode(t *testing.T) {
+	cases := map[string]KillMode{
+		"":              KillModeGroup,
+		"group":         KillModeGroup,
+		"main":          KillModeMain,
+		"control-group": KillModeCgroup,
+		"CGROUP":        KillModeCgroup,
+	}
+	for s, expected := range cases {
+		if mode, err := ParseKillMode(s); err != nil || mode != expected {
+			t.Errorf("%q: expected %s, got %s (%v)", s, expected, mode, err)
+		}
+	}
+
+	if _, err := ParseKillMode("everything"); err == nil {
+		t.Error("expected error for unknown kill mode")
+	}
+}
+
+func TestProcessStop_killMode(t *testing.T) {
+	for _, mode := range []KillMode{KillModeGroup, KillModeMain} {
+		dir, err := ioutil.TempDir("", "watchdog")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		defer os.RemoveAll(dir)
+		pidFile := filepath.Join(dir, "pid")
+
+		proc := NewProcess("wrapper", "/bin/sh", "-c", "sleep 5 >/dev/null & echo $! > "+pidFile+"; wait")
+		proc.KillMode = mode
+		// Background jobs of a non-interactive shell ignore SIGQUIT
+		proc.KillSignal = syscall.SIGTERM
+		proc.Run()
+		if err := proc.Start(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		var child int
+		for i := 0; i < 100 && child == 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+			data, _ := ioutil.ReadFile(pidFile)
+			child, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		}
+		if child == 0 {
+			t.Fatalf("%s: child never started", mode)
+		}
+		defer syscall.Kill(child, syscall.SIGKILL)
+
+		proc.Stop()
+
+		// Only the group mode reaches the wrapper's child
+		killed := false
+		for i := 0; i < 50 && !killed; i++ {
+			time.Sleep(10 * time.Millisecond)
+			killed = syscall.Kill(child, 0) == syscall.ESRCH || isZombie(child)
+		}
+		if killed != (mode == KillModeGroup) {
+			t.Errorf("%s: expected child killed=%v", mode, mode == KillModeGroup)
+		}
+	}
+}
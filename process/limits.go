@@ -0,0 +1,196 @@
+package process
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Unlimited is the value of a resource limit which doesn't limit anything
+const Unlimited = ^uint64(0)
+
+// Limit is a resource limit applied to a process before it runs, as with
+// setrlimit(2). CPU time is in seconds and sizes are in bytes.
+type Limit struct {
+	Resource string `json:"resource"`
+	Soft     uint64 `json:"soft"`
+	Hard     uint64 `json:"hard"`
+}
+
+func (l Limit) String() string {
+	if l.Soft == l.Hard {
+		return fmt.Sprintf("%s=%s", l.Resource, FormatLimitValue(l.Soft))
+	}
+	return fmt.Sprintf("%s=%s:%s", l.Resource, FormatLimitValue(l.Soft), FormatLimitValue(l.Hard))
+}
+
+// FormatLimitValue formats the soft or hard value of a limit
+func FormatLimitValue(v uint64) string {
+	if v == Unlimited {
+		return "unlimited"
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// sizeLimits are the resources limited in bytes, whose values may have a
+// K, M, G or T suffix
+var sizeLimits = map[string]bool{
+	"as":      true,
+	"core":    true,
+	"memlock": true,
+	"stack":   true,
+}
+
+// ParseLimits parses the limits section of a process config. Each key is a
+// resource and its value either a number, a string holding a number,
+// "unlimited" or "soft:hard", or a map with soft and hard keys.
+func ParseLimits(config map[string]interface{}) ([]Limit, error) {
+	var limits []Limit
+	for resource, value := range config {
+		resource = strings.ToLower(resource)
+		if _, ok := rlimitResources[resource]; !ok {
+			return nil, fmt.Errorf("unknown limit: %s", resource)
+		}
+
+		limit, err := parseLimit(resource, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s limit: %s", resource, err)
+		}
+		if limit.Soft > limit.Hard {
+			return nil, fmt.Errorf("invalid %s limit: soft limit is above hard limit", resource)
+		}
+		limits = append(limits, limit)
+	}
+
+	sort.Slice(limits, func(i, j int) bool {
+		return limits[i].Resource < limits[j].Resource
+	})
+	return limits, nil
+}
+
+func parseLimit(resource string, value interface{}) (Limit, error) {
+	limit := Limit{Resource: resource}
+
+	switch v := value.(type) {
+	case string:
+		soft, hard := v, v
+		if i := strings.Index(v, ":"); i >= 0 {
+			soft, hard = v[:i], v[i+1:]
+		}
+
+		var err error
+		if limit.Soft, err = parseLimitValue(resource, soft); err != nil {
+			return limit, err
+		}
+		if limit.Hard, err = parseLimitValue(resource, hard); err != nil {
+			return limit, err
+		}
+
+	case map[string]interface{}:
+		for _, key := range []string{"soft", "hard"} {
+			if _, ok := v[key]; !ok {
+				return limit, fmt.Errorf("%s is required", key)
+			}
+		}
+		for key := range v {
+			if key != "soft" && key != "hard" {
+				return limit, fmt.Errorf("unknown key %s", key)
+			}
+		}
+
+		soft, err := parseLimit(resource, v["soft"])
+		if err != nil {
+			return limit, err
+		}
+		hard, err := parseLimit(resource, v["hard"])
+		if err != nil {
+			return limit, err
+		}
+		limit.Soft, limit.Hard = soft.Soft, hard.Hard
+
+	default:
+		n, err := limitNumber(value)
+		if err != nil {
+			return limit, err
+		}
+		limit.Soft, limit.Hard = n, n
+	}
+
+	return limit, nil
+}
+
+// limitNumber converts a number decoded from JSON or TOML to a limit value
+func limitNumber(value interface{}) (uint64, error) {
+	switch n := value.(type) {
+	case int:
+		if n >= 0 {
+			return uint64(n), nil
+		}
+	case int64:
+		if n >= 0 {
+			return uint64(n), nil
+		}
+	case uint64:
+		return n, nil
+	case float64:
+		if n >= 0 && n == float64(uint64(n)) {
+			return uint64(n), nil
+		}
+	default:
+		return 0, fmt.Errorf("unexpected value %v", value)
+	}
+	return 0, fmt.Errorf("%v is not a positive whole number", value)
+}
+
+func parseLimitValue(resource, s string) (uint64, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "unlimited" || s == "infinity" || s == "max" {
+		return Unlimited, nil
+	}
+
+	multiplier := uint64(1)
+	if sizeLimits[resource] && s != "" {
+		switch s[len(s)-1] {
+		case 'k':
+			multiplier = 1 << 10
+		case 'm':
+			multiplier = 1 << 20
+		case 'g':
+			multiplier = 1 << 30
+		case 't':
+			multiplier = 1 << 40
+		}
+		if multiplier > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number or unlimited", s)
+	}
+	if n > Unlimited/multiplier {
+		return 0, fmt.Errorf("%q is too large", s)
+	}
+	return n * multiplier, nil
+}
+
+// setLimits applies resource limits to the calling process
+func setLimits(limits []Limit) error {
+	for _, l := range limits {
+		rlimit := syscall.Rlimit{Cur: rlimitValue(l.Soft), Max: rlimitValue(l.Hard)}
+		if err := syscall.Setrlimit(rlimitResources[l.Resource], &rlimit); err != nil {
+			return fmt.Errorf("unable to set %s limit: %s", l.Resource, err)
+		}
+	}
+	return nil
+}
+
+func rlimitValue(v uint64) uint64 {
+	if v == Unlimited || v > rlimInfinity {
+		return rlimInfinity
+	}
+	return v
+}
@@ -0,0 +1,23 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"syscall"
+)
+
+// rlimitResources maps the resources a process can be limited in to their
+// setrlimit(2) resource. The syscall package lacks those which differ by
+// architecture.
+var rlimitResources = map[string]int{
+	"as":      syscall.RLIMIT_AS,
+	"core":    syscall.RLIMIT_CORE,
+	"cpu":     syscall.RLIMIT_CPU,
+	"memlock": rlimitMemlock,
+	"nofile":  syscall.RLIMIT_NOFILE,
+	"nproc":   rlimitNproc,
+	"stack":   syscall.RLIMIT_STACK,
+}
+
+const rlimInfinity = ^uint64(0)
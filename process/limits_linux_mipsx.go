@@ -0,0 +1,10 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le)
+// +build linux
+// +build mips mipsle mips64 mips64le
+
+package process
+
+const (
+	rlimitMemlock = 9
+	rlimitNproc   = 8
+)
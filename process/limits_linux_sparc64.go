@@ -0,0 +1,9 @@
+//go:build linux && sparc64
+// +build linux,sparc64
+
+package process
+
+const (
+	rlimitMemlock = 8
+	rlimitNproc   = 7
+)
@@ -0,0 +1,22 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"syscall"
+)
+
+// rlimitResources maps the resources a process can be limited in to their
+// setrlimit(2) resource, numbered as on the BSDs
+var rlimitResources = map[string]int{
+	"as":      syscall.RLIMIT_AS,
+	"core":    syscall.RLIMIT_CORE,
+	"cpu":     syscall.RLIMIT_CPU,
+	"memlock": 6,
+	"nofile":  syscall.RLIMIT_NOFILE,
+	"nproc":   7,
+	"stack":   syscall.RLIMIT_STACK,
+}
+
+const rlimInfinity = uint64(1<<63 - 1)
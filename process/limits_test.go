@@ -0,0 +1,89 @@
+package process
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits(map[string]interface{}{
+		"nofile":  "1024:4096",
+		"core":    float64(0),
+		"stack":   "8M",
+		"as":      "unlimited",
+		"cpu":     int64(60),
+		"memlock": map[string]interface{}{"soft": "64k", "hard": "unlimited"},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []Limit{
+		{"as", Unlimited, Unlimited},
+		{"core", 0, 0},
+		{"cpu", 60, 60},
+		{"memlock", 64 << 10, Unlimited},
+		{"nofile", 1024, 4096},
+		{"stack", 8 << 20, 8 << 20},
+	}
+	if !reflect.DeepEqual(limits, expected) {
+		t.Fatalf("bad: %v", limits)
+	}
+
+	invalid := []map[string]interface{}{
+		{"files": 10},
+		{"nofile": "4096:1024"},
+		{"nofile": "lots"},
+		{"nofile": "10k"},
+		{"core": float64(-1)},
+		{"core": map[string]interface{}{"soft": 0}},
+	}
+	for _, config := range invalid {
+		if _, err := ParseLimits(config); err == nil {
+			t.Errorf("expected error parsing %v", config)
+		}
+	}
+}
+
+func TestExec_limits(t *testing.T) {
+	proc := NewProcess("sh", "/bin/sh", "-c", "ulimit -n; ulimit -c; echo $WATCHDOG_EXEC_SPEC")
+	proc.Limits = []Limit{
+		{"core", 0, 0},
+		{"nofile", 64, 128},
+	}
+
+	outChan := make(chan *Record, 10)
+	statusChan := make(chan int, 1)
+
+	runner := &DefaultRunner{}
+	if _, err := runner.Exec(proc, outChan, statusChan); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	select {
+	case <-statusChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Exec timed out")
+	}
+
+	var lines []string
+	for len(outChan) > 0 {
+		lines = append(lines, string((<-outChan).Line))
+	}
+	if strings.Join(lines, ",") != "64,0," {
+		t.Fatalf("unexpected output: %q", lines)
+	}
+}
+
+func TestExec_limitsFailed(t *testing.T) {
+	proc := NewProcess("sh", "/bin/sh", "-c", "true")
+	proc.Limits = []Limit{{"nofile", Unlimited, Unlimited}}
+
+	runner := &DefaultRunner{}
+	_, err := runner.Exec(proc, make(chan *Record, 10), make(chan int, 1))
+	if err == nil || !strings.Contains(err.Error(), "nofile") {
+		t.Fatalf("expected error setting limit, got %v", err)
+	}
+}
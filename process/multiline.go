@@ -0,0 +1,178 @@
+package process
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMultilineMaxLines caps the number of lines grouped into one record
+	DefaultMultilineMaxLines = 500
+
+	// DefaultMultilineTimeout is how long a group waits for more lines
+	DefaultMultilineTimeout = 500 * time.Millisecond
+)
+
+// MultilineConfig is the configuration file representation of a
+// MultilineRule.
+type MultilineConfig struct {
+	// StartPattern matches the first line of a group. Lines which don't
+	// match it are appended to the current group.
+	StartPattern string `mapstructure:"start_pattern"`
+
+	// ContinuationPattern matches lines which belong to the current group,
+	// such as the "at ..." lines of a Java or Node stack trace.
+	ContinuationPattern string `mapstructure:"continuation_pattern"`
+
+	// Indent appends any line starting with whitespace to the current group.
+	Indent bool `mapstructure:"indent"`
+
+	// MaxLines is the most lines grouped into one record. The default is 500.
+	MaxLines int `mapstructure:"max_lines"`
+
+	// Timeout is how long to wait for another line before sending a group.
+	// The default is 500ms.
+	Timeout string `mapstructure:"timeout"`
+}
+
+// MultilineRule decides which lines of output are grouped together into a
+// single record, so a stack trace arrives at an outlet as one entry instead
+// of dozens.
+type MultilineRule struct {
+	Start        *regexp.Regexp
+	Continuation *regexp.Regexp
+	Indent       bool
+	MaxLines     int
+	Timeout      time.Duration
+}
+
+// NewMultilineRule compiles a MultilineRule from its configuration
+func NewMultilineRule(conf *MultilineConfig) (*MultilineRule, error) {
+	rule := &MultilineRule{
+		Indent:   conf.Indent,
+		MaxLines: conf.MaxLines,
+		Timeout:  DefaultMultilineTimeout,
+	}
+
+	var err error
+	if conf.StartPattern != "" {
+		if rule.Start, err = regexp.Compile(conf.StartPattern); err != nil {
+			return nil, fmt.Errorf("invalid multiline start_pattern: %s", err)
+		}
+	}
+	if conf.ContinuationPattern != "" {
+		if rule.Continuation, err = regexp.Compile(conf.ContinuationPattern); err != nil {
+			return nil, fmt.Errorf("invalid multiline continuation_pattern: %s", err)
+		}
+	}
+
+	if rule.Start == nil && rule.Continuation == nil && !rule.Indent {
+		return nil, fmt.Errorf("multiline requires start_pattern, continuation_pattern or indent")
+	}
+
+	if conf.Timeout != "" {
+		if rule.Timeout, err = time.ParseDuration(conf.Timeout); err != nil || rule.Timeout <= 0 {
+			return nil, fmt.Errorf("invalid multiline timeout: %s", conf.Timeout)
+		}
+	}
+	if rule.MaxLines <= 0 {
+		rule.MaxLines = DefaultMultilineMaxLines
+	}
+
+	return rule, nil
+}
+
+// Continues returns whether line belongs to the group before it
+func (m *MultilineRule) Continues(line []byte) bool {
+	if m.Continuation != nil && m.Continuation.Match(line) {
+		return true
+	}
+	if m.Indent && len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+		return true
+	}
+	if m.Start != nil && !m.Start.Match(line) {
+		return true
+	}
+	return false
+}
+
+// multilineGroup is a record being assembled from several lines
+type multilineGroup struct {
+	record *Record
+	lines  int
+	timer  *time.Timer
+}
+
+// multilineGrouper sits between line framing and the output buffer, joining
+// lines into a single record according to a MultilineRule. Each stream is
+// grouped separately.
+type multilineGrouper struct {
+	sync.Mutex
+	rule    *MultilineRule
+	emit    func(*Record)
+	pending map[Stream]*multilineGroup
+}
+
+func newMultilineGrouper(rule *MultilineRule, emit func(*Record)) *multilineGrouper {
+	return &multilineGrouper{
+		rule:    rule,
+		emit:    emit,
+		pending: make(map[Stream]*multilineGroup),
+	}
+}
+
+// Push adds a record to the group for its stream, sending the previous group
+// on if this record starts a new one.
+func (g *multilineGrouper) Push(r *Record) {
+	g.Lock()
+	defer g.Unlock()
+
+	group, ok := g.pending[r.Stream]
+	if ok && g.rule.Continues(r.Line) && group.lines < g.rule.MaxLines {
+		group.record.Line = append(append(group.record.Line, '\n'), r.Line...)
+		group.lines++
+		group.timer.Reset(g.rule.Timeout)
+		return
+	}
+
+	if ok {
+		g.send(r.Stream)
+	}
+
+	stream := r.Stream
+	group = &multilineGroup{record: r, lines: 1}
+	group.timer = time.AfterFunc(g.rule.Timeout, func() {
+		g.Lock()
+		defer g.Unlock()
+
+		// Another line may have started a new group while we were waiting
+		if g.pending[stream] == group {
+			g.send(stream)
+		}
+	})
+	g.pending[stream] = group
+}
+
+// send emits the pending group for a stream, if any
+func (g *multilineGrouper) send(stream Stream) {
+	group, ok := g.pending[stream]
+	if !ok {
+		return
+	}
+	delete(g.pending, stream)
+
+	group.timer.Stop()
+	g.emit(group.record)
+}
+
+// Flush sends every pending group
+func (g *multilineGrouper) Flush() {
+	g.Lock()
+	defer g.Unlock()
+
+	for _, stream := range []Stream{Stdout, Stderr} {
+		g.send(stream)
+	}
+}
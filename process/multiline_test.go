@@ -0,0 +1,141 @@
+package process
+
+import (
+	"testing"
+	"time"
+)
+
+var javaTrace = []string{
+	"Starting server",
+	"Exception in thread \"main\" java.lang.NullPointerException",
+	"\tat com.example.App.handle(App.java:42)",
+	"\tat com.example.App.main(App.java:10)",
+	"Caused by: java.io.IOException",
+	"\t... 2 more",
+	"Server stopped",
+}
+
+func testGrouper(t *testing.T, conf *MultilineConfig) (*multilineGrouper, chan *Record) {
+	rule, err := NewMultilineRule(conf)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	out := make(chan *Record, 20)
+	return newMultilineGrouper(rule, func(r *Record) { out <- r }), out
+}
+
+func pushLines(g *multilineGrouper, stream Stream, lines []string) {
+	for i, line := range lines {
+		g.Push(&Record{Stream: stream, Seq: uint64(i + 1), Line: []byte(line)})
+	}
+}
+
+func expectGroups(t *testing.T, out chan *Record, expected []string) {
+	for _, e := range expected {
+		select {
+		case r := <-out:
+			if string(r.Line) != e {
+				t.Errorf("expected %q, got %q", e, r.Line)
+			}
+		default:
+			t.Fatalf("missing group %q", e)
+		}
+	}
+	if len(out) != 0 {
+		t.Errorf("unexpected extra groups: %d", len(out))
+	}
+}
+
+func TestMultiline_indent(t *testing.T) {
+	g, out := testGrouper(t, &MultilineConfig{
+		Indent:              true,
+		ContinuationPattern: `^Caused by:`,
+		Timeout:             "1h",
+	})
+
+	pushLines(g, Stdout, javaTrace)
+	g.Flush()
+
+	expectGroups(t, out, []string{
+		"Starting server",
+		"Exception in thread \"main\" java.lang.NullPointerException\n" +
+			"\tat com.example.App.handle(App.java:42)\n" +
+			"\tat com.example.App.main(App.java:10)\n" +
+			"Caused by: java.io.IOException\n" +
+			"\t... 2 more",
+		"Server stopped",
+	})
+}
+
+func TestMultiline_startPattern(t *testing.T) {
+	g, out := testGrouper(t, &MultilineConfig{
+		StartPattern: `^\d{4}-\d{2}-\d{2}`,
+		Timeout:      "1h",
+	})
+
+	pushLines(g, Stdout, []string{
+		"2014-01-01 first",
+		"continued",
+		"2014-01-02 second",
+	})
+	g.Flush()
+
+	expectGroups(t, out, []string{"2014-01-01 first\ncontinued", "2014-01-02 second"})
+}
+
+func TestMultiline_keepsFirstRecordIdentity(t *testing.T) {
+	g, out := testGrouper(t, &MultilineConfig{Indent: true, Timeout: "1h"})
+
+	pushLines(g, Stderr, []string{"Error", "  at foo"})
+	g.Flush()
+
+	r := <-out
+	if r.Seq != 1 || r.Stream != Stderr {
+		t.Errorf("expected group to keep the first record's identity, got %#v", r)
+	}
+}
+
+func TestMultiline_streamsSeparate(t *testing.T) {
+	g, out := testGrouper(t, &MultilineConfig{Indent: true, Timeout: "1h"})
+
+	g.Push(&Record{Stream: Stderr, Line: []byte("Error")})
+	g.Push(&Record{Stream: Stdout, Line: []byte("  indented stdout")})
+	g.Push(&Record{Stream: Stderr, Line: []byte("  at foo")})
+	g.Flush()
+
+	expectGroups(t, out, []string{"  indented stdout", "Error\n  at foo"})
+}
+
+func TestMultiline_maxLines(t *testing.T) {
+	g, out := testGrouper(t, &MultilineConfig{Indent: true, MaxLines: 2, Timeout: "1h"})
+
+	pushLines(g, Stdout, []string{"Error", " one", " two"})
+	g.Flush()
+
+	expectGroups(t, out, []string{"Error\n one", " two"})
+}
+
+func TestMultiline_timeout(t *testing.T) {
+	g, out := testGrouper(t, &MultilineConfig{Indent: true, Timeout: "20ms"})
+
+	pushLines(g, Stdout, []string{"Error", " at foo"})
+
+	select {
+	case r := <-out:
+		if string(r.Line) != "Error\n at foo" {
+			t.Errorf("unexpected group: %q", r.Line)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("group was not sent after timeout")
+	}
+}
+
+func TestNewMultilineRule_invalid(t *testing.T) {
+	if _, err := NewMultilineRule(&MultilineConfig{}); err == nil {
+		t.Error("expected error for a rule which never groups")
+	}
+	if _, err := NewMultilineRule(&MultilineConfig{StartPattern: "("}); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+}
@@ -0,0 +1,246 @@
+package process
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Processes which speak systemd's notify protocol send the agent datagrams
+// of newline separated assignments, such as "READY=1", on the socket named by
+// NOTIFY_SOCKET in their environment. Only those from the process, its
+// process group or the main pid it reports are accepted. The main pid is
+// only informational: the process started is still the one supervised and
+// signalled, so a daemon which forks and lets it exit is taken to have
+// stopped.
+
+// notifySocketEnv names the socket a process sends notifications to
+const notifySocketEnv = "NOTIFY_SOCKET"
+
+// watchdogUsecEnv is the interval in microseconds a process must send
+// WATCHDOG=1 within
+const watchdogUsecEnv = "WATCHDOG_USEC"
+
+// keepaliveSignal is sent to a process which misses its keepalive, as with
+// systemd, so it dumps core
+const keepaliveSignal = syscall.SIGABRT
+
+// notifySocket receives the notifications of a running instance of a
+// process
+type notifySocket struct {
+	// addr is the value of NOTIFY_SOCKET
+	addr string
+
+	// ready is closed once the process sends READY=1
+	ready     chan struct{}
+	readyOnce sync.Once
+
+	conn notifyConn
+}
+
+// env returns the environment telling a process where to send notifications
+func (n *notifySocket) env(p *Process) []string {
+	env := []string{fmt.Sprintf("%s=%s", notifySocketEnv, n.addr)}
+	if p.WatchdogInterval > 0 {
+		env = append(env, fmt.Sprintf("%s=%d", watchdogUsecEnv, p.WatchdogInterval/time.Microsecond))
+	}
+	return env
+}
+
+func (n *notifySocket) setReady() {
+	n.readyOnce.Do(func() { close(n.ready) })
+}
+
+// serve handles the notifications sent to the socket until it is closed
+func (n *notifySocket) serve(p *Process) {
+	for {
+		msg, pid, err := n.conn.receive()
+		if err != nil {
+			return
+		}
+		if !p.acceptsNotify(pid) {
+			fmt.Printf("Ignoring notification for %s from pid %d\n", p.Name, pid)
+			continue
+		}
+		p.notified(n, msg)
+	}
+}
+
+func (n *notifySocket) Close() error {
+	return n.conn.Close()
+}
+
+// acceptsNotify reports whether a notification from pid is from the process
+func (p *Process) acceptsNotify(pid int) bool {
+	main := p.PID()
+	if pid <= 0 || main == 0 {
+		return false
+	}
+	if pid == main || pid == p.MainPID() {
+		return true
+	}
+	pgid, err := syscall.Getpgid(pid)
+	return err == nil && pgid == main
+}
+
+// notified acts on a notification from the process
+func (p *Process) notified(n *notifySocket, msg string) {
+	for _, line := range strings.Split(msg, "\n") {
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+		key, value := line[:i], line[i+1:]
+
+		switch key {
+		case "READY":
+			if value == "1" {
+				n.setReady()
+				p.changeStatus(ProcessRunning, ProcessReloading)
+			}
+
+		case "RELOADING":
+			if value == "1" {
+				p.changeStatus(ProcessReloading, ProcessRunning)
+			}
+
+		case "STOPPING":
+			if value == "1" {
+				p.stopKeepalive()
+				p.changeStatus(ProcessStopping, ProcessRunning, ProcessReloading)
+			}
+
+		case "STATUS":
+			p.notifyMu.Lock()
+			p.statusText = value
+			p.notifyMu.Unlock()
+
+		case "MAINPID":
+			if pid, err := strconv.Atoi(value); err == nil && pid > 0 {
+				p.notifyMu.Lock()
+				p.mainPid = pid
+				p.notifyMu.Unlock()
+
+				if own := p.PID(); pid != own {
+					fmt.Printf("Process %s reported main pid %d, but pid %d is still supervised\n", p.Name, pid, own)
+				}
+			}
+
+		case "WATCHDOG":
+			switch value {
+			case "1":
+				p.resetKeepalive()
+			case "trigger":
+				p.keepaliveExpired(p.PID())
+			}
+		}
+	}
+}
+
+// changeStatus moves the process to state if it is in one of the given
+// states
+func (p *Process) changeStatus(state ProcessState, from ...ProcessState) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	for _, s := range from {
+		if p.state == s {
+			p.state = state
+			return
+		}
+	}
+}
+
+// StatusText returns the status the process last sent with STATUS=
+func (p *Process) StatusText() string {
+	p.notifyMu.Lock()
+	defer p.notifyMu.Unlock()
+	return p.statusText
+}
+
+// MainPID returns the main pid the process last sent with MAINPID=, or its
+// own pid if it hasn't sent one. It is only shown in the process's status.
+func (p *Process) MainPID() int {
+	p.notifyMu.Lock()
+	mainPid := p.mainPid
+	p.notifyMu.Unlock()
+
+	if mainPid == 0 {
+		return p.PID()
+	}
+	return mainPid
+}
+
+// KeepaliveMissed returns a channel which is sent to when the process misses
+// its watchdog keepalive, after it has been sent keepaliveSignal
+func (p *Process) KeepaliveMissed() <-chan struct{} {
+	return p.keepaliveMissed
+}
+
+// armKeepalive starts expecting keepalives from the running process, if it
+// has a watchdog interval
+func (p *Process) armKeepalive() {
+	if p.WatchdogInterval <= 0 || p.notify == nil {
+		return
+	}
+
+	p.notifyMu.Lock()
+	defer p.notifyMu.Unlock()
+
+	if p.keepalive != nil {
+		p.keepalive.Stop()
+	}
+	pid := p.PID()
+	p.keepalive = time.AfterFunc(p.WatchdogInterval, func() {
+		p.keepaliveExpired(pid)
+	})
+}
+
+// resetKeepalive restarts the keepalive interval, if it is armed
+func (p *Process) resetKeepalive() {
+	p.notifyMu.Lock()
+	defer p.notifyMu.Unlock()
+
+	if p.keepalive != nil {
+		p.keepalive.Reset(p.WatchdogInterval)
+	}
+}
+
+// stopKeepalive stops expecting keepalives, reporting whether they were
+func (p *Process) stopKeepalive() bool {
+	p.notifyMu.Lock()
+	defer p.notifyMu.Unlock()
+
+	if p.keepalive == nil {
+		return false
+	}
+	p.keepalive.Stop()
+	p.keepalive = nil
+	return true
+}
+
+// keepaliveExpired signals the instance of the process with pid, if it is
+// still running, for missing its keepalive
+func (p *Process) keepaliveExpired(pid int) {
+	p.notifyMu.Lock()
+	armed := p.keepalive != nil
+	p.keepalive = nil
+	p.notifyMu.Unlock()
+
+	if !armed || pid == 0 || p.PID() != pid {
+		return
+	}
+
+	fmt.Println("Process missed its watchdog keepalive:", p.Name)
+	if err := syscall.Kill(pid, keepaliveSignal); err != nil {
+		fmt.Println("Unable to signal process:", err)
+	}
+
+	select {
+	case p.keepaliveMissed <- struct{}{}:
+	default:
+	}
+}
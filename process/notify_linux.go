@@ -0,0 +1,67 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// notifyConn is the datagram socket notifications are received on
+type notifyConn struct {
+	*net.UnixConn
+}
+
+// listenNotify creates the notify socket of a process. It is in the abstract
+// namespace, so it is reachable from a chroot or private /tmp, and named
+// after the agent's pid, which an upgraded agent keeps, so it can be created
+// again for processes it resumes.
+func listenNotify(p *Process) (*notifySocket, error) {
+	addr := fmt.Sprintf("@watchdog/%d/%s", os.Getpid(), p.Name)
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create notify socket: %s", err)
+	}
+
+	// The kernel attaches the sender's credentials to each datagram
+	raw, err := conn.SyscallConn()
+	if err == nil {
+		raw.Control(func(fd uintptr) {
+			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to create notify socket: %s", err)
+	}
+
+	return &notifySocket{
+		addr:  addr,
+		ready: make(chan struct{}),
+		conn:  notifyConn{conn},
+	}, nil
+}
+
+// receive reads a notification, returning it with the pid which sent it
+func (c notifyConn) receive() (string, int, error) {
+	buf := make([]byte, 4096)
+	oob := make([]byte, syscall.CmsgSpace(syscall.SizeofUcred))
+
+	n, oobn, _, _, err := c.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return "", 0, err
+	}
+
+	pid := 0
+	if msgs, err := syscall.ParseSocketControlMessage(oob[:oobn]); err == nil {
+		for i := range msgs {
+			if cred, err := syscall.ParseUnixCredentials(&msgs[i]); err == nil {
+				pid = int(cred.Pid)
+			}
+		}
+	}
+	return string(buf[:n]), pid, nil
+}
@@ -0,0 +1,142 @@
+package process
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// notifyHelperEnv runs the test binary as a process which sends the
+// notifications in it, separated by "|", with "sleep:<duration>" pausing
+// between them, and then sleeps
+const notifyHelperEnv = "WATCHDOG_TEST_NOTIFY"
+
+func init() {
+	steps := os.Getenv(notifyHelperEnv)
+	if steps == "" {
+		return
+	}
+
+	conn, err := net.Dial("unixgram", os.Getenv(notifySocketEnv))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, step := range strings.Split(steps, "|") {
+		if strings.HasPrefix(step, "sleep:") {
+			d, _ := time.ParseDuration(strings.TrimPrefix(step, "sleep:"))
+			time.Sleep(d)
+			continue
+		}
+		conn.Write([]byte(step))
+	}
+	time.Sleep(5 * time.Second)
+	os.Exit(0)
+}
+
+func notifyHelper(name string, steps ...string) *Process {
+	proc := NewProcess(name, os.Args[0])
+	proc.Environment[notifyHelperEnv] = strings.Join(steps, "|")
+	proc.Notify = true
+	proc.Readiness = &Readiness{Notify: true, Interval: DefaultReadyInterval}
+	return proc
+}
+
+// waitForStatus waits for a process to be in a state with a status text
+func waitForStatus(t *testing.T, proc *Process, state, text string) {
+	deadline := time.Now().Add(2 * time.Second)
+	for proc.Status() != state || proc.StatusText() != text {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s %q, got %s %q", state, text, proc.Status(), proc.StatusText())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProcessStart_notify(t *testing.T) {
+	proc := notifyHelper("notifier",
+		"STATUS=booting",
+		"sleep:300ms",
+		"READY=1\nSTATUS=serving",
+		"sleep:300ms",
+		"RELOADING=1\nSTATUS=reloading",
+		"sleep:300ms",
+		"READY=1\nSTATUS=reloaded",
+	)
+	proc.KillSignal = os.Kill
+	proc.Run()
+	defer proc.StopWait()
+
+	started := make(chan error, 1)
+	go func() {
+		started <- proc.Start()
+	}()
+
+	waitForStatus(t, proc, "starting", "booting")
+	if proc.MainPID() != proc.PID() {
+		t.Errorf("expected main pid %d, got %d", proc.PID(), proc.MainPID())
+	}
+
+	// Only the process can say it is ready
+	conn, err := net.Dial("unixgram", fmt.Sprintf("@watchdog/%d/notifier", os.Getpid()))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	conn.Write([]byte("READY=1"))
+	conn.Close()
+
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Start timed out")
+	}
+	if status, text := proc.Status(), proc.StatusText(); status != "running" || text != "serving" {
+		t.Fatalf("expected running %q, got %s %q", "serving", status, text)
+	}
+
+	waitForStatus(t, proc, "reloading", "reloading")
+	waitForStatus(t, proc, "running", "reloaded")
+}
+
+func TestProcess_keepalive(t *testing.T) {
+	proc := notifyHelper("keepalive",
+		"READY=1",
+		"sleep:100ms", "WATCHDOG=1",
+		"sleep:100ms", "WATCHDOG=1",
+		"sleep:100ms", "WATCHDOG=1",
+	)
+	proc.WatchdogInterval = 200 * time.Millisecond
+	proc.Run()
+
+	start := time.Now()
+	if err := proc.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	select {
+	case <-proc.KeepaliveMissed():
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected keepalive to be missed")
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Errorf("keepalive missed after %s despite keepalives", elapsed)
+	}
+
+	// It is sent SIGABRT
+	deadline := time.Now().Add(2 * time.Second)
+	for !proc.IsStopped() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected process to exit, got %s", proc.Status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if proc.LastExitStatus == 0 {
+		t.Errorf("expected process to be aborted")
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"fmt"
+)
+
+type notifyConn struct{}
+
+func listenNotify(p *Process) (*notifySocket, error) {
+	return nil, fmt.Errorf("notify is only supported on Linux")
+}
+
+func (c notifyConn) receive() (string, int, error) {
+	return "", 0, fmt.Errorf("notify is only supported on Linux")
+}
+
+func (c notifyConn) Close() error {
+	return nil
+}
@@ -0,0 +1,45 @@
+package process
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigNotify(t *testing.T) {
+	config, err := DecodeConfigFromJSON(strings.NewReader(`{
+		"name": "daemon",
+		"program": "/usr/local/bin/daemon",
+		"notify": true,
+		"watchdog_interval": "10s"
+	}`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	proc := NewProcessFromConfig(config)
+	if !proc.Notify || proc.WatchdogInterval != 10*time.Second {
+		t.Errorf("unexpected process: %#v", proc)
+	}
+	if proc.Readiness == nil || !proc.Readiness.Notify {
+		t.Errorf("expected to wait for READY=1: %#v", proc.Readiness)
+	}
+
+	invalid := []string{
+		`{"watchdog_interval": "10s"}`,
+		`{"notify": true, "watchdog_interval": "0s"}`,
+		`{"notify": true, "sandbox": {"namespaces": ["network"]}}`,
+	}
+	for _, in := range invalid {
+		config, err := DecodeConfigFromJSON(strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := config.Validate(); err == nil {
+			t.Errorf("expected error validating %s", in)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stream identifies which of the process's output streams a record came from
+type Stream int
+
+const (
+	Stdout Stream = iota
+	Stderr
+)
+
+func (s Stream) String() string {
+	switch s {
+	case Stdout:
+		return "stdout"
+	case Stderr:
+		return "stderr"
+	}
+	return "unknown"
+}
+
+// ParseStream parses the name of an output stream
+func ParseStream(s string) (Stream, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "stdout", "out":
+		return Stdout, nil
+	case "stderr", "err":
+		return Stderr, nil
+	}
+	return Stdout, fmt.Errorf("unknown stream: %s", s)
+}
+
+// Record is a single line of output from a process.
+type Record struct {
+	// Process is the name of the process which wrote the line
+	Process string
+
+	// Pid of the process at the time the line was written
+	Pid int
+
+	// Stream the line was written to
+	Stream Stream
+
+	// Time the line was received by watchdog
+	Time time.Time
+
+	// Seq orders records from a single run of the process across both streams
+	Seq uint64
+
+	// Line is the output without its trailing newline
+	Line []byte
+
+	// Partial is set when the line was cut short because it exceeded the
+	// maximum line length, or no newline arrived before the flush timeout
+	Partial bool
+
+	// Fields are the structured fields parsed from a JSON or logfmt line
+	Fields map[string]interface{}
+
+	// Level is the normalised log level found in Fields, if any
+	Level string
+
+	// Message is the log message found in Fields, if any
+	Message string
+}
+
+const (
+	// DefaultOutputBufferSize is the number of records buffered per process
+	DefaultOutputBufferSize = 1024
+
+	// DefaultMaxLineLength is the longest line emitted as a single record
+	DefaultMaxLineLength = 16 * 1024
+
+	// DefaultPartialLineTimeout is how long an incomplete line is held
+	// waiting for its newline before being flushed
+	DefaultPartialLineTimeout = time.Second
+)
+
+// OverflowPolicy controls what happens to process output when the output
+// buffer is full because the consumer isn't keeping up.
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest discards the oldest buffered output to make room
+	OverflowDropOldest OverflowPolicy = iota
+
+	// OverflowDropNewest discards the output being written
+	OverflowDropNewest
+
+	// OverflowBlock blocks the process until there is room in the buffer,
+	// which will eventually stall the process on a full pipe
+	OverflowBlock
+)
+
+func (o OverflowPolicy) String() string {
+	switch o {
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowBlock:
+		return "block"
+	}
+	return "unknown"
+}
+
+// ParseOverflowPolicy parses the name of an overflow policy
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "drop-oldest", "drop_oldest":
+		return OverflowDropOldest, nil
+	case "drop-newest", "drop_newest":
+		return OverflowDropNewest, nil
+	case "block":
+		return OverflowBlock, nil
+	}
+	return OverflowDropOldest, fmt.Errorf("unknown output overflow policy: %s", s)
+}
+
+// outputQueue delivers records to a bounded channel, applying the overflow
+// policy when the channel is full.
+type outputQueue struct {
+	out     chan *Record
+	policy  OverflowPolicy
+	dropped *uint64
+}
+
+func (q *outputQueue) Push(r *Record) {
+	switch q.policy {
+	case OverflowBlock:
+		q.out <- r
+
+	case OverflowDropNewest:
+		select {
+		case q.out <- r:
+		default:
+			q.drop()
+		}
+
+	default:
+		for {
+			select {
+			case q.out <- r:
+				return
+			default:
+			}
+
+			// Make room by discarding the oldest record, unless the consumer
+			// beat us to it
+			select {
+			case <-q.out:
+				q.drop()
+			default:
+			}
+		}
+	}
+}
+
+func (q *outputQueue) drop() {
+	if q.dropped != nil {
+		atomic.AddUint64(q.dropped, 1)
+	}
+}
+
+// framer stamps records from all streams of a single run of a process with
+// the process identity and a shared sequence number.
+type framer struct {
+	sync.Mutex
+	name string
+	pid  int
+	seq  uint64
+	emit func(*Record)
+}
+
+func (f *framer) setPid(pid int) {
+	f.Lock()
+	defer f.Unlock()
+	f.pid = pid
+}
+
+func (f *framer) send(stream Stream, line []byte, partial bool) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.seq++
+	f.emit(&Record{
+		Process: f.name,
+		Pid:     f.pid,
+		Stream:  stream,
+		Time:    time.Now(),
+		Seq:     f.seq,
+		Line:    line,
+		Partial: partial,
+	})
+}
+
+// lineWriter is an io.Writer which splits a stream of output into lines.
+// Lines longer than maxLength are split, and an incomplete line is flushed
+// if its newline doesn't arrive within timeout.
+type lineWriter struct {
+	sync.Mutex
+	framer    *framer
+	stream    Stream
+	maxLength int
+	timeout   time.Duration
+
+	buf   []byte
+	timer *time.Timer
+}
+
+func newLineWriter(f *framer, stream Stream, maxLength int, timeout time.Duration) *lineWriter {
+	if maxLength <= 0 {
+		maxLength = DefaultMaxLineLength
+	}
+	return &lineWriter{
+		framer:    f,
+		stream:    stream,
+		maxLength: maxLength,
+		timeout:   timeout,
+	}
+}
+
+func (w *lineWriter) Write(b []byte) (n int, err error) {
+	w.Lock()
+	defer w.Unlock()
+
+	w.buf = append(w.buf, b...)
+
+	for len(w.buf) > 0 {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i >= 0 && i <= w.maxLength {
+			w.emit(i, false)
+			w.buf = w.buf[i+1:]
+		} else if len(w.buf) >= w.maxLength {
+			w.emit(w.maxLength, true)
+			w.buf = w.buf[w.maxLength:]
+		} else {
+			break
+		}
+	}
+
+	if len(w.buf) > 0 && w.timeout > 0 {
+		if w.timer == nil {
+			w.timer = time.AfterFunc(w.timeout, w.flushPartial)
+		} else {
+			w.timer.Reset(w.timeout)
+		}
+	} else if w.timer != nil {
+		w.timer.Stop()
+	}
+
+	return len(b), nil
+}
+
+// emit sends the first n bytes of the buffer as a record
+func (w *lineWriter) emit(n int, partial bool) {
+	line := make([]byte, n)
+	copy(line, w.buf[:n])
+	w.framer.send(w.stream, bytes.TrimSuffix(line, []byte{'\r'}), partial)
+}
+
+func (w *lineWriter) flushPartial() {
+	w.Lock()
+	defer w.Unlock()
+
+	if len(w.buf) > 0 {
+		w.emit(len(w.buf), true)
+		w.buf = nil
+	}
+}
+
+// Close flushes any remaining output as a final line
+func (w *lineWriter) Close() error {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	if len(w.buf) > 0 {
+		w.emit(len(w.buf), false)
+		w.buf = nil
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package process
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LogFormat is the structured format a process writes its output in
+type LogFormat int
+
+const (
+	// LogFormatNone leaves output unparsed
+	LogFormatNone LogFormat = iota
+
+	// LogFormatAuto parses lines which look like JSON or logfmt
+	LogFormatAuto
+
+	// LogFormatJSON parses lines which are JSON objects
+	LogFormatJSON
+
+	// LogFormatLogfmt parses key=value pairs from every line
+	LogFormatLogfmt
+)
+
+func (f LogFormat) String() string {
+	switch f {
+	case LogFormatNone:
+		return "none"
+	case LogFormatAuto:
+		return "auto"
+	case LogFormatJSON:
+		return "json"
+	case LogFormatLogfmt:
+		return "logfmt"
+	}
+	return "unknown"
+}
+
+// ParseLogFormat parses the name of a log format
+func ParseLogFormat(s string) (LogFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "none":
+		return LogFormatNone, nil
+	case "auto":
+		return LogFormatAuto, nil
+	case "json":
+		return LogFormatJSON, nil
+	case "logfmt":
+		return LogFormatLogfmt, nil
+	}
+	return LogFormatNone, fmt.Errorf("unknown log format: %s", s)
+}
+
+// Levels are the normalised log levels, from least to most severe
+var Levels = []string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+// LevelRank returns the severity of a normalised level, or -1 if it isn't
+// a known level.
+func LevelRank(level string) int {
+	for i, l := range Levels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// NormalizeLevel maps the many spellings of log levels, including bunyan's
+// numeric levels, onto Levels. Unknown levels are returned lowercased.
+func NormalizeLevel(level string) string {
+	level = strings.ToLower(strings.TrimSpace(level))
+	switch level {
+	case "trace", "10":
+		return "trace"
+	case "debug", "dbug", "20":
+		return "debug"
+	case "info", "information", "notice", "30":
+		return "info"
+	case "warn", "warning", "40":
+		return "warn"
+	case "error", "err", "eror", "50":
+		return "error"
+	case "fatal", "critical", "crit", "panic", "emerg", "alert", "60":
+		return "fatal"
+	}
+	return level
+}
+
+var (
+	levelKeys   = []string{"level", "lvl", "severity", "log_level", "loglevel"}
+	messageKeys = []string{"msg", "message"}
+)
+
+// parseStage returns a pipeline stage which parses structured output into
+// the record's fields before passing it on.
+func parseStage(format LogFormat, emit func(*Record)) func(*Record) {
+	return func(r *Record) {
+		ParseRecord(format, r)
+		emit(r)
+	}
+}
+
+// ParseRecord parses the record's line according to format, setting its
+// Fields, Level and Message. Lines which don't parse are left untouched.
+func ParseRecord(format LogFormat, r *Record) {
+	var fields map[string]interface{}
+
+	switch format {
+	case LogFormatJSON:
+		fields = parseJSON(r.Line)
+	case LogFormatLogfmt:
+		fields = parseLogfmt(r.Line, false)
+	case LogFormatAuto:
+		if fields = parseJSON(r.Line); fields == nil {
+			fields = parseLogfmt(r.Line, true)
+		}
+	}
+
+	if len(fields) == 0 {
+		return
+	}
+
+	r.Fields = fields
+	for _, key := range levelKeys {
+		if v, ok := fields[key]; ok {
+			r.Level = NormalizeLevel(fieldString(v))
+			break
+		}
+	}
+	for _, key := range messageKeys {
+		if v, ok := fields[key]; ok {
+			r.Message = fieldString(v)
+			break
+		}
+	}
+}
+
+// fieldString formats a field value for matching and display
+func fieldString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// FieldString returns the named field formatted as a string, and whether the
+// record has the field. The record's stream, level and message are available
+// as the fields "stream", "level" and "message" if not otherwise set.
+func (r *Record) FieldString(name string) (string, bool) {
+	if v, ok := r.Fields[name]; ok {
+		return fieldString(v), true
+	}
+
+	switch name {
+	case "stream":
+		return r.Stream.String(), true
+	case "level":
+		return r.Level, r.Level != ""
+	case "message":
+		return r.Message, r.Message != ""
+	}
+	return "", false
+}
+
+func parseJSON(line []byte) map[string]interface{} {
+	line = bytes.TrimSpace(line)
+	if len(line) < 2 || line[0] != '{' {
+		return nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// parseLogfmt parses key=value pairs, where values may be double quoted. In
+// strict mode every token on the line must be a pair, so plain text which
+// happens to contain an "=" isn't mistaken for logfmt.
+func parseLogfmt(line []byte, strict bool) map[string]interface{} {
+	fields := make(map[string]interface{})
+	s := string(line)
+
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			break
+		}
+
+		end := strings.IndexAny(s, "= \t")
+		if end == 0 {
+			if strict {
+				return nil
+			}
+			s = s[1:]
+			continue
+		}
+		if end < 0 {
+			end = len(s)
+		}
+		key := s[:end]
+		s = s[end:]
+
+		if s == "" || s[0] != '=' {
+			// Bare keys are flags
+			if strict {
+				return nil
+			}
+			fields[key] = true
+			continue
+		}
+		s = s[1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			quoted, rest, ok := splitQuoted(s)
+			if !ok {
+				if strict {
+					return nil
+				}
+				quoted, rest = s[1:], ""
+			}
+			value, s = quoted, rest
+		} else {
+			end := strings.IndexAny(s, " \t")
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+		fields[key] = value
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// splitQuoted unquotes the double quoted string at the start of s, returning
+// it and the remainder of s.
+func splitQuoted(s string) (string, string, bool) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", false
+			}
+			return value, s[i+1:], true
+		}
+	}
+	return "", "", false
+}
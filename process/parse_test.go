@@ -0,0 +1,74 @@
+package process
+
+import (
+	"testing"
+)
+
+func TestParseRecord_JSON(t *testing.T) {
+	r := &Record{Line: []byte(`{"level":"WARNING","msg":"disk low","free":1024,"tags":["a"]}`)}
+	ParseRecord(LogFormatJSON, r)
+
+	if r.Level != "warn" || r.Message != "disk low" {
+		t.Fatalf("bad: level=%s message=%s", r.Level, r.Message)
+	}
+	if v, _ := r.FieldString("free"); v != "1024" {
+		t.Errorf("expected free=1024, got %s", v)
+	}
+	if v, _ := r.FieldString("tags"); v != `["a"]` {
+		t.Errorf("expected tags to be JSON encoded, got %s", v)
+	}
+}
+
+func TestParseRecord_logfmt(t *testing.T) {
+	r := &Record{Line: []byte(`at=info level=error msg="request failed: \"timeout\"" path=/api dry_run`)}
+	ParseRecord(LogFormatLogfmt, r)
+
+	if r.Level != "error" || r.Message != `request failed: "timeout"` {
+		t.Fatalf("bad: level=%s message=%s", r.Level, r.Message)
+	}
+	if v, _ := r.FieldString("path"); v != "/api" {
+		t.Errorf("expected path=/api, got %s", v)
+	}
+	if v, _ := r.FieldString("dry_run"); v != "true" {
+		t.Errorf("expected bare key to be a flag, got %s", v)
+	}
+}
+
+func TestParseRecord_auto(t *testing.T) {
+	cases := map[string]string{
+		`{"severity":"error"}`:           "error",
+		`level=debug msg=starting`:       "debug",
+		`Listening on port=8000 for you`: "",
+		`plain text`:                     "",
+	}
+	for line, level := range cases {
+		r := &Record{Line: []byte(line)}
+		ParseRecord(LogFormatAuto, r)
+		if r.Level != level {
+			t.Errorf("%s: expected level %q, got %q", line, level, r.Level)
+		}
+	}
+}
+
+func TestParseRecord_none(t *testing.T) {
+	r := &Record{Line: []byte(`{"level":"error"}`)}
+	ParseRecord(LogFormatNone, r)
+	if r.Fields != nil {
+		t.Errorf("expected no fields, got %v", r.Fields)
+	}
+}
+
+func TestNormalizeLevel(t *testing.T) {
+	cases := map[string]string{
+		"WARN":  "warn",
+		"err":   "error",
+		"30":    "info",
+		"panic": "fatal",
+		"loud":  "loud",
+	}
+	for input, expected := range cases {
+		if actual := NormalizeLevel(input); actual != expected {
+			t.Errorf("NormalizeLevel(%s) = %s, expected %s", input, actual, expected)
+		}
+	}
+}
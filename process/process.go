@@ -2,10 +2,10 @@ package process
 
 import (
 	"fmt"
-	"io"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -19,22 +19,44 @@ const (
 	ProcessStarting
 	ProcessRunning
 	ProcessStopping
+	ProcessReloading
 )
 
 const (
 	StartEvent Event = iota
 	StopEvent
+	OOMKillEvent
 )
 
 const (
 	COMMAND_START int = iota
 	COMMAND_STOP
 	COMMAND_RESTART
+	COMMAND_ADOPT
+	COMMAND_DETACH
+	COMMAND_RESUME
 )
 
+// UnknownExitStatus is reported when a process exits without its exit status
+// being known, such as an adopted process which isn't a child of the agent
+const UnknownExitStatus = -1
+
+// OOMKilledExitStatus is reported when a process with a memory limit is
+// killed by the OOM killer for exceeding it
+const OOMKilledExitStatus = -2
+
+// killWait is how long to wait for a process to exit after it is killed
+var killWait = 5 * time.Second
+
 type processCommand struct {
-	Command int
-	Reply   chan error
+	Command  int
+	Reply    chan error
+	Identity *Identity
+	Handover *Handover
+
+	// Ready, if set, is sent whether a started process became ready, and
+	// Reply is sent to as soon as it is launched
+	Ready chan error
 }
 
 func (p *ProcessState) String() string {
@@ -47,6 +69,8 @@ func (p *ProcessState) String() string {
 		return "running"
 	case ProcessStopping:
 		return "stopping"
+	case ProcessReloading:
+		return "reloading"
 	}
 	return "unknown"
 }
@@ -57,6 +81,8 @@ func (e *Event) String() string {
 		return "start"
 	case StopEvent:
 		return "stop"
+	case OOMKillEvent:
+		return "oom-kill"
 	}
 	return "unknown"
 }
@@ -80,9 +106,25 @@ type Process struct {
 	// Last status code from this process exiting
 	LastExitStatus int `json:"last_exit_status,int"`
 
-	// Launch timeout
+	// Restarts counts how many times the process has been started again
+	// after its first start
+	Restarts int `json:"restarts"`
+
+	// Timeout is how long the process has to become ready once launched
 	Timeout time.Duration `json:"timeout"`
 
+	// Readiness decides when the process is ready once launched, or nil if
+	// it is as soon as it is launched
+	Readiness *Readiness `json:"-"`
+
+	// Notify gives the process a socket to send notifications to, as with
+	// systemd's sd_notify
+	Notify bool `json:"notify"`
+
+	// WatchdogInterval is how often a process with Notify must send a
+	// keepalive once it is ready, or zero if it needn't
+	WatchdogInterval time.Duration `json:"watchdog_interval"`
+
 	// Command is the executable and arguments to run
 	Command []string `json:"command"`
 
@@ -98,36 +140,134 @@ type Process struct {
 	// Timeout to wait for process to exit gracefully before killing
 	KillTimeout time.Duration `json:"kill_timeout"`
 
+	// KillMode decides which processes are signalled to stop the process
+	KillMode KillMode `json:"kill_mode"`
+
 	// Throttle relaunching
 	Throttle time.Duration `json:"throttle"`
 
 	// Restart process it exits
 	KeepAlive bool `json:"keep_alive"`
 
+	// Kill orphaned descendants left running once the process exits
+	KillOrphans bool `json:"kill_orphans"`
+
 	// User and Group to switch to after exec
 	UserName  string `json:"user"`
 	GroupName string `json:"group"`
 
+	// ConfigPath is the configuration file the process was registered from
+	ConfigPath string `json:"config_path"`
+
+	// Limits are the resource limits the process runs with
+	Limits []Limit `json:"limits"`
+
+	// Scheduling is the process's CPU and IO priority, CPU affinity and OOM
+	// score adjustment
+	Scheduling *Scheduling `json:"scheduling"`
+
+	// RootDirectory is the directory the process is chrooted to, if any
+	RootDirectory string `json:"root_directory"`
+
+	// Umask is the process's file mode creation mask, if set
+	Umask *int `json:"umask"`
+
+	// Stdin is the file the process reads as its standard input, or nil for
+	// the null device
+	Stdin *Stdin `json:"stdin"`
+
+	// Sandbox isolates the process from the rest of the system
+	Sandbox *Sandbox `json:"sandbox"`
+
+	// RestartRules restart the process when its resource usage exceeds a
+	// threshold for too long
+	RestartRules []*RestartRule `json:"-"`
+
+	// CgroupLimits are the CPU, memory and pids limits of the process's
+	// cgroup, which it runs in whatever its kill mode
+	CgroupLimits *CgroupLimits `json:"cgroup_limits"`
+
 	// WorkingDirectory is the directory to chdir to after forking
 	WorkingDirectory string `json:"working_directory"`
 
-	// Outlets are used to send the process output to other services
-	outlets []*io.Writer
+	// Outlets configures where the process output is sent, keyed by outlet
+	// type with the configuration for that outlet as the value
+	Outlets map[string]map[string]string `json:"outlets"`
+
+	// OutputOverflow decides what happens to output when the consumer falls
+	// behind and the output buffer fills up
+	OutputOverflow OverflowPolicy `json:"output_overflow"`
+
+	// MaxLineLength is the longest line of output emitted as a single record
+	MaxLineLength int `json:"max_line_length"`
+
+	// PartialLineTimeout is how long to wait for the end of an incomplete
+	// line of output before flushing it
+	PartialLineTimeout time.Duration `json:"partial_line_timeout"`
+
+	// Multiline groups related lines of output into a single record
+	Multiline *MultilineRule `json:"-"`
+
+	// LogFormat is the structured format output is parsed as
+	LogFormat LogFormat `json:"log_format"`
+
+	// Redactor masks secrets in output before it leaves the process
+	Redactor *Redactor `json:"-"`
+
+	// dropped counts output discarded by the overflow policy
+	dropped uint64
+
+	// runs counts how many times the process has been started
+	runs int
+
+	// stats is the recent history of the process's resource usage
+	stats []Sample
+
+	// breaches are when each restart rule started being exceeded by the
+	// instance with breachPid
+	breaches  map[*RestartRule]time.Time
+	breachPid int
 
 	// Internal state of the process
 	state ProcessState
 
+	// adopted is set while the running instance is one adopted from a
+	// previous agent
+	adopted bool
+
+	// starting is the start waiting for the process to be ready, only used
+	// by the runloop
+	starting *pendingStart
+
+	// notify receives the notifications of the running instance, which set
+	// its statusText and mainPid and keep its keepalive timer from expiring
+	notify          *notifySocket
+	statusText      string
+	mainPid         int
+	keepalive       *time.Timer
+	keepaliveMissed chan struct{}
+
 	proc       *os.Process
-	outputChan chan []byte
+	capture    *capture
+	cgroup     *cgroup
+	killTimer  *time.Timer
+	exited     chan struct{}
+	outputChan chan *Record
 	done       chan int
 	Events     chan Event
 	manage     chan *processCommand
 	waitChan   chan bool
 
+	// detached is the capture handed over by Detach, taken back if this
+	// agent resumes the process itself
+	detached *capture
+
 	runner ProcessRunner
 
-	stateMu sync.Mutex
-	pidMu   sync.Mutex
+	stateMu  sync.Mutex
+	pidMu    sync.Mutex
+	statsMu  sync.Mutex
+	notifyMu sync.Mutex
 
 	sync.Mutex
 }
@@ -135,7 +275,7 @@ type Process struct {
 // ProcessRunner is an interface for running processes, used mainly for switching
 // between a live runner and a test runner
 type ProcessRunner interface {
-	Exec(*Process, chan []byte, chan int) (*os.Process, error)
+	Exec(*Process, chan *Record, chan int) (*os.Process, error)
 }
 
 // NewProcess constructs a new Process instance which can be accepted by
@@ -151,11 +291,16 @@ func NewProcess(name string, command ...string) *Process {
 		KeepAlive:   true,
 		Throttle:    time.Second * 10,
 
-		outputChan: make(chan []byte),
+		MaxLineLength:      DefaultMaxLineLength,
+		PartialLineTimeout: DefaultPartialLineTimeout,
+
+		outputChan: make(chan *Record, DefaultOutputBufferSize),
 		done:       make(chan int),
 		manage:     make(chan *processCommand),
 		Events:     make(chan Event),
 		waitChan:   make(chan bool),
+
+		keepaliveMissed: make(chan struct{}, 1),
 	}
 }
 
@@ -192,26 +337,125 @@ func NewProcessFromConfig(conf *ProcessConfig) *Process {
 		throttleInterval = time.Second * 15
 	}
 
-	return &Process{
-		Name:             conf.Name,
-		Enabled:          !conf.Disabled,
-		Command:          programArgs,
-		Environment:      conf.EnvironmentVariables,
-		KillSignal:       killSignal,
-		KillTimeout:      killTimeout,
-		Throttle:         throttleInterval,
-		KeepAlive:        conf.KeepAlive,
-		RunAtLoad:        conf.RunAtLoad,
-		WorkingDirectory: conf.WorkingDirectory,
-		UserName:         conf.UserName,
-		GroupName:        conf.GroupName,
-	}
-}
-
-func (p *Process) OutputChan() chan []byte {
+	overflow, err := ParseOverflowPolicy(conf.OutputOverflow)
+	if err != nil {
+		overflow = OverflowDropOldest
+	}
+
+	bufferSize := conf.OutputBufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultOutputBufferSize
+	}
+
+	p := NewProcess(conf.Name, programArgs...)
+	p.Enabled = !conf.Disabled
+	p.KillSignal = killSignal
+	p.KillTimeout = killTimeout
+	p.KillMode, _ = ParseKillMode(conf.KillMode)
+	p.Throttle = throttleInterval
+	p.KeepAlive = conf.KeepAlive
+	p.KillOrphans = conf.KillOrphans
+	p.RunAtLoad = conf.RunAtLoad
+	p.WorkingDirectory = conf.WorkingDirectory
+	p.UserName = conf.UserName
+	p.GroupName = conf.GroupName
+	p.RootDirectory = conf.RootDirectory
+	p.Outlets = conf.Outlets
+	p.OutputOverflow = overflow
+	p.outputChan = make(chan *Record, bufferSize)
+
+	if conf.MaxLineLength > 0 {
+		p.MaxLineLength = conf.MaxLineLength
+	}
+	if timeout, err := time.ParseDuration(conf.PartialLineTimeout); err == nil {
+		p.PartialLineTimeout = timeout
+	}
+
+	if limits, err := ParseLimits(conf.Limits); err == nil {
+		p.Limits = limits
+	}
+
+	if limits, err := ParseCgroupLimits(conf); err == nil {
+		p.CgroupLimits = limits
+	}
+
+	if scheduling, err := ParseScheduling(conf); err == nil {
+		p.Scheduling = scheduling
+	}
+
+	if umask, err := ParseUmask(conf.Umask); err == nil {
+		p.Umask = umask
+	}
+
+	if stdin, err := ParseStdin(conf.Stdin); err == nil {
+		p.Stdin = stdin
+	}
+
+	if sandbox, err := ParseSandbox(conf.Sandbox); err == nil {
+		p.Sandbox = sandbox
+	}
+
+	for _, r := range conf.RestartRules {
+		if rule, err := ParseRestartRule(r); err == nil {
+			p.RestartRules = append(p.RestartRules, rule)
+		}
+	}
+
+	p.Notify = conf.Notify
+	if interval, err := time.ParseDuration(conf.WatchdogInterval); err == nil {
+		p.WatchdogInterval = interval
+	}
+
+	if readiness, err := NewReadiness(conf.Readiness, conf.Notify); err == nil {
+		p.Readiness = readiness
+	}
+	if timeout, err := time.ParseDuration(conf.Timeout); err == nil {
+		p.Timeout = timeout
+	}
+
+	if conf.Multiline != nil {
+		if rule, err := NewMultilineRule(conf.Multiline); err == nil {
+			p.Multiline = rule
+		}
+	}
+
+	if format, err := ParseLogFormat(conf.LogFormat); err == nil {
+		p.LogFormat = format
+	}
+
+	if redactor, err := NewRedactor(conf.Redact, conf.secretValues()); err == nil {
+		p.Redactor = redactor
+	}
+
+	if conf.EnvironmentVariables != nil {
+		p.Environment = conf.EnvironmentVariables
+	}
+
+	return p
+}
+
+// ExitReason describes an exit status reported in LastExitStatus
+func ExitReason(status int) string {
+	switch status {
+	case UnknownExitStatus:
+		return "unknown"
+	case OOMKilledExitStatus:
+		return "oom-killed"
+	}
+	return fmt.Sprintf("%d", status)
+}
+
+// OutputChan returns the channel output records from the process are sent to
+func (p *Process) OutputChan() chan *Record {
 	return p.outputChan
 }
 
+// DroppedLines returns the number of output lines discarded because the
+// output buffer was full
+func (p *Process) DroppedLines() uint64 {
+	return atomic.LoadUint64(&p.dropped)
+}
+
 // Status returns the process state
 func (p *Process) Status() string {
 	p.stateMu.Lock()
@@ -225,6 +469,41 @@ func (p *Process) IsRunning() bool {
 	return p.state == ProcessRunning
 }
 
+// Adopted reports whether the running instance was adopted from a previous
+// agent, so its output isn't captured
+func (p *Process) Adopted() bool {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	return p.adopted
+}
+
+// History is when a process last started, how it last exited and how many
+// times it has been restarted
+type History struct {
+	StartedAt      time.Time
+	LastExitStatus int
+	Restarts       int
+}
+
+// History returns the history of the process, which its runloop updates
+func (p *Process) History() History {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	return History{
+		StartedAt:      p.StartedAt,
+		LastExitStatus: p.LastExitStatus,
+		Restarts:       p.Restarts,
+	}
+}
+
+// SetRestarts restores the restart counter of a process taken over from a
+// previous agent
+func (p *Process) SetRestarts(restarts int) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	p.Restarts = restarts
+}
+
 func (p *Process) IsStopped() bool {
 	p.stateMu.Lock()
 	defer p.stateMu.Unlock()
@@ -235,6 +514,18 @@ func (p *Process) setStatus(state ProcessState) {
 	p.stateMu.Lock()
 	defer p.stateMu.Unlock()
 	p.state = state
+
+	if (state == ProcessStarting || state == ProcessRunning) && p.exited == nil {
+		p.exited = make(chan struct{})
+	}
+}
+
+// exitedChan returns a channel which is closed when the running instance of
+// the process exits, or nil if it isn't running
+func (p *Process) exitedChan() chan struct{} {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+	return p.exited
 }
 
 func (p *Process) Wait() {
@@ -247,24 +538,89 @@ func (p *Process) SetRunner(r ProcessRunner) {
 	p.runner = r
 }
 
-// Start the process
+// Start the process, returning once it is ready
 func (p *Process) Start() error {
 	replyChan := make(chan error)
-	c := &processCommand{COMMAND_START, replyChan}
+	c := &processCommand{Command: COMMAND_START, Reply: replyChan}
 	p.manage <- c
 	return <-c.Reply
 }
 
+// Launch starts the process without waiting for it to be ready. Whether it
+// becomes ready is sent on the returned channel, which already has been for
+// a process without readiness checks.
+func (p *Process) Launch() (<-chan error, error) {
+	replyChan := make(chan error)
+	c := &processCommand{Command: COMMAND_START, Reply: replyChan, Ready: make(chan error, 1)}
+	p.manage <- c
+	if err := <-c.Reply; err != nil {
+		return nil, err
+	}
+	return c.Ready, nil
+}
+
+// Stop sends the process its kill signal without waiting for it to exit. It
+// is killed if it is still running after KillTimeout.
 func (p *Process) Stop() error {
 	replyChan := make(chan error)
-	c := &processCommand{COMMAND_STOP, replyChan}
+	c := &processCommand{Command: COMMAND_STOP, Reply: replyChan}
 	p.manage <- c
 	return <-c.Reply
 }
 
+// StopWait stops the process and waits for it to exit. It is killed if it is
+// still running after KillTimeout, and an error is returned if it doesn't exit
+// soon after that.
+func (p *Process) StopWait() error {
+	exited := p.exitedChan()
+	if exited == nil {
+		return nil
+	}
+
+	pid := p.PID()
+	deadline := time.After(p.StopTimeout())
+	if err := p.Stop(); err != nil {
+		return err
+	}
+
+	select {
+	case <-exited:
+	case <-deadline:
+		return fmt.Errorf("process did not exit: %s", p.Name)
+	}
+
+	// Wait for the rest of its group or cgroup too
+	for p.treeAlive(pid) {
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			return fmt.Errorf("processes started by %s did not exit", p.Name)
+		}
+	}
+	return nil
+}
+
+// StopTimeout is the longest stopping the process can take, waiting for
+// KillTimeout and then for it to be killed
+func (p *Process) StopTimeout() time.Duration {
+	return p.KillTimeout + killWait
+}
+
+// Restart stops the process, waiting for it to exit as StopWait does, and
+// starts it again
 func (p *Process) Restart() error {
+	if err := p.StopWait(); err != nil {
+		return err
+	}
+	return p.Start()
+}
+
+// Adopt takes over supervision of an already running instance of the
+// process, such as one left running by a previous agent. Its output can't be
+// captured and its exit status is unknown.
+func (p *Process) Adopt(id *Identity) error {
 	replyChan := make(chan error)
-	c := &processCommand{COMMAND_RESTART, replyChan}
+	c := &processCommand{Command: COMMAND_ADOPT, Reply: replyChan, Identity: id}
 	p.manage <- c
 	return <-c.Reply
 }
@@ -277,8 +633,9 @@ func (p *Process) exec() error {
 		p.runner = &DefaultRunner{}
 	}
 
-	p.setStatus(ProcessStarting)
+	p.stateMu.Lock()
 	p.StartedAt = time.Now()
+	p.stateMu.Unlock()
 
 	proc, err := p.runner.Exec(p, p.outputChan, p.done)
 	if err != nil {
@@ -286,8 +643,76 @@ func (p *Process) exec() error {
 	}
 
 	p.proc = proc
+	p.stateMu.Lock()
+	if p.runs > 0 {
+		p.Restarts++
+	}
+	p.stateMu.Unlock()
+	p.runs++
 
+	// It is running once it is ready
+	p.setStatus(ProcessStarting)
+	return nil
+}
+
+// ready marks the started process as running
+func (p *Process) ready() {
 	p.setStatus(ProcessRunning)
+	p.armKeepalive()
+
+	select {
+	case p.Events <- StartEvent:
+	default:
+		fmt.Println("Start Event Ignored")
+	}
+	fmt.Println("Started")
+}
+
+// startResult returns the channel the outcome of the readiness checks of a
+// pending start is sent to, or nil if there is none
+func (p *Process) startResult() chan error {
+	if p.starting == nil {
+		return nil
+	}
+	return p.starting.result
+}
+
+// cancelStart fails the pending start, if there is one, and stops its
+// readiness checks
+func (p *Process) cancelStart(err error) {
+	if p.starting == nil {
+		return
+	}
+	close(p.starting.cancel)
+	p.starting.reply <- err
+	p.starting = nil
+}
+
+func (p *Process) adopt(id *Identity) error {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.PID() != 0 {
+		return fmt.Errorf("process is already running: %s", p.Name)
+	}
+
+	proc, err := os.FindProcess(id.Pid)
+	if err != nil {
+		return err
+	}
+
+	p.proc = proc
+	p.cgroup = existingCgroup(p)
+	p.setPid(id.Pid)
+	p.runs++
+	p.setStatus(ProcessRunning)
+
+	p.stateMu.Lock()
+	p.StartedAt = id.StartedAt()
+	p.adopted = true
+	p.stateMu.Unlock()
+
+	go watchAdopted(p, id, p.done)
 	return nil
 }
 
@@ -303,19 +728,47 @@ func (p *Process) PID() int {
 	return p.pid
 }
 
+// terminate sends the process its kill signal, and kills it if it is still
+// running after KillTimeout
 func (p *Process) terminate() error {
-	// didExit := make(chan bool)
+	pid := p.PID()
+	if pid == 0 || p.proc == nil {
+		return nil
+	}
 
-	err := p.proc.Signal(syscall.SIGQUIT)
-	if err != nil {
+	// Keepalives aren't expected while it stops, unless it can't be stopped
+	armed := p.stopKeepalive()
+	// The process may have exited without being reaped yet
+	if err := p.signalTree(pid, p.killSignal()); err != nil && err != syscall.ESRCH {
+		if armed {
+			p.armKeepalive()
+		}
 		return err
 	}
+	p.setStatus(ProcessStopping)
 
-	if p.PID() == 0 {
+	if p.killTimer != nil {
+		p.killTimer.Stop()
 	}
+	p.killTimer = time.AfterFunc(p.KillTimeout, func() {
+		// The process may have exited and its pid been reused, but what it
+		// left in its group or cgroup is killed unless it started again
+		current := p.PID()
+		if current == pid || (current == 0 && p.KillMode != KillModeMain) {
+			fmt.Println("Killing process", pid)
+			p.signalTree(pid, syscall.SIGKILL)
+		}
+	})
 	return nil
+}
 
-	// return p.proc.Kill()
+// killSignal is the signal the process is stopped with
+func (p *Process) killSignal() syscall.Signal {
+	sig, ok := p.KillSignal.(syscall.Signal)
+	if !ok {
+		return syscall.SIGTERM
+	}
+	return sig
 }
 
 func (p *Process) formattedEnv() []string {
@@ -329,12 +782,37 @@ func (p *Process) formattedEnv() []string {
 }
 
 func (p *Process) finish(status int) {
+	// Anything left in the group or cgroup is still killed on time
+	if p.killTimer != nil && p.KillMode == KillModeMain {
+		p.killTimer.Stop()
+	}
+	p.killTimer = nil
+
+	if p.cgroup != nil && !p.cgroup.populated() {
+		p.cgroup.remove()
+	}
+
+	p.stopKeepalive()
+	if p.notify != nil {
+		p.notify.Close()
+		p.notify = nil
+	}
+	p.notifyMu.Lock()
+	p.mainPid = 0
+	p.notifyMu.Unlock()
+
 	p.stateMu.Lock()
 	defer p.stateMu.Unlock()
 
 	p.StartedAt = time.Time{}
 	p.LastExitStatus = status
 	p.state = ProcessStopped
+	p.adopted = false
+
+	if p.exited != nil {
+		close(p.exited)
+		p.exited = nil
+	}
 }
 
 func (p *Process) Run() {
@@ -350,6 +828,15 @@ func (p *Process) runloop() {
 			case status := <-p.done:
 				fmt.Println("Processs Exited")
 				p.finish(status)
+				p.cancelStart(fmt.Errorf("process %s exited with status %s before it was ready", p.Name, ExitReason(status)))
+
+				if status == OOMKilledExitStatus {
+					fmt.Println("Process was killed for exceeding its memory limit:", p.Name)
+					select {
+					case p.Events <- OOMKillEvent:
+					default:
+					}
+				}
 
 				select {
 				case p.waitChan <- true:
@@ -368,45 +855,70 @@ func (p *Process) runloop() {
 
 				// willExit = false
 
+			case err := <-p.startResult():
+				start := p.starting
+				p.starting = nil
+				if err != nil {
+					fmt.Println("Process did not become ready:", p.Name, err)
+					err = fmt.Errorf("process %s %s", p.Name, err)
+					if stopErr := p.terminate(); stopErr != nil {
+						fmt.Println("Failed to stop process:", stopErr)
+					}
+				} else {
+					p.ready()
+				}
+				start.reply <- err
+
 			case command := <-p.manage:
 				switch command.Command {
 				case COMMAND_START:
+					if p.starting != nil {
+						command.Reply <- fmt.Errorf("process is already starting: %s", p.Name)
+						break
+					}
+
 					err := p.exec()
 					if err != nil {
 						fmt.Println("Failed to start process:", err.Error())
-					} else {
-						// p.Events <- StartEvent
-						select {
-						case p.Events <- StartEvent:
-						default:
-							fmt.Println("Start Event Ignored")
+						command.Reply <- err
+						break
+					}
+
+					if p.Readiness == nil {
+						p.ready()
+						if command.Ready != nil {
+							command.Ready <- nil
 						}
+						command.Reply <- nil
+						break
 					}
-					command.Reply <- err
 
-					fmt.Println("Started")
+					// Reply once the process is ready, unless it is only
+					// being launched
+					fmt.Println("Waiting for process to be ready:", p.Name)
+					if command.Ready != nil {
+						p.starting = p.waitReady(command.Ready)
+						command.Reply <- nil
+						break
+					}
+					p.starting = p.waitReady(command.Reply)
 
 				case COMMAND_STOP:
-					fmt.Println("Received stop command", p.proc.Pid)
-					if p.proc != nil {
-						p.terminate()
-					} else {
-						fmt.Println("proc is nil")
-					}
-					command.Reply <- nil
+					fmt.Println("Received stop command", p.PID())
+					p.cancelStart(fmt.Errorf("process %s was stopped before it was ready", p.Name))
+					command.Reply <- p.terminate()
 
-					// err := p.terminate()
-					// if err != nil {
-					// 	fmt.Println("Error terminating process", err.Error())
-					// }
+				case COMMAND_ADOPT:
+					command.Reply <- p.adopt(command.Identity)
 
-				case COMMAND_RESTART:
-					if p.PID() != 0 {
-						p.Stop()
-						<-time.After(p.Throttle)
-					}
-					p.Start()
-					command.Reply <- nil
+				case COMMAND_DETACH:
+					p.cancelStart(fmt.Errorf("process %s was handed over before it was ready", p.Name))
+					h, err := p.detach()
+					command.Handover = h
+					command.Reply <- err
+
+				case COMMAND_RESUME:
+					command.Reply <- p.resume(command.Handover)
 				}
 
 				// 			case command := <-p.commands:
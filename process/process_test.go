@@ -24,9 +24,14 @@ func TestProcesStart(t *testing.T) {
 	proc.Run()
 	proc.Start()
 
+	finished := make(chan struct{})
+	defer close(finished)
+
 	go func() {
 		for {
 			select {
+			case <-finished:
+				return
 			case <-time.After(2 * time.Second):
 				t.Error("Timed out")
 				break
@@ -93,3 +98,55 @@ func TestProcesStop(t *testing.T) {
 	proc.Wait()
 	t.Log("Mon loop done")
 }
+
+func TestProcessCountsRestarts(t *testing.T) {
+	proc := NewProcess("true", "/bin/true")
+	proc.Run()
+
+	// The history can be read while the process restarts
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				proc.History()
+			}
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		if err := proc.Start(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		proc.Wait()
+	}
+
+	if h := proc.History(); h.Restarts != 2 || h.LastExitStatus != 0 {
+		t.Errorf("expected 2 restarts and a clean exit, got %#v", h)
+	}
+}
+
+func TestProcessStopWait(t *testing.T) {
+	proc := NewProcess("stubborn", "/bin/sh", "-c", `trap "" QUIT; exec sleep 5`)
+	proc.KillTimeout = 200 * time.Millisecond
+	proc.Run()
+
+	if err := proc.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	if err := proc.StopWait(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < proc.KillTimeout {
+		t.Errorf("expected the process to outlast its kill signal, stopped after %s", elapsed)
+	}
+	if !proc.IsStopped() || proc.PID() != 0 {
+		t.Errorf("expected process to be stopped")
+	}
+}
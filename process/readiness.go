@@ -0,0 +1,266 @@
+package process
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultReadyTimeout is how long a process with readiness checks has to
+	// become ready if it has no timeout
+	DefaultReadyTimeout = time.Minute
+
+	// DefaultReadyInterval is how often readiness is checked
+	DefaultReadyInterval = 500 * time.Millisecond
+)
+
+// ReadinessConfig is the configuration file representation of Readiness.
+// Every check which is set must pass for the process to be ready.
+type ReadinessConfig struct {
+	// TCP is an address, such as "127.0.0.1:8080", which accepts
+	// connections once the process is ready.
+	TCP string `mapstructure:"tcp"`
+
+	// HTTP is a URL which responds with a 2xx status once the process is
+	// ready.
+	HTTP string `mapstructure:"http"`
+
+	// LogPattern matches a line the process writes once it is ready.
+	LogPattern string `mapstructure:"log_pattern"`
+
+	// Exec is a command, with its arguments, which exits successfully once
+	// the process is ready.
+	Exec []string `mapstructure:"exec"`
+
+	// MinUptime is how long the process must have been running for, such as
+	// "5s", so one which crashes on boot isn't taken to be ready.
+	MinUptime string `mapstructure:"min_uptime"`
+
+	// Interval is how often the checks are made. The default is 500ms.
+	Interval string `mapstructure:"interval"`
+}
+
+// Readiness decides when a started process is ready, and so running
+type Readiness struct {
+	TCP        string
+	HTTP       string
+	LogPattern *regexp.Regexp
+	Exec       []string
+	MinUptime  time.Duration
+	Interval   time.Duration
+
+	// Notify waits for the process to send READY=1 to its notify socket
+	Notify bool
+}
+
+// NewReadiness parses the readiness checks of a process, which include
+// waiting for READY=1 if it has a notify socket, returning nil if it has none
+func NewReadiness(conf *ReadinessConfig, notify bool) (*Readiness, error) {
+	if conf == nil {
+		if notify {
+			return &Readiness{Notify: true, Interval: DefaultReadyInterval}, nil
+		}
+		return nil, nil
+	}
+
+	r := &Readiness{
+		TCP:      conf.TCP,
+		HTTP:     conf.HTTP,
+		Exec:     conf.Exec,
+		Interval: DefaultReadyInterval,
+		Notify:   notify,
+	}
+
+	var err error
+	if conf.LogPattern != "" {
+		if r.LogPattern, err = regexp.Compile(conf.LogPattern); err != nil {
+			return nil, fmt.Errorf("invalid readiness log_pattern: %s", err)
+		}
+	}
+	if conf.MinUptime != "" {
+		if r.MinUptime, err = time.ParseDuration(conf.MinUptime); err != nil || r.MinUptime < 0 {
+			return nil, fmt.Errorf("invalid readiness min_uptime: %s", conf.MinUptime)
+		}
+	}
+	if conf.Interval != "" {
+		if r.Interval, err = time.ParseDuration(conf.Interval); err != nil || r.Interval <= 0 {
+			return nil, fmt.Errorf("invalid readiness interval: %s", conf.Interval)
+		}
+	}
+	if r.TCP != "" {
+		if _, _, err := net.SplitHostPort(r.TCP); err != nil {
+			return nil, fmt.Errorf("invalid readiness tcp: %s", err)
+		}
+	}
+	if conf.Exec != nil && len(conf.Exec) == 0 {
+		return nil, fmt.Errorf("invalid readiness exec: no command given")
+	}
+
+	if r.TCP == "" && r.HTTP == "" && r.LogPattern == nil && r.Exec == nil && r.MinUptime == 0 && !r.Notify {
+		return nil, fmt.Errorf("readiness requires tcp, http, log_pattern, exec or min_uptime")
+	}
+	return r, nil
+}
+
+// pendingStart is a start of a process waiting for it to be ready
+type pendingStart struct {
+	reply  chan error
+	result chan error
+	cancel chan struct{}
+}
+
+// waitReady checks the readiness of the running instance of the process in
+// the background, sending the outcome to the returned start's result
+func (p *Process) waitReady(reply chan error) *pendingStart {
+	start := &pendingStart{
+		reply:  reply,
+		result: make(chan error, 1),
+		cancel: make(chan struct{}),
+	}
+
+	timeout := p.Timeout
+	if timeout <= 0 {
+		timeout = DefaultReadyTimeout
+	}
+
+	var logReady, notifyReady <-chan struct{}
+	if p.capture != nil {
+		logReady = p.capture.logReady
+	}
+	if p.notify != nil {
+		notifyReady = p.notify.ready
+	}
+
+	go func(r *Readiness, startedAt time.Time) {
+		start.result <- r.wait(startedAt, timeout, logReady, notifyReady, start.cancel)
+	}(p.Readiness, p.StartedAt)
+	return start
+}
+
+// errStartCanceled is returned by wait when the start is canceled
+var errStartCanceled = fmt.Errorf("start canceled")
+
+// wait makes the checks every interval until they all pass, returning an
+// error with why the process isn't ready if it isn't after timeout
+func (r *Readiness) wait(startedAt time.Time, timeout time.Duration, logReady, notifyReady, cancel <-chan struct{}) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	// Check again as soon as READY=1 is sent
+	notified := notifyReady
+
+	for {
+		err := r.check(startedAt, logReady, notifyReady)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-time.After(r.Interval):
+		case <-notified:
+			notified = nil
+		case <-deadline.C:
+			return fmt.Errorf("not ready after %s: %s", timeout, err)
+		case <-cancel:
+			return errStartCanceled
+		}
+	}
+}
+
+// check makes each check once, returning why the first failing one failed
+func (r *Readiness) check(startedAt time.Time, logReady, notifyReady <-chan struct{}) error {
+	if r.Notify {
+		select {
+		case <-notifyReady:
+		default:
+			return fmt.Errorf("READY=1 not sent")
+		}
+	}
+
+	if r.MinUptime > 0 {
+		if uptime := time.Since(startedAt); uptime < r.MinUptime {
+			return fmt.Errorf("up for %s of %s", uptime.Truncate(time.Millisecond), r.MinUptime)
+		}
+	}
+
+	if r.LogPattern != nil {
+		select {
+		case <-logReady:
+		default:
+			return fmt.Errorf("no output matching %s", r.LogPattern)
+		}
+	}
+
+	// Slow checks give up in time for the next
+	timeout := r.Interval
+	if timeout < time.Second {
+		timeout = time.Second
+	}
+
+	if r.TCP != "" {
+		conn, err := net.DialTimeout("tcp", r.TCP, timeout)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+	}
+
+	if r.HTTP != "" {
+		client := &http.Client{Timeout: timeout}
+		resp, err := client.Get(r.HTTP)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("%s responded %s", r.HTTP, resp.Status)
+		}
+	}
+
+	if r.Exec != nil {
+		if err := runCheck(r.Exec, timeout); err != nil {
+			return fmt.Errorf("%s: %s", r.Exec[0], err)
+		}
+	}
+	return nil
+}
+
+// runCheck runs a check command, tracked as a child so it isn't reaped as
+// an orphan
+func runCheck(command []string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+
+	forkLock.RLock()
+	err := cmd.Start()
+	if err == nil {
+		trackChild(cmd.Process.Pid)
+	}
+	forkLock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	err = cmd.Wait()
+	untrackChild(cmd.Process.Pid)
+	return err
+}
+
+// readyLogStage closes ready once a line of output matches pattern
+func readyLogStage(pattern *regexp.Regexp, ready chan struct{}, emit func(*Record)) func(*Record) {
+	var once sync.Once
+	return func(r *Record) {
+		if pattern.Match(r.Line) {
+			once.Do(func() { close(ready) })
+		}
+		emit(r)
+	}
+}
@@ -0,0 +1,223 @@
+package process
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestNewReadiness(t *testing.T) {
+	config, err := DecodeConfigFromJSON(strings.NewReader(`{
+		"name": "web",
+		"program": "/usr/local/bin/web",
+		"timeout": "30s",
+		"readiness": {
+			"tcp": "127.0.0.1:8080",
+			"http": "http://127.0.0.1:8080/health",
+			"log_pattern": "^Listening",
+			"exec": ["/usr/local/bin/check", "--quick"],
+			"min_uptime": "2s",
+			"interval": "1s"
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	proc := NewProcessFromConfig(config)
+	r := proc.Readiness
+	if r == nil || proc.Timeout != 30*time.Second {
+		t.Fatalf("unexpected process: %#v", proc)
+	}
+	if r.TCP != "127.0.0.1:8080" || r.HTTP != "http://127.0.0.1:8080/health" || len(r.Exec) != 2 {
+		t.Errorf("unexpected readiness: %#v", r)
+	}
+	if !r.LogPattern.MatchString("Listening on :8080") || r.MinUptime != 2*time.Second || r.Interval != time.Second {
+		t.Errorf("unexpected readiness: %#v", r)
+	}
+
+	invalid := []string{
+		`{"readiness": {}}`,
+		`{"readiness": {"tcp": "8080"}}`,
+		`{"readiness": {"log_pattern": "("}}`,
+		`{"readiness": {"exec": []}}`,
+		`{"readiness": {"min_uptime": "soon"}}`,
+		`{"readiness": {"min_uptime": "1s", "interval": "0s"}}`,
+		`{"timeout": "-1s"}`,
+	}
+	for _, in := range invalid {
+		config, err := DecodeConfigFromJSON(strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := config.Validate(); err == nil {
+			t.Errorf("expected error validating %s", in)
+		}
+	}
+}
+
+func TestProcessStart_readyLog(t *testing.T) {
+	proc := NewProcess("web", "/bin/sh", "-c", "sleep 0.2; echo Listening; exec sleep 5")
+	proc.KillSignal = syscall.SIGTERM
+	proc.Readiness = &Readiness{LogPattern: regexp.MustCompile("^Listening"), Interval: 20 * time.Millisecond}
+	proc.Run()
+	defer proc.StopWait()
+
+	go func() {
+		for range proc.OutputChan() {
+		}
+	}()
+
+	started := make(chan error, 1)
+	go func() {
+		started <- proc.Start()
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if status := proc.Status(); status != "starting" {
+		t.Fatalf("expected process to be starting, got %s", status)
+	}
+
+	select {
+	case err := <-started:
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Start timed out")
+	}
+	if !proc.IsRunning() {
+		t.Fatalf("expected process to be running, got %s", proc.Status())
+	}
+}
+
+func TestProcessStart_readyChecks(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer ln.Close()
+
+	// Healthy from the third request
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	proc := NewProcess("web", "/bin/sleep", "5")
+	proc.KillSignal = syscall.SIGTERM
+	proc.Readiness = &Readiness{
+		TCP:      ln.Addr().String(),
+		HTTP:     server.URL,
+		Exec:     []string{"/bin/true"},
+		Interval: 20 * time.Millisecond,
+	}
+	proc.Run()
+	defer proc.StopWait()
+
+	if err := proc.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !proc.IsRunning() || atomic.LoadInt32(&requests) != 3 {
+		t.Fatalf("unexpected state %s after %d requests", proc.Status(), requests)
+	}
+}
+
+func TestProcessStart_exitsBeforeReady(t *testing.T) {
+	proc := NewProcess("crasher", "/bin/sh", "-c", "exit 3")
+	proc.Readiness = &Readiness{MinUptime: time.Second, Interval: 20 * time.Millisecond}
+	proc.Run()
+
+	err := proc.Start()
+	if err == nil || !strings.Contains(err.Error(), "exited with status 3 before it was ready") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !proc.IsStopped() {
+		t.Fatalf("expected process to be stopped, got %s", proc.Status())
+	}
+}
+
+func TestProcessStart_notReady(t *testing.T) {
+	proc := NewProcess("hung", "/bin/sleep", "5")
+	proc.KillSignal = syscall.SIGTERM
+	proc.Timeout = 200 * time.Millisecond
+	proc.Readiness = &Readiness{Exec: []string{"/bin/false"}, Interval: 20 * time.Millisecond}
+	proc.Run()
+
+	start := time.Now()
+	err := proc.Start()
+	if err == nil || !strings.Contains(err.Error(), "not ready after 200ms") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < proc.Timeout {
+		t.Errorf("gave up after %s", elapsed)
+	}
+
+	// It is stopped for not being ready
+	deadline := time.Now().Add(2 * time.Second)
+	for !proc.IsStopped() {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected process to be stopped, got %s", proc.Status())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestProcessLaunch(t *testing.T) {
+	proc := NewProcess("web", "/bin/sleep", "5")
+	proc.KillSignal = syscall.SIGTERM
+	proc.Readiness = &Readiness{MinUptime: 200 * time.Millisecond, Interval: 20 * time.Millisecond}
+	proc.Run()
+	defer proc.StopWait()
+
+	ready, err := proc.Launch()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if status := proc.Status(); status != "starting" {
+		t.Fatalf("expected process to be starting, got %s", status)
+	}
+
+	select {
+	case err := <-ready:
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for process to be ready")
+	}
+	if !proc.IsRunning() {
+		t.Fatalf("expected process to be running, got %s", proc.Status())
+	}
+
+	// Without readiness checks it is ready once launched
+	other := NewProcess("worker", "/bin/sleep", "5")
+	other.KillSignal = syscall.SIGTERM
+	other.Run()
+	defer other.StopWait()
+
+	ready, err = other.Launch()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	select {
+	case err := <-ready:
+		if err != nil || !other.IsRunning() {
+			t.Fatalf("expected process to be running: %v", err)
+		}
+	default:
+		t.Fatal("expected process to be ready")
+	}
+}
@@ -0,0 +1,54 @@
+package process
+
+import (
+	"sync"
+	"time"
+)
+
+// ProcessNameEnv is set in the environment of every process to its name.
+// Descendants usually inherit it, so orphans can be traced back to the
+// process they came from.
+const ProcessNameEnv = "WATCHDOG_PROCESS"
+
+// Orphan is a descendant of a process which outlived its parent and was
+// reparented to the agent, as the agent is a child subreaper
+type Orphan struct {
+	Pid int
+
+	// Process is the name of the process it descends from, empty if unknown
+	Process string
+
+	// Zombie is set once it has exited and is waiting to be reaped
+	Zombie bool
+
+	StartedAt time.Time
+	Cmdline   []string
+}
+
+// The children started by processes are tracked so that only orphans are
+// reaped, leaving the exit status of every child to be collected by the
+// process which started it. forkLock is held while starting a child, so a
+// child is never seen before it is tracked.
+var (
+	forkLock   sync.RWMutex
+	childrenMu sync.Mutex
+	children   = make(map[int]bool)
+)
+
+func trackChild(pid int) {
+	childrenMu.Lock()
+	defer childrenMu.Unlock()
+	children[pid] = true
+}
+
+func untrackChild(pid int) {
+	childrenMu.Lock()
+	defer childrenMu.Unlock()
+	delete(children, pid)
+}
+
+func isTrackedChild(pid int) bool {
+	childrenMu.Lock()
+	defer childrenMu.Unlock()
+	return children[pid]
+}
@@ -0,0 +1,97 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// prSetChildSubreaper is PR_SET_CHILD_SUBREAPER from linux/prctl.h
+const prSetChildSubreaper = 36
+
+// EnableSubreaper makes the agent a child subreaper, so descendants of its
+// processes are reparented to it rather than init when their parent exits
+func EnableSubreaper() error {
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// FindOrphans returns the children of the agent which weren't started by a
+// process, which are orphans reparented to it
+func FindOrphans() ([]*Orphan, error) {
+	// Hold off starting children until they can be told apart
+	forkLock.Lock()
+	defer forkLock.Unlock()
+
+	entries, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	self := strconv.Itoa(os.Getpid())
+
+	var orphans []*Orphan
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		fields, err := procStat(pid)
+		if err != nil || fields[1] != self || isTrackedChild(pid) {
+			continue
+		}
+
+		o := &Orphan{Pid: pid, Zombie: fields[0] == "Z"}
+
+		// The environment and command line of a zombie are gone
+		if !o.Zombie {
+			o.Process = environValue(pid, ProcessNameEnv)
+			if id, err := Identify(pid); err == nil {
+				o.StartedAt = id.StartedAt()
+				o.Cmdline = id.Cmdline
+			}
+		}
+
+		orphans = append(orphans, o)
+	}
+	return orphans, nil
+}
+
+// ReapOrphan collects the exit status of an orphan which has exited
+func ReapOrphan(pid int) (int, error) {
+	var status syscall.WaitStatus
+	wpid, err := syscall.Wait4(pid, &status, syscall.WNOHANG, nil)
+	if err != nil {
+		return 0, err
+	}
+	if wpid != pid {
+		return 0, fmt.Errorf("process %d has not exited", pid)
+	}
+	return waitStatus(status), nil
+}
+
+// environValue reads a variable from the environment of a running process
+func environValue(pid int, name string) string {
+	environ, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return ""
+	}
+
+	prefix := []byte(name + "=")
+	for _, v := range bytes.Split(environ, []byte{0}) {
+		if bytes.HasPrefix(v, prefix) {
+			return string(v[len(prefix):])
+		}
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFindOrphans(t *testing.T) {
+	if err := EnableSubreaper(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	pidFile := filepath.Join(dir, "pid")
+
+	proc := NewProcess("forker", "/bin/sh", "-c", "sleep 5 >/dev/null 2>&1 & echo $! > "+pidFile)
+	proc.Run()
+	if err := proc.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	proc.Wait()
+
+	data, _ := ioutil.ReadFile(pidFile)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer syscall.Kill(pid, syscall.SIGKILL)
+
+	orphan := findOrphan(t, pid)
+	if orphan == nil || orphan.Zombie || orphan.Process != "forker" {
+		t.Fatalf("expected live orphan of forker, got %#v", orphan)
+	}
+
+	syscall.Kill(pid, syscall.SIGKILL)
+	for i := 0; i < 50; i++ {
+		if orphan = findOrphan(t, pid); orphan != nil && orphan.Zombie {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if orphan == nil || !orphan.Zombie {
+		t.Fatalf("expected orphan to become a zombie")
+	}
+
+	if status, err := ReapOrphan(pid); err != nil || status != 128+int(syscall.SIGKILL) {
+		t.Fatalf("expected killed orphan to be reaped, got status %d, err %v", status, err)
+	}
+}
+
+func findOrphan(t *testing.T, pid int) *Orphan {
+	orphans, err := FindOrphans()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, o := range orphans {
+		if o.Pid == pid {
+			return o
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"fmt"
+)
+
+// EnableSubreaper is only supported on Linux
+func EnableSubreaper() error {
+	return fmt.Errorf("child subreaper is not supported on this platform")
+}
+
+// FindOrphans finds nothing, as the agent can't be a subreaper
+func FindOrphans() ([]*Orphan, error) {
+	return nil, nil
+}
+
+// ReapOrphan is only supported on Linux
+func ReapOrphan(pid int) (int, error) {
+	return 0, fmt.Errorf("child subreaper is not supported on this platform")
+}
@@ -0,0 +1,161 @@
+package process
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CgroupLimits are the cgroup v2 CPU, memory and pids limits of a process.
+// Zero values are left unlimited.
+type CgroupLimits struct {
+	// MemoryMax is the memory.max of the process in bytes. It is killed by
+	// the OOM killer if it can't be kept below it.
+	MemoryMax uint64 `json:"memory_max"`
+
+	// MemoryHigh is the memory.high of the process in bytes, above which it
+	// is throttled and its memory reclaimed
+	MemoryHigh uint64 `json:"memory_high"`
+
+	// CPUWeight is the cpu.weight of the process, from 1 to 10000
+	CPUWeight int `json:"cpu_weight"`
+
+	// CPUMax is the cpu.max of the process, its quota and period in
+	// microseconds
+	CPUMax string `json:"cpu_max"`
+
+	// PidsMax is the pids.max of the process, the most processes and threads
+	// it can have
+	PidsMax int `json:"pids_max"`
+}
+
+// cpuMaxPeriod is the period of a cpu_max given as a percentage
+const cpuMaxPeriod = 100000
+
+// ParseCgroupLimits parses the cgroup limits of a process config, returning
+// nil if it has none
+func ParseCgroupLimits(conf *ProcessConfig) (*CgroupLimits, error) {
+	var l CgroupLimits
+	var err error
+
+	if conf.MemoryMax != "" {
+		if l.MemoryMax, err = parseLimitValue("as", conf.MemoryMax); err != nil {
+			return nil, fmt.Errorf("invalid memory_max: %s", err)
+		}
+	}
+	if conf.MemoryHigh != "" {
+		if l.MemoryHigh, err = parseLimitValue("as", conf.MemoryHigh); err != nil {
+			return nil, fmt.Errorf("invalid memory_high: %s", err)
+		}
+	}
+
+	if conf.CPUWeight != 0 && (conf.CPUWeight < 1 || conf.CPUWeight > 10000) {
+		return nil, fmt.Errorf("invalid cpu_weight: %d is not between 1 and 10000", conf.CPUWeight)
+	}
+	l.CPUWeight = conf.CPUWeight
+
+	if conf.CPUMax != "" {
+		if l.CPUMax, err = parseCPUMax(conf.CPUMax); err != nil {
+			return nil, fmt.Errorf("invalid cpu_max: %s", err)
+		}
+	}
+
+	if conf.PidsMax < 0 {
+		return nil, fmt.Errorf("invalid pids_max: %d is negative", conf.PidsMax)
+	}
+	l.PidsMax = conf.PidsMax
+
+	if l == (CgroupLimits{}) {
+		return nil, nil
+	}
+	return &l, nil
+}
+
+// parseCPUMax parses a cpu_max, either a percentage of one CPU, "max" or a
+// quota and period in microseconds, into the format of cpu.max
+func parseCPUMax(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "max" || s == "unlimited" {
+		return "max", nil
+	}
+
+	if strings.HasSuffix(s, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || percent <= 0 {
+			return "", fmt.Errorf("%q is not a positive percentage", s)
+		}
+
+		quota := int64(percent * cpuMaxPeriod / 100)
+		if quota < 1000 {
+			// The smallest quota the kernel accepts
+			quota = 1000
+		}
+		return fmt.Sprintf("%d %d", quota, cpuMaxPeriod), nil
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return "", fmt.Errorf("%q is not a percentage, max or a quota and period", s)
+	}
+	for _, field := range fields {
+		if n, err := strconv.ParseUint(field, 10, 64); err != nil || n == 0 {
+			if field == fields[0] && field == "max" {
+				continue
+			}
+			return "", fmt.Errorf("%q is not a percentage, max or a quota and period", s)
+		}
+	}
+	return strings.Join(fields, " "), nil
+}
+
+// controllers returns the cgroup controllers needed to apply the limits
+func (l *CgroupLimits) controllers() []string {
+	var controllers []string
+	if l.CPUWeight != 0 || l.CPUMax != "" {
+		controllers = append(controllers, "cpu")
+	}
+	if l.MemoryMax != 0 || l.MemoryHigh != 0 {
+		controllers = append(controllers, "memory")
+	}
+	if l.PidsMax != 0 {
+		controllers = append(controllers, "pids")
+	}
+	return controllers
+}
+
+// files returns the contents of the cgroup's interface files for the
+// limits. Those not set are given their default, so a cgroup left over from
+// a previous instance doesn't keep stale limits.
+func (l *CgroupLimits) files() map[string]string {
+	files := map[string]string{
+		"memory.max":  "max",
+		"memory.high": "max",
+		"cpu.weight":  "100",
+		"cpu.max":     "max",
+		"pids.max":    "max",
+	}
+
+	if l.MemoryMax != 0 {
+		files["memory.max"] = cgroupValue(l.MemoryMax)
+	}
+	if l.MemoryHigh != 0 {
+		files["memory.high"] = cgroupValue(l.MemoryHigh)
+	}
+	if l.CPUWeight != 0 {
+		files["cpu.weight"] = strconv.Itoa(l.CPUWeight)
+	}
+	if l.CPUMax != "" {
+		files["cpu.max"] = l.CPUMax
+	}
+	if l.PidsMax != 0 {
+		files["pids.max"] = strconv.Itoa(l.PidsMax)
+	}
+	return files
+}
+
+func cgroupValue(v uint64) string {
+	if v == Unlimited {
+		return "max"
+	}
+	return strconv.FormatUint(v, 10)
+}
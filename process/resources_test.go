@@ -0,0 +1,67 @@
+package process
+
+import (
+	"testing"
+)
+
+func TestParseCgroupLimits(t *testing.T) {
+	limits, err := ParseCgroupLimits(&ProcessConfig{
+		MemoryMax:  "512M",
+		MemoryHigh: "max",
+		CPUWeight:  200,
+		CPUMax:     "50%",
+		PidsMax:    64,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := CgroupLimits{
+		MemoryMax:  512 << 20,
+		MemoryHigh: Unlimited,
+		CPUWeight:  200,
+		CPUMax:     "50000 100000",
+		PidsMax:    64,
+	}
+	if limits == nil || *limits != expected {
+		t.Fatalf("bad: %#v", limits)
+	}
+
+	files := limits.files()
+	if files["memory.max"] != "536870912" || files["memory.high"] != "max" || files["cpu.max"] != "50000 100000" {
+		t.Fatalf("bad: %v", files)
+	}
+
+	if limits, err := ParseCgroupLimits(&ProcessConfig{}); limits != nil || err != nil {
+		t.Fatalf("expected no limits, got %#v, %v", limits, err)
+	}
+
+	invalid := []*ProcessConfig{
+		{MemoryMax: "lots"},
+		{CPUWeight: 20000},
+		{CPUMax: "fast"},
+		{CPUMax: "0%"},
+		{CPUMax: "50000 0"},
+		{PidsMax: -1},
+	}
+	for _, conf := range invalid {
+		if _, err := ParseCgroupLimits(conf); err == nil {
+			t.Errorf("expected error parsing %#v", conf)
+		}
+	}
+}
+
+func TestParseCPUMax(t *testing.T) {
+	cases := map[string]string{
+		"max":          "max",
+		"200%":         "200000 100000",
+		"0.1%":         "1000 100000",
+		"max 100000":   "max 100000",
+		"25000  50000": "25000 50000",
+	}
+	for input, expected := range cases {
+		if cpuMax, err := parseCPUMax(input); err != nil || cpuMax != expected {
+			t.Errorf("%q: expected %q, got %q, %v", input, expected, cpuMax, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package process
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RestartRule restarts a process when a measure of its resource usage stays
+// above a threshold for a while, such as "rss > 1.5G for 5m"
+type RestartRule struct {
+	// Metric is one of rss, memory (of its cgroup), cpu (percent), fds or
+	// threads
+	Metric string
+
+	Threshold float64
+
+	// For is how long the threshold must be exceeded for. The process is
+	// restarted as soon as it is exceeded if it is zero.
+	For time.Duration
+
+	rule string
+}
+
+// restartMetrics read each metric from a sample
+var restartMetrics = map[string]func(s *Sample) float64{
+	"rss":     func(s *Sample) float64 { return float64(s.RSS) },
+	"memory":  func(s *Sample) float64 { return float64(s.CgroupMemory) },
+	"cpu":     func(s *Sample) float64 { return s.CPUPercent },
+	"fds":     func(s *Sample) float64 { return float64(s.FDs) },
+	"threads": func(s *Sample) float64 { return float64(s.Threads) },
+}
+
+// ParseRestartRule parses a rule of the form "<metric> > <threshold>" with
+// an optional "for <duration>". Memory thresholds may have a K, M, G or T
+// suffix and CPU thresholds a % suffix.
+func ParseRestartRule(s string) (*RestartRule, error) {
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) != 3 && len(fields) != 5 {
+		return nil, fmt.Errorf("invalid restart rule %q: expected \"<metric> > <threshold> [for <duration>]\"", s)
+	}
+
+	rule := &RestartRule{Metric: fields[0], rule: strings.Join(fields, " ")}
+	if _, ok := restartMetrics[rule.Metric]; !ok {
+		return nil, fmt.Errorf("invalid restart rule %q: unknown metric %s", s, fields[0])
+	}
+	if fields[1] != ">" {
+		return nil, fmt.Errorf("invalid restart rule %q: expected >", s)
+	}
+
+	threshold, err := parseThreshold(rule.Metric, fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid restart rule %q: %s", s, err)
+	}
+	rule.Threshold = threshold
+
+	if len(fields) == 5 {
+		if fields[3] != "for" {
+			return nil, fmt.Errorf("invalid restart rule %q: expected for", s)
+		}
+		if rule.For, err = time.ParseDuration(fields[4]); err != nil || rule.For < 0 {
+			return nil, fmt.Errorf("invalid restart rule %q: invalid duration %s", s, fields[4])
+		}
+	}
+
+	return rule, nil
+}
+
+func (r *RestartRule) String() string {
+	return r.rule
+}
+
+// parseThreshold parses the threshold of a metric, a number with a unit
+// suffix for memory and cpu
+func parseThreshold(metric, s string) (float64, error) {
+	multiplier := 1.0
+	switch metric {
+	case "rss", "memory":
+		s = strings.TrimSuffix(s, "b")
+		if s != "" {
+			switch s[len(s)-1] {
+			case 'k':
+				multiplier = 1 << 10
+			case 'm':
+				multiplier = 1 << 20
+			case 'g':
+				multiplier = 1 << 30
+			case 't':
+				multiplier = 1 << 40
+			}
+			if multiplier > 1 {
+				s = s[:len(s)-1]
+			}
+		}
+	case "cpu":
+		s = strings.TrimSuffix(s, "%")
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid threshold %s", s)
+	}
+	return n * multiplier, nil
+}
+
+// CheckRestartRules records a sample against the process's restart rules,
+// returning the first rule whose threshold has been exceeded for long
+// enough. Every rule starts over once one fires, or the process restarts.
+func (p *Process) CheckRestartRules(s *Sample) *RestartRule {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	if p.breachPid != s.Pid {
+		p.breaches = nil
+		p.breachPid = s.Pid
+	}
+
+	for _, rule := range p.RestartRules {
+		if restartMetrics[rule.Metric](s) <= rule.Threshold {
+			delete(p.breaches, rule)
+			continue
+		}
+
+		if p.breaches == nil {
+			p.breaches = make(map[*RestartRule]time.Time)
+		}
+		since, ok := p.breaches[rule]
+		if !ok {
+			since = s.Time
+			p.breaches[rule] = since
+		}
+
+		if s.Time.Sub(since) >= rule.For {
+			p.breaches = nil
+			return rule
+		}
+	}
+	return nil
+}
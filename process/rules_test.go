@@ -0,0 +1,75 @@
+package process
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRestartRule(t *testing.T) {
+	cases := map[string]RestartRule{
+		"rss > 1.5GB for 5m":  {Metric: "rss", Threshold: 1.5 * (1 << 30), For: 5 * time.Minute},
+		"CPU > 95% for 10m":   {Metric: "cpu", Threshold: 95, For: 10 * time.Minute},
+		"fds > 1000":          {Metric: "fds", Threshold: 1000},
+		"memory > 512m":       {Metric: "memory", Threshold: 512 << 20},
+		"threads > 50 for 0s": {Metric: "threads", Threshold: 50},
+	}
+	for input, expected := range cases {
+		rule, err := ParseRestartRule(input)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if rule.Metric != expected.Metric || rule.Threshold != expected.Threshold || rule.For != expected.For {
+			t.Errorf("%q: unexpected rule %#v", input, rule)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"rss > lots",
+		"heap > 1G",
+		"rss < 1G",
+		"rss > 1G after 5m",
+		"cpu > 95% for ever",
+	}
+	for _, input := range invalid {
+		if _, err := ParseRestartRule(input); err == nil {
+			t.Errorf("expected error parsing %q", input)
+		}
+	}
+}
+
+func TestCheckRestartRules(t *testing.T) {
+	rss, _ := ParseRestartRule("rss > 100 for 10s")
+	fds, _ := ParseRestartRule("fds > 10")
+
+	proc := NewProcess("app", "app")
+	proc.RestartRules = []*RestartRule{rss, fds}
+
+	start := time.Now()
+	sample := func(pid int, at time.Duration, rss uint64, fds int) *Sample {
+		return &Sample{Pid: pid, Time: start.Add(at), RSS: rss, FDs: fds}
+	}
+
+	steps := []struct {
+		sample   *Sample
+		expected *RestartRule
+	}{
+		{sample(1, 0, 200, 0), nil},
+		{sample(1, 5*time.Second, 50, 0), nil},
+		{sample(1, 10*time.Second, 200, 0), nil},
+		{sample(1, 15*time.Second, 200, 0), nil},
+		{sample(1, 20*time.Second, 200, 0), rss},
+
+		// Rules start over once one fires
+		{sample(1, 25*time.Second, 200, 0), nil},
+
+		// and for a new instance
+		{sample(2, 30*time.Second, 200, 0), nil},
+		{sample(2, 35*time.Second, 200, 20), fds},
+	}
+	for i, step := range steps {
+		if rule := proc.CheckRestartRules(step.sample); rule != step.expected {
+			t.Fatalf("step %d: expected %v, got %v", i, step.expected, rule)
+		}
+	}
+}
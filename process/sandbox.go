@@ -0,0 +1,183 @@
+package process
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// SandboxConfig isolates a process from the rest of the system using Linux
+// namespaces, mounts and capabilities, without a container runtime.
+type SandboxConfig struct {
+	// Namespaces are the new namespaces the process runs in, any of mount,
+	// pid, network, uts and ipc. A pid namespace implies a mount namespace.
+	// A process in its own network namespace only has a loopback
+	// interface, which is down. In a pid namespace the process runs under
+	// a minimal init, as PID 1 ignores signals it doesn't handle, which
+	// passes on signals and exits with its status, plus 128 for a signal.
+	// The kill signal is sent to everything in the namespace, unless the
+	// kill mode is main.
+	Namespaces []string `mapstructure:"namespaces"`
+
+	// PrivateTmp gives the process an empty /tmp of its own, which is gone
+	// once it exits. It implies a mount namespace.
+	PrivateTmp bool `mapstructure:"private_tmp"`
+
+	// ReadOnlyPaths are made read-only for the process by bind mounting
+	// them onto themselves. It implies a mount namespace.
+	ReadOnlyPaths []string `mapstructure:"read_only_paths"`
+
+	// NoNewPrivileges stops the process and its children gaining privileges
+	// through setuid binaries or file capabilities.
+	NoNewPrivileges bool `mapstructure:"no_new_privileges"`
+
+	// Capabilities, if set, are the only capabilities the process can have,
+	// such as ["CAP_NET_BIND_SERVICE"]. They are raised as ambient
+	// capabilities so they are kept by a process which isn't run as root.
+	// An empty list drops every capability.
+	Capabilities []string `mapstructure:"capabilities"`
+}
+
+// Sandbox is the parsed sandbox of a process
+type Sandbox struct {
+	// Cloneflags are the namespaces the process is started in
+	Cloneflags uintptr `json:"cloneflags"`
+
+	PrivateTmp      bool     `json:"private_tmp"`
+	ReadOnlyPaths   []string `json:"read_only_paths"`
+	NoNewPrivileges bool     `json:"no_new_privileges"`
+
+	// Capabilities are the capabilities kept, or nil to keep them all
+	Capabilities []uintptr `json:"capabilities"`
+}
+
+// sandboxNamespaces are the clone flags of each namespace, which are the
+// same on every architecture
+var sandboxNamespaces = map[string]uintptr{
+	"mount":   0x00020000,
+	"uts":     0x04000000,
+	"ipc":     0x08000000,
+	"pid":     0x20000000,
+	"network": 0x40000000,
+}
+
+const cloneNewNS = 0x00020000
+const cloneNewPID = 0x20000000
+
+// capabilities are the numbers of the Linux capabilities by name
+var capabilities = map[string]uintptr{
+	"CAP_CHOWN":              0,
+	"CAP_DAC_OVERRIDE":       1,
+	"CAP_DAC_READ_SEARCH":    2,
+	"CAP_FOWNER":             3,
+	"CAP_FSETID":             4,
+	"CAP_KILL":               5,
+	"CAP_SETGID":             6,
+	"CAP_SETUID":             7,
+	"CAP_SETPCAP":            8,
+	"CAP_LINUX_IMMUTABLE":    9,
+	"CAP_NET_BIND_SERVICE":   10,
+	"CAP_NET_BROADCAST":      11,
+	"CAP_NET_ADMIN":          12,
+	"CAP_NET_RAW":            13,
+	"CAP_IPC_LOCK":           14,
+	"CAP_IPC_OWNER":          15,
+	"CAP_SYS_MODULE":         16,
+	"CAP_SYS_RAWIO":          17,
+	"CAP_SYS_CHROOT":         18,
+	"CAP_SYS_PTRACE":         19,
+	"CAP_SYS_PACCT":          20,
+	"CAP_SYS_ADMIN":          21,
+	"CAP_SYS_BOOT":           22,
+	"CAP_SYS_NICE":           23,
+	"CAP_SYS_RESOURCE":       24,
+	"CAP_SYS_TIME":           25,
+	"CAP_SYS_TTY_CONFIG":     26,
+	"CAP_MKNOD":              27,
+	"CAP_LEASE":              28,
+	"CAP_AUDIT_WRITE":        29,
+	"CAP_AUDIT_CONTROL":      30,
+	"CAP_SETFCAP":            31,
+	"CAP_MAC_OVERRIDE":       32,
+	"CAP_MAC_ADMIN":          33,
+	"CAP_SYSLOG":             34,
+	"CAP_WAKE_ALARM":         35,
+	"CAP_BLOCK_SUSPEND":      36,
+	"CAP_AUDIT_READ":         37,
+	"CAP_PERFMON":            38,
+	"CAP_BPF":                39,
+	"CAP_CHECKPOINT_RESTORE": 40,
+}
+
+// ParseSandbox parses the sandbox of a process config, returning nil if it
+// has none
+func ParseSandbox(conf *SandboxConfig) (*Sandbox, error) {
+	if conf == nil {
+		return nil, nil
+	}
+
+	s := &Sandbox{
+		PrivateTmp:      conf.PrivateTmp,
+		NoNewPrivileges: conf.NoNewPrivileges,
+	}
+
+	for _, ns := range conf.Namespaces {
+		flag, ok := sandboxNamespaces[strings.ToLower(ns)]
+		if !ok {
+			return nil, fmt.Errorf("unknown namespace: %s", ns)
+		}
+		s.Cloneflags |= flag
+	}
+
+	for _, path := range conf.ReadOnlyPaths {
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("read-only path %s is not absolute", path)
+		}
+		s.ReadOnlyPaths = append(s.ReadOnlyPaths, filepath.Clean(path))
+	}
+
+	// A pid namespace needs its own /proc mounted to hide the host's
+	// processes
+	if s.PrivateTmp || len(s.ReadOnlyPaths) > 0 || s.Cloneflags&cloneNewPID != 0 {
+		s.Cloneflags |= cloneNewNS
+	}
+
+	if conf.Capabilities != nil {
+		s.Capabilities = []uintptr{}
+		for _, name := range conf.Capabilities {
+			name = strings.ToUpper(name)
+			if !strings.HasPrefix(name, "CAP_") {
+				name = "CAP_" + name
+			}
+
+			c, ok := capabilities[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown capability: %s", name)
+			}
+			s.Capabilities = append(s.Capabilities, c)
+		}
+	}
+
+	return s, nil
+}
+
+// needsShim reports whether any of the sandbox is set up by the shim
+func (s *Sandbox) needsShim() bool {
+	return s.Cloneflags&cloneNewNS != 0 || s.NoNewPrivileges || s.Capabilities != nil
+}
+
+// pidNamespace reports whether the process is started in its own pid
+// namespace, which the shim stays in as init
+func (s *Sandbox) pidNamespace() bool {
+	return s != nil && s.Cloneflags&cloneNewPID != 0
+}
+
+// keeps reports whether a capability is kept
+func (s *Sandbox) keeps(c uintptr) bool {
+	for _, kept := range s.Capabilities {
+		if kept == c {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	prCapbsetDrop   = 24
+	prSetNoNewPrivs = 38
+)
+
+// setAttr has the process started in its namespaces, with its capabilities
+// raised as ambient capabilities
+func (s *Sandbox) setAttr(attr *syscall.SysProcAttr) error {
+	attr.Cloneflags |= s.Cloneflags
+	attr.AmbientCaps = append(attr.AmbientCaps, s.Capabilities...)
+	return nil
+}
+
+// apply sets up the sandbox from within the process before it execs. It
+// is already in its namespaces.
+func (s *Sandbox) apply() error {
+	if s.Cloneflags&cloneNewNS != 0 {
+		if err := s.mount(); err != nil {
+			return err
+		}
+	}
+
+	// Capabilities outside the bounding set can't be gained by exec, even
+	// by root
+	if s.Capabilities != nil {
+		last, err := lastCap()
+		if err != nil {
+			return err
+		}
+		for c := uintptr(0); c <= last; c++ {
+			if s.keeps(c) {
+				continue
+			}
+			if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapbsetDrop, c, 0); errno != 0 {
+				return fmt.Errorf("unable to drop capability %d: %s", c, errno)
+			}
+		}
+	}
+
+	if s.NoNewPrivileges {
+		if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+			return fmt.Errorf("unable to set no_new_privs: %s", errno)
+		}
+	}
+	return nil
+}
+
+// mount sets up the mounts of the process in its own mount namespace
+func (s *Sandbox) mount() error {
+	// Keep the mounts from propagating back to the rest of the system
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("unable to make mounts private: %s", err)
+	}
+
+	// Only show the processes in its own pid namespace
+	if s.Cloneflags&cloneNewPID != 0 {
+		flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC)
+		if err := syscall.Mount("proc", "/proc", "proc", flags, ""); err != nil {
+			return fmt.Errorf("unable to mount /proc: %s", err)
+		}
+	}
+
+	if s.PrivateTmp {
+		flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
+		if err := syscall.Mount("tmpfs", "/tmp", "tmpfs", flags, "mode=1777"); err != nil {
+			return fmt.Errorf("unable to mount private /tmp: %s", err)
+		}
+	}
+
+	for _, path := range s.ReadOnlyPaths {
+		if err := syscall.Mount(path, path, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return fmt.Errorf("unable to bind mount %s: %s", path, err)
+		}
+		flags := uintptr(syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY)
+		if err := syscall.Mount("", path, "", flags, ""); err != nil {
+			return fmt.Errorf("unable to make %s read-only: %s", path, err)
+		}
+	}
+	return nil
+}
+
+// lastCap reads the highest capability the kernel supports
+func lastCap() (uintptr, error) {
+	data, err := ioutil.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return 0, err
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, err
+	}
+	return uintptr(last), nil
+}
@@ -0,0 +1,139 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestExec_sandbox(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("sandboxing needs root")
+	}
+
+	marker, err := ioutil.TempFile("/tmp", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	marker.Close()
+	defer os.Remove(marker.Name())
+	defer os.Remove("/etc/watchdog-sandbox-test")
+
+	script := `
+echo pid=$$
+ls /tmp | wc -l
+touch /etc/watchdog-sandbox-test 2>/dev/null && echo writable || echo read-only
+grep -E "^(CapBnd|NoNewPrivs)" /proc/self/status | tr -s '\t' ' '
+`
+	proc := NewProcess("sandboxed", "/bin/sh", "-c", script)
+	proc.Sandbox, err = ParseSandbox(&SandboxConfig{
+		Namespaces:      []string{"pid"},
+		PrivateTmp:      true,
+		ReadOnlyPaths:   []string{"/etc"},
+		NoNewPrivileges: true,
+		Capabilities:    []string{"CAP_NET_BIND_SERVICE"},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	outChan := make(chan *Record, 10)
+	statusChan := make(chan int, 1)
+
+	runner := &DefaultRunner{}
+	if _, err := runner.Exec(proc, outChan, statusChan); err != nil {
+		if strings.Contains(err.Error(), "operation not permitted") {
+			t.Skipf("namespaces aren't available: %s", err)
+		}
+		t.Fatalf("err: %s", err)
+	}
+
+	select {
+	case <-statusChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Exec timed out")
+	}
+
+	var lines []string
+	for len(outChan) > 0 {
+		lines = append(lines, string((<-outChan).Line))
+	}
+
+	// The shim is init of the namespace
+	expected := []string{"0", "read-only", "CapBnd: 0000000000000400", "NoNewPrivs: 1"}
+	if len(lines) != 5 || lines[0] == "pid=1" || strings.Join(lines[1:], "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected output: %q", lines)
+	}
+}
+
+func TestExec_sandboxPidNamespace(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("sandboxing needs root")
+	}
+
+	// Only the process itself and the shim are in its /proc
+	proc := NewProcess("sandboxed", "/bin/sh", "-c", "echo /proc/[0-9]*")
+	var err error
+	proc.Sandbox, err = ParseSandbox(&SandboxConfig{Namespaces: []string{"pid"}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	outChan := make(chan *Record, 10)
+	statusChan := make(chan int, 1)
+
+	runner := &DefaultRunner{}
+	if _, err := runner.Exec(proc, outChan, statusChan); err != nil {
+		if strings.Contains(err.Error(), "operation not permitted") {
+			t.Skipf("namespaces aren't available: %s", err)
+		}
+		t.Fatalf("err: %s", err)
+	}
+
+	select {
+	case <-statusChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Exec timed out")
+	}
+
+	procs := strings.Fields(string((<-outChan).Line))
+	if len(procs) != 2 || procs[0] != "/proc/1" {
+		t.Fatalf("unexpected output: %q", procs)
+	}
+}
+
+func TestProcessStop_sandboxPidNamespace(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("sandboxing needs root")
+	}
+
+	proc := NewProcess("sandboxed", "/bin/sleep", "30")
+	var err error
+	proc.Sandbox, err = ParseSandbox(&SandboxConfig{Namespaces: []string{"pid"}})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	proc.KillTimeout = 5 * time.Second
+	proc.Run()
+	if err := proc.Start(); err != nil {
+		if strings.Contains(err.Error(), "operation not permitted") {
+			t.Skipf("namespaces aren't available: %s", err)
+		}
+		t.Fatalf("err: %s", err)
+	}
+
+	// The kill signal reaches sleep rather than being dropped by init
+	start := time.Now()
+	if err := proc.StopWait(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed >= proc.KillTimeout {
+		t.Fatalf("expected sleep to stop before it was killed, took %s", elapsed)
+	}
+	if proc.LastExitStatus != 128+int(syscall.SIGQUIT) {
+		t.Fatalf("expected exit by SIGQUIT, got %d", proc.LastExitStatus)
+	}
+}
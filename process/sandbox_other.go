@@ -0,0 +1,18 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Sandboxing is only supported on Linux
+func (s *Sandbox) setAttr(attr *syscall.SysProcAttr) error {
+	return fmt.Errorf("sandboxing is not supported on this platform")
+}
+
+func (s *Sandbox) apply() error {
+	return fmt.Errorf("sandboxing is not supported on this platform")
+}
@@ -0,0 +1,63 @@
+package process
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSandbox(t *testing.T) {
+	config, err := DecodeConfigFromJSON(strings.NewReader(`{
+		"name": "worker",
+		"program": "/usr/local/bin/worker",
+		"sandbox": {
+			"namespaces": ["pid", "network"],
+			"private_tmp": true,
+			"read_only_paths": ["/etc/"],
+			"no_new_privileges": true,
+			"capabilities": ["net_bind_service"]
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	s := NewProcessFromConfig(config).Sandbox
+	if s == nil {
+		t.Fatal("expected sandbox")
+	}
+	if s.Cloneflags != cloneNewPID|0x40000000|cloneNewNS {
+		t.Errorf("unexpected clone flags: %x", s.Cloneflags)
+	}
+	if len(s.ReadOnlyPaths) != 1 || s.ReadOnlyPaths[0] != "/etc" || !s.PrivateTmp || !s.NoNewPrivileges {
+		t.Errorf("unexpected sandbox: %#v", s)
+	}
+	if len(s.Capabilities) != 1 || !s.keeps(10) || !s.needsShim() {
+		t.Errorf("unexpected capabilities: %v", s.Capabilities)
+	}
+
+	// A pid namespace has its own /proc mounted
+	s, err = ParseSandbox(&SandboxConfig{Namespaces: []string{"pid"}})
+	if err != nil || s.Cloneflags != cloneNewPID|cloneNewNS || !s.needsShim() {
+		t.Errorf("expected a mount namespace: %#v, %v", s, err)
+	}
+
+	// An empty list of capabilities drops them all
+	config, _ = DecodeConfigFromJSON(strings.NewReader(`{"sandbox": {"capabilities": []}}`))
+	if s, err := ParseSandbox(config.Sandbox); err != nil || s.Capabilities == nil {
+		t.Errorf("expected every capability to be dropped: %#v, %v", s, err)
+	}
+
+	invalid := []*SandboxConfig{
+		{Namespaces: []string{"user"}},
+		{ReadOnlyPaths: []string{"etc"}},
+		{Capabilities: []string{"CAP_EVERYTHING"}},
+	}
+	for _, conf := range invalid {
+		if _, err := ParseSandbox(conf); err == nil {
+			t.Errorf("expected error parsing %#v", conf)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package process
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// IO scheduling classes, as used by ionice
+const (
+	IOClassNone = iota
+	IOClassRealtime
+	IOClassBestEffort
+	IOClassIdle
+)
+
+// maxCPUs is the most CPUs an affinity can include
+const maxCPUs = 1024
+
+// Scheduling is how the kernel schedules a process relative to others, and
+// how likely the OOM killer is to pick it
+type Scheduling struct {
+	// Nice is the process's nice value, from -20 to 19, if set
+	Nice *int `json:"nice,omitempty"`
+
+	// IOClass is the IO scheduling class, IOClassNone to leave it alone, and
+	// IOPriority the priority within it from 0, the highest, to 7
+	IOClass    int `json:"io_class"`
+	IOPriority int `json:"io_priority"`
+
+	// CPUAffinity are the CPUs the process can run on, any if empty
+	CPUAffinity []int `json:"cpu_affinity,omitempty"`
+
+	// OOMScoreAdjust is the process's oom_score_adj, from -1000 to 1000, if
+	// set
+	OOMScoreAdjust *int `json:"oom_score_adjust,omitempty"`
+}
+
+// ParseScheduling parses the scheduling options of a process config,
+// returning nil if none are set
+func ParseScheduling(conf *ProcessConfig) (*Scheduling, error) {
+	s := new(Scheduling)
+
+	if conf.Nice != nil {
+		if *conf.Nice < -20 || *conf.Nice > 19 {
+			return nil, fmt.Errorf("invalid nice: %d is not between -20 and 19", *conf.Nice)
+		}
+		nice := *conf.Nice
+		s.Nice = &nice
+	}
+
+	switch strings.ToLower(conf.IOClass) {
+	case "":
+		if conf.IOPriority != nil {
+			s.IOClass = IOClassBestEffort
+		}
+	case "realtime", "rt":
+		s.IOClass = IOClassRealtime
+	case "best-effort", "best_effort", "be":
+		s.IOClass = IOClassBestEffort
+	case "idle":
+		s.IOClass = IOClassIdle
+	default:
+		return nil, fmt.Errorf("invalid io_class: %s", conf.IOClass)
+	}
+
+	// The default priority within the class, as with ionice
+	s.IOPriority = 4
+	if conf.IOPriority != nil {
+		if *conf.IOPriority < 0 || *conf.IOPriority > 7 {
+			return nil, fmt.Errorf("invalid io_priority: %d is not between 0 and 7", *conf.IOPriority)
+		}
+		if s.IOClass == IOClassIdle {
+			return nil, fmt.Errorf("invalid io_priority: the idle class has no priorities")
+		}
+		s.IOPriority = *conf.IOPriority
+	}
+	if s.IOClass == IOClassNone || s.IOClass == IOClassIdle {
+		s.IOPriority = 0
+	}
+
+	if conf.CPUAffinity != nil {
+		cpus, err := parseCPUList(conf.CPUAffinity)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cpu_affinity: %s", err)
+		}
+		s.CPUAffinity = cpus
+	}
+
+	if conf.OOMScoreAdjust != nil {
+		if *conf.OOMScoreAdjust < -1000 || *conf.OOMScoreAdjust > 1000 {
+			return nil, fmt.Errorf("invalid oom_score_adjust: %d is not between -1000 and 1000", *conf.OOMScoreAdjust)
+		}
+		adjust := *conf.OOMScoreAdjust
+		s.OOMScoreAdjust = &adjust
+	}
+
+	if s.Nice == nil && s.IOClass == IOClassNone && len(s.CPUAffinity) == 0 && s.OOMScoreAdjust == nil {
+		return nil, nil
+	}
+	return s, nil
+}
+
+// parseCPUList parses a list of CPUs, either a string such as "0-3,8" or a
+// list of CPU numbers and ranges
+func parseCPUList(value interface{}) ([]int, error) {
+	var parts []string
+	switch v := value.(type) {
+	case string:
+		parts = strings.Split(v, ",")
+	case []interface{}:
+		for _, item := range v {
+			switch n := item.(type) {
+			case string:
+				parts = append(parts, n)
+			default:
+				cpu, err := limitNumber(n)
+				if err != nil {
+					return nil, err
+				}
+				parts = append(parts, strconv.FormatUint(cpu, 10))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unexpected value %v", value)
+	}
+
+	seen := make(map[int]bool)
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		first, last := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			first, last = part[:i], part[i+1:]
+		}
+
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a CPU or range of CPUs", part)
+		}
+		to, err := strconv.Atoi(last)
+		if err != nil || to < from || from < 0 {
+			return nil, fmt.Errorf("%q is not a CPU or range of CPUs", part)
+		}
+		if to >= maxCPUs {
+			return nil, fmt.Errorf("CPU %d is above %d", to, maxCPUs-1)
+		}
+
+		for cpu := from; cpu <= to; cpu++ {
+			seen[cpu] = true
+		}
+	}
+	if len(seen) == 0 {
+		return nil, fmt.Errorf("no CPUs given")
+	}
+
+	cpus := make([]int, 0, len(seen))
+	for cpu := range seen {
+		cpus = append(cpus, cpu)
+	}
+	sort.Ints(cpus)
+	return cpus, nil
+}
+
+// IOString describes the IO class and priority, as ionice does
+func (s *Scheduling) IOString() string {
+	switch s.IOClass {
+	case IOClassRealtime:
+		return fmt.Sprintf("realtime: prio %d", s.IOPriority)
+	case IOClassBestEffort:
+		return fmt.Sprintf("best-effort: prio %d", s.IOPriority)
+	case IOClassIdle:
+		return "idle"
+	}
+	return ""
+}
+
+// AffinityString describes the CPU affinity as a list of CPUs and ranges
+func (s *Scheduling) AffinityString() string {
+	var parts []string
+	cpus := s.CPUAffinity
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(cpus[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
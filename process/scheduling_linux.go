@@ -0,0 +1,51 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+const ioprioWhoProcess = 1
+
+// apply sets the scheduling of the calling process. Nice values, IO
+// priorities and affinities belong to threads on Linux, so it must be called
+// from the thread which execs the process.
+func (s *Scheduling) apply() error {
+	if s.Nice != nil {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, *s.Nice); err != nil {
+			return fmt.Errorf("unable to set nice: %s", err)
+		}
+	}
+
+	if s.IOClass != IOClassNone {
+		ioprio := uintptr(s.IOClass<<13 | s.IOPriority)
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, 0, ioprio); errno != 0 {
+			return fmt.Errorf("unable to set io priority: %s", errno)
+		}
+	}
+
+	if len(s.CPUAffinity) > 0 {
+		var mask [maxCPUs / 64]uint64
+		for _, cpu := range s.CPUAffinity {
+			mask[cpu/64] |= 1 << uint(cpu%64)
+		}
+		_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+		if errno != 0 {
+			return fmt.Errorf("unable to set cpu affinity: %s", errno)
+		}
+	}
+
+	if s.OOMScoreAdjust != nil {
+		adjust := []byte(strconv.Itoa(*s.OOMScoreAdjust))
+		if err := ioutil.WriteFile("/proc/self/oom_score_adj", adjust, 0644); err != nil {
+			return fmt.Errorf("unable to set oom_score_adj: %s", err)
+		}
+	}
+	return nil
+}
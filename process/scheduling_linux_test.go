@@ -0,0 +1,47 @@
+package process
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExec_scheduling(t *testing.T) {
+	script := `
+cut -d' ' -f19 /proc/self/stat
+cat /proc/self/oom_score_adj
+grep Cpus_allowed_list /proc/self/status | tr -s '\t' ' '
+`
+	proc := NewProcess("scheduled", "/bin/sh", "-c", script)
+	nice, adjust := 7, 300
+	proc.Scheduling = &Scheduling{
+		Nice:           &nice,
+		IOClass:        IOClassIdle,
+		CPUAffinity:    []int{0},
+		OOMScoreAdjust: &adjust,
+	}
+
+	outChan := make(chan *Record, 10)
+	statusChan := make(chan int, 1)
+
+	runner := &DefaultRunner{}
+	if _, err := runner.Exec(proc, outChan, statusChan); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	select {
+	case <-statusChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Exec timed out")
+	}
+
+	var lines []string
+	for len(outChan) > 0 {
+		lines = append(lines, string((<-outChan).Line))
+	}
+
+	expected := []string{"7", "300", "Cpus_allowed_list: 0"}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected output: %q", lines)
+	}
+}
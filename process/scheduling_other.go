@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// apply sets the scheduling of the calling process. Only the nice value is
+// supported outside Linux.
+func (s *Scheduling) apply() error {
+	if s.IOClass != IOClassNone || len(s.CPUAffinity) > 0 || s.OOMScoreAdjust != nil {
+		return fmt.Errorf("io priority, cpu affinity and oom_score_adj are only supported on Linux")
+	}
+
+	if s.Nice != nil {
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, 0, *s.Nice); err != nil {
+			return fmt.Errorf("unable to set nice: %s", err)
+		}
+	}
+	return nil
+}
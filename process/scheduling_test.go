@@ -0,0 +1,72 @@
+package process
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseScheduling(t *testing.T) {
+	config, err := DecodeConfigFromJSON(strings.NewReader(`{
+		"name": "worker",
+		"program": "/usr/local/bin/worker",
+		"nice": -5,
+		"io_class": "best-effort",
+		"io_priority": 2,
+		"cpu_affinity": "0-3,8,2",
+		"oom_score_adjust": 500
+	}`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	s := NewProcessFromConfig(config).Scheduling
+	if s == nil || s.Nice == nil || *s.Nice != -5 || s.OOMScoreAdjust == nil || *s.OOMScoreAdjust != 500 {
+		t.Fatalf("unexpected scheduling: %#v", s)
+	}
+	if s.IOString() != "best-effort: prio 2" {
+		t.Errorf("unexpected io: %s", s.IOString())
+	}
+	if !reflect.DeepEqual(s.CPUAffinity, []int{0, 1, 2, 3, 8}) || s.AffinityString() != "0-3,8" {
+		t.Errorf("unexpected affinity: %v", s.CPUAffinity)
+	}
+
+	// Affinities may be lists, and a priority alone implies best-effort
+	config, _ = DecodeConfigFromJSON(strings.NewReader(`{"cpu_affinity": [1, "4-5"], "io_priority": 7}`))
+	s, err = ParseScheduling(config)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if s.AffinityString() != "1,4-5" || s.IOString() != "best-effort: prio 7" || s.Nice != nil {
+		t.Errorf("unexpected scheduling: %#v", s)
+	}
+
+	config, _ = DecodeConfigFromJSON(strings.NewReader(`{"name": "worker"}`))
+	if s, err := ParseScheduling(config); s != nil || err != nil {
+		t.Errorf("expected no scheduling: %#v, %v", s, err)
+	}
+
+	invalid := []string{
+		`{"nice": 20}`,
+		`{"io_class": "fast"}`,
+		`{"io_priority": 8}`,
+		`{"io_class": "idle", "io_priority": 1}`,
+		`{"cpu_affinity": "3-1"}`,
+		`{"cpu_affinity": "0,x"}`,
+		`{"cpu_affinity": [4096]}`,
+		`{"cpu_affinity": ""}`,
+		`{"oom_score_adjust": -1001}`,
+	}
+	for _, in := range invalid {
+		config, err := DecodeConfigFromJSON(strings.NewReader(in))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if _, err := ParseScheduling(config); err == nil {
+			t.Errorf("expected error parsing %s", in)
+		}
+	}
+}
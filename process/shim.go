@@ -0,0 +1,190 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// Settings Go can't apply to a child between fork and exec, such as resource
+// limits, are applied by a shim. The agent runs its own binary as the shim,
+// with the settings in its environment, and the shim applies them and execs
+// the command in its place, keeping its pid. It reports failure on a status
+// pipe which is closed by a successful exec.
+
+// execShimName is argv[0] of the agent binary when it is run as the shim
+const execShimName = "watchdog-exec"
+
+// execSpecEnv holds the settings for the shim to apply
+const execSpecEnv = "WATCHDOG_EXEC_SPEC"
+
+// execShimStatusFd is the status pipe of the shim
+const execShimStatusFd = 3
+
+// execSpec is what the shim applies before exec'ing the command
+type execSpec struct {
+	Limits     []Limit     `json:"limits,omitempty"`
+	Sandbox    *Sandbox    `json:"sandbox,omitempty"`
+	Scheduling *Scheduling `json:"scheduling,omitempty"`
+
+	// RootDirectory is chrooted to by the shim rather than before it is
+	// exec'd, so that the agent's binary can be found to run as the shim
+	RootDirectory string `json:"root_directory,omitempty"`
+	Umask         *int   `json:"umask,omitempty"`
+
+	// Init keeps the shim running as init of the command's pid namespace,
+	// rather than exec'ing it
+	Init *shimInit `json:"init,omitempty"`
+}
+
+// newExecSpec returns the settings the shim applies for a process, or nil if
+// it doesn't need one
+func newExecSpec(p *Process) *execSpec {
+	spec := &execSpec{
+		Limits:        p.Limits,
+		Scheduling:    p.Scheduling,
+		RootDirectory: p.RootDirectory,
+		Umask:         p.Umask,
+	}
+	if p.Sandbox != nil && p.Sandbox.needsShim() {
+		spec.Sandbox = p.Sandbox
+	}
+	if p.Sandbox.pidNamespace() {
+		spec.Init = &shimInit{
+			KillSignal: p.killSignal(),
+			MainOnly:   p.KillMode == KillModeMain,
+		}
+	}
+
+	if len(spec.Limits) == 0 && spec.Sandbox == nil && spec.Scheduling == nil &&
+		spec.RootDirectory == "" && spec.Umask == nil {
+		return nil
+	}
+	return spec
+}
+
+func (s *execSpec) apply() error {
+	// The sandbox's paths and the scheduling's /proc are outside the root
+	// directory, so they are set up before the chroot
+	if s.Sandbox != nil {
+		if err := s.Sandbox.apply(); err != nil {
+			return err
+		}
+	}
+	if s.Scheduling != nil {
+		if err := s.Scheduling.apply(); err != nil {
+			return err
+		}
+	}
+	if s.RootDirectory != "" {
+		if err := syscall.Chroot(s.RootDirectory); err != nil {
+			return fmt.Errorf("unable to chroot to %s: %s", s.RootDirectory, err)
+		}
+		if err := syscall.Chdir("/"); err != nil {
+			return fmt.Errorf("unable to chdir to /: %s", err)
+		}
+	}
+	if s.Umask != nil {
+		syscall.Umask(*s.Umask)
+	}
+	return setLimits(s.Limits)
+}
+
+func init() {
+	if len(os.Args) > 1 && os.Args[0] == execShimName {
+		runExecShim()
+	}
+}
+
+// runExecShim applies the settings in the environment and execs the command
+// in the remaining arguments. It never returns.
+func runExecShim() {
+	// Scheduling is applied to the thread which execs the command
+	runtime.LockOSThread()
+
+	status := os.NewFile(execShimStatusFd, "status")
+	fail := func(err error) {
+		fmt.Fprint(status, err)
+		os.Exit(127)
+	}
+	syscall.CloseOnExec(execShimStatusFd)
+
+	var spec execSpec
+	if err := json.Unmarshal([]byte(os.Getenv(execSpecEnv)), &spec); err != nil {
+		fail(fmt.Errorf("invalid exec spec: %s", err))
+	}
+	os.Unsetenv(execSpecEnv)
+
+	if err := spec.apply(); err != nil {
+		fail(err)
+	}
+
+	if spec.Init != nil {
+		spec.Init.run(status, fail)
+	}
+
+	err := syscall.Exec(os.Args[1], os.Args[1:], os.Environ())
+	fail(&os.PathError{Op: "exec", Path: os.Args[1], Err: err})
+}
+
+// shimCommand wraps a command so it is started by the shim, which applies
+// spec first. It returns the read end of the status pipe.
+func shimCommand(cmd *exec.Cmd, spec *execSpec) (*os.File, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	shim, err := os.Executable()
+	if runtime.GOOS == "linux" {
+		// Still there if the agent's binary was replaced by an upgrade
+		shim, err = "/proc/self/exe", nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to find executable: %s", err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd.Args = append([]string{execShimName, cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = shim
+	cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", execSpecEnv, data))
+	cmd.ExtraFiles = []*os.File{w}
+	return r, nil
+}
+
+// closeShim closes both ends of the status pipe of a shim which wasn't
+// started
+func closeShim(cmd *exec.Cmd, status *os.File) {
+	status.Close()
+	for _, f := range cmd.ExtraFiles {
+		f.Close()
+	}
+}
+
+// shimStatus waits for the shim started by cmd to exec the command,
+// returning why it couldn't if it failed
+func shimStatus(cmd *exec.Cmd, status *os.File) error {
+	defer status.Close()
+
+	// Only the shim holds the write end now
+	for _, f := range cmd.ExtraFiles {
+		f.Close()
+	}
+
+	msg, err := ioutil.ReadAll(status)
+	if err != nil {
+		return err
+	}
+	if len(msg) > 0 {
+		return fmt.Errorf("%s", msg)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package process
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// The command can't be exec'd as PID 1 of a pid namespace, as the kernel
+// drops signals sent to PID 1 which it has no handler for, so it couldn't be
+// stopped by any signal but SIGKILL. The shim stays as init instead.
+
+// shimInit is how the shim passes on signals as init
+type shimInit struct {
+	// KillSignal is sent to everything in the namespace, unless MainOnly
+	KillSignal syscall.Signal `json:"kill_signal"`
+	MainOnly   bool           `json:"main_only"`
+}
+
+// initSignals are the signals init passes on to the command
+var initSignals = []os.Signal{
+	syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGABRT,
+	syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGTERM, syscall.SIGWINCH,
+}
+
+// run starts the command as the only child of the shim and waits for it,
+// passing on signals and reaping whatever else exits in the namespace. It
+// exits with the command's status, which kills the rest of the namespace.
+func (i *shimInit) run(status *os.File, fail func(error)) {
+	sigCh := make(chan os.Signal, 16)
+	signal.Notify(sigCh, append(initSignals, i.KillSignal, syscall.SIGCHLD)...)
+
+	pid, err := syscall.ForkExec(os.Args[1], os.Args[1:], &syscall.ProcAttr{
+		Env:   os.Environ(),
+		Files: []uintptr{0, 1, 2},
+	})
+	if err != nil {
+		fail(&os.PathError{Op: "exec", Path: os.Args[1], Err: err})
+	}
+	status.Close()
+
+	for sig := range sigCh {
+		if sig == syscall.SIGCHLD {
+			if ws, exited := reapAll(pid); exited {
+				os.Exit(waitStatus(ws))
+			}
+			continue
+		}
+
+		// Init is left out of a signal to every process, so isn't sent
+		// its own signal again
+		target := pid
+		if sig == i.KillSignal && !i.MainOnly {
+			target = -1
+		}
+		syscall.Kill(target, sig.(syscall.Signal))
+	}
+}
+
+// reapAll reaps every child which has exited, returning the status of the
+// command if it is one of them
+func reapAll(pid int) (syscall.WaitStatus, bool) {
+	var status syscall.WaitStatus
+	exited := false
+	for {
+		var ws syscall.WaitStatus
+		child, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+		if err != nil || child <= 0 {
+			return status, exited
+		}
+		if child == pid {
+			status, exited = ws, true
+		}
+	}
+}
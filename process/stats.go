@@ -0,0 +1,86 @@
+package process
+
+import (
+	"fmt"
+	"time"
+)
+
+// StatsHistory is how many samples of its resource usage a process keeps
+var StatsHistory = 60
+
+// Sample is the resource usage of a running process at a point in time
+type Sample struct {
+	Time time.Time `json:"time"`
+	Pid  int       `json:"pid"`
+
+	// CPUTime is the user and system CPU time the process has used
+	CPUTime time.Duration `json:"cpu_time"`
+
+	// CPUPercent is the CPU the process used since the previous sample, 100
+	// for each CPU kept busy, or 0 for the first sample of an instance
+	CPUPercent float64 `json:"cpu_percent"`
+
+	// RSS is the resident memory of the process in bytes
+	RSS uint64 `json:"rss"`
+
+	FDs     int `json:"fds"`
+	Threads int `json:"threads"`
+
+	// ReadBytes and WriteBytes are the bytes the process has read from and
+	// written to storage
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+
+	// The usage of everything in the process's cgroup, including what it
+	// started, if it runs in one
+	CgroupMemory  uint64        `json:"cgroup_memory"`
+	CgroupCPUTime time.Duration `json:"cgroup_cpu_time"`
+	CgroupPids    int           `json:"cgroup_pids"`
+}
+
+// Sample measures the resource usage of the running instance of the process
+// and adds it to its history
+func (p *Process) Sample() (*Sample, error) {
+	pid := p.PID()
+	if pid == 0 {
+		return nil, fmt.Errorf("process is not running: %s", p.Name)
+	}
+
+	s, err := samplePid(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	p.Lock()
+	cg := p.cgroup
+	p.Unlock()
+	if cg != nil {
+		cg.sample(s)
+	}
+
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	if n := len(p.stats); n > 0 {
+		last := p.stats[n-1]
+		if elapsed := s.Time.Sub(last.Time); last.Pid == pid && elapsed > 0 {
+			s.CPUPercent = 100 * float64(s.CPUTime-last.CPUTime) / float64(elapsed)
+		}
+	}
+
+	p.stats = append(p.stats, *s)
+	if len(p.stats) > StatsHistory {
+		p.stats = p.stats[len(p.stats)-StatsHistory:]
+	}
+	return s, nil
+}
+
+// Stats returns the history of samples of the process, oldest first
+func (p *Process) Stats() []Sample {
+	p.statsMu.Lock()
+	defer p.statsMu.Unlock()
+
+	stats := make([]Sample, len(p.stats))
+	copy(stats, p.stats)
+	return stats
+}
@@ -0,0 +1,83 @@
+//go:build linux
+// +build linux
+
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// samplePid reads the resource usage of a process from /proc
+func samplePid(pid int) (*Sample, error) {
+	s := &Sample{Time: time.Now(), Pid: pid}
+
+	fields, err := procStat(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	// utime, stime, num_threads and rss are the 14th, 15th, 20th and 24th
+	// fields of stat
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	s.CPUTime = time.Duration(utime+stime) * time.Second / clockTicks
+	s.Threads, _ = strconv.Atoi(fields[17])
+	if len(fields) > 21 {
+		pages, _ := strconv.ParseUint(fields[21], 10, 64)
+		s.RSS = pages * uint64(os.Getpagesize())
+	}
+
+	if dir, err := os.Open(fmt.Sprintf("/proc/%d/fd", pid)); err == nil {
+		names, _ := dir.Readdirnames(-1)
+		dir.Close()
+		s.FDs = len(names)
+	}
+
+	// Only readable by the process's user or root
+	if data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/io", pid)); err == nil {
+		values := keyedValues(data)
+		s.ReadBytes = values["read_bytes"]
+		s.WriteBytes = values["write_bytes"]
+	}
+
+	return s, nil
+}
+
+// sample adds the usage of everything in the cgroup to a sample
+func (cg *cgroup) sample(s *Sample) {
+	if data, err := ioutil.ReadFile(filepath.Join(cg.path, "memory.current")); err == nil {
+		s.CgroupMemory, _ = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(cg.path, "cpu.stat")); err == nil {
+		s.CgroupCPUTime = time.Duration(keyedValues(data)["usage_usec"]) * time.Microsecond
+	}
+	if pids, err := cg.pids(); err == nil {
+		s.CgroupPids = len(pids)
+	}
+}
+
+// keyedValues parses lines of a key and a number, separated by a space or
+// a colon, as in /proc/<pid>/io and cgroup stat files
+func keyedValues(data []byte) map[string]uint64 {
+	values := make(map[string]uint64)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(strings.Replace(scanner.Text(), ":", " ", 1))
+		if len(fields) != 2 {
+			continue
+		}
+		if n, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = n
+		}
+	}
+	return values
+}
@@ -0,0 +1,45 @@
+package process
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProcessSample(t *testing.T) {
+	defer func(old int) { StatsHistory = old }(StatsHistory)
+	StatsHistory = 2
+
+	proc := NewProcess("sh", "/bin/sh", "-c", "while :; do :; done")
+	proc.KillSignal = syscall.SIGKILL
+	proc.Run()
+
+	if _, err := proc.Sample(); err == nil {
+		t.Fatal("expected error sampling a stopped process")
+	}
+
+	if err := proc.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer proc.StopWait()
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(100 * time.Millisecond)
+		if _, err := proc.Sample(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	stats := proc.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 samples kept, got %d", len(stats))
+	}
+
+	s := stats[1]
+	if s.Pid != proc.PID() || s.RSS == 0 || s.Threads != 1 || s.FDs < 3 {
+		t.Errorf("unexpected sample: %#v", s)
+	}
+	if s.CPUTime == 0 || s.CPUPercent <= 0 {
+		t.Errorf("expected busy loop to use CPU: %#v", s)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package process
+
+import (
+	"fmt"
+)
+
+// samplePid is only supported on Linux
+func samplePid(pid int) (*Sample, error) {
+	return nil, fmt.Errorf("resource usage sampling is not supported on this platform")
+}
+
+func (cg *cgroup) sample(s *Sample) {}
@@ -0,0 +1,82 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// stdinPipePrefix marks a stdin which is a named pipe created by the agent
+const stdinPipePrefix = "pipe:"
+
+// Stdin is where a process reads its standard input from
+type Stdin struct {
+	// Path is the file read from
+	Path string `json:"path"`
+
+	// Pipe is whether Path is a named pipe the agent creates and keeps open,
+	// so that anything written to it is read by the process, which never
+	// reads the end of the file
+	Pipe bool `json:"pipe"`
+}
+
+// ParseStdin parses the stdin of a process config, which is "null", the path
+// of a file, or "pipe:" and the path of a named pipe. It returns nil for the
+// null device.
+func ParseStdin(s string) (*Stdin, error) {
+	if s == "" || s == "null" || s == os.DevNull {
+		return nil, nil
+	}
+
+	stdin := &Stdin{Path: s}
+	if strings.HasPrefix(s, stdinPipePrefix) {
+		stdin.Path = strings.TrimPrefix(s, stdinPipePrefix)
+		stdin.Pipe = true
+	}
+	if !filepath.IsAbs(stdin.Path) {
+		return nil, fmt.Errorf("invalid stdin: %s is not an absolute path", stdin.Path)
+	}
+	stdin.Path = filepath.Clean(stdin.Path)
+	return stdin, nil
+}
+
+func (s *Stdin) String() string {
+	if s.Pipe {
+		return stdinPipePrefix + s.Path
+	}
+	return s.Path
+}
+
+// open opens the file the process reads, creating its named pipe if needed.
+// A named pipe is opened for writing too, so that the process doesn't read
+// the end of it while nothing else has it open.
+func (s *Stdin) open() (*os.File, error) {
+	if !s.Pipe {
+		// Opening a named pipe only for reading would block until it has
+		// a writer
+		f, err := os.OpenFile(s.Path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+		if err != nil {
+			return nil, fmt.Errorf("unable to open stdin: %s", err)
+		}
+		return f, nil
+	}
+
+	if err := syscall.Mkfifo(s.Path, 0600); err != nil && err != syscall.EEXIST {
+		return nil, fmt.Errorf("unable to create stdin pipe %s: %s", s.Path, err)
+	}
+	fi, err := os.Lstat(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create stdin pipe %s: %s", s.Path, err)
+	}
+	if fi.Mode()&os.ModeNamedPipe == 0 {
+		return nil, fmt.Errorf("unable to create stdin pipe %s: a file that isn't a named pipe is in the way", s.Path)
+	}
+
+	f, err := os.OpenFile(s.Path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open stdin pipe: %s", err)
+	}
+	return f, nil
+}
@@ -0,0 +1,100 @@
+package process
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStdin(t *testing.T) {
+	for _, in := range []string{"", "null", "/dev/null"} {
+		if s, err := ParseStdin(in); s != nil || err != nil {
+			t.Errorf("expected the null device for %q: %#v, %v", in, s, err)
+		}
+	}
+
+	s, err := ParseStdin("/var/lib/worker/input")
+	if err != nil || s.Pipe || s.Path != "/var/lib/worker/input" {
+		t.Errorf("unexpected stdin: %#v, %v", s, err)
+	}
+
+	s, err = ParseStdin("pipe:/run/worker.stdin/")
+	if err != nil || !s.Pipe || s.Path != "/run/worker.stdin" || s.String() != "pipe:/run/worker.stdin" {
+		t.Errorf("unexpected stdin: %#v, %v", s, err)
+	}
+
+	for _, in := range []string{"input", "pipe:worker.stdin"} {
+		if _, err := ParseStdin(in); err == nil {
+			t.Errorf("expected error parsing %q", in)
+		}
+	}
+}
+
+func TestExec_stdin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input")
+	if err := ioutil.WriteFile(input, []byte("from a file\n"), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	fifo := filepath.Join(dir, "worker.stdin")
+
+	for _, stdin := range []*Stdin{{Path: input}, {Path: fifo, Pipe: true}} {
+		proc := NewProcess("reader", "/bin/sh", "-c", "read line; echo $line")
+		proc.Stdin = stdin
+
+		outChan := make(chan *Record, 10)
+		statusChan := make(chan int, 1)
+
+		runner := &DefaultRunner{}
+		if _, err := runner.Exec(proc, outChan, statusChan); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		expected := "from a file"
+		if stdin.Pipe {
+			fi, err := os.Stat(fifo)
+			if err != nil || fi.Mode()&os.ModeNamedPipe == 0 || fi.Mode().Perm() != 0600 {
+				t.Fatalf("expected a named pipe: %v, %v", fi, err)
+			}
+
+			// The process holds the pipe open, so this doesn't block
+			f, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			f.Write([]byte("from a pipe\n"))
+			f.Close()
+			expected = "from a pipe"
+		}
+
+		select {
+		case <-statusChan:
+		case <-time.After(2 * time.Second):
+			t.Fatal("Exec timed out")
+		}
+
+		var lines []string
+		for len(outChan) > 0 {
+			lines = append(lines, string((<-outChan).Line))
+		}
+		if strings.Join(lines, "\n") != expected {
+			t.Fatalf("unexpected output: %q", lines)
+		}
+	}
+
+	// Something else in the way of the named pipe
+	proc := NewProcess("reader", "/bin/cat")
+	proc.Stdin = &Stdin{Path: input, Pipe: true}
+	runner := &DefaultRunner{}
+	if _, err := runner.Exec(proc, make(chan *Record, 10), make(chan int, 1)); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,127 @@
+package watchdog
+
+import (
+	"fmt"
+	"github.com/appio/watchdog/process"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// orphanScanInterval is how often to look for orphans between SIGCHLDs.
+// Orphans reparented when a grandchild exits don't signal the agent.
+var orphanScanInterval = 5 * time.Second
+
+// Subreap makes the agent a child subreaper and reaps descendants of its
+// processes which are orphaned and reparented to it, until Shutdown or
+// Detach. Orphans are traced back to the process they came from where
+// possible, and killed once it exits if it has KillOrphans set.
+func (w *Watchdog) Subreap() error {
+	if err := process.EnableSubreaper(); err != nil {
+		return err
+	}
+
+	w.pMu.Lock()
+	if w.reaperStop != nil {
+		w.pMu.Unlock()
+		return nil
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	w.reaperStop = stop
+	w.reaperDone = done
+	w.pMu.Unlock()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGCHLD)
+
+	interval := orphanScanInterval
+	go func() {
+		defer close(done)
+		defer signal.Stop(sigCh)
+
+		for {
+			select {
+			case <-sigCh:
+			case <-time.After(interval):
+			case <-stop:
+				return
+			}
+			w.reapOrphans()
+		}
+	}()
+	return nil
+}
+
+// stopReaper stops reaping orphans and waits for a scan in progress
+func (w *Watchdog) stopReaper() {
+	w.pMu.Lock()
+	stop, done := w.reaperStop, w.reaperDone
+	w.reaperStop, w.reaperDone = nil, nil
+	w.pMu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// reapOrphans reaps orphans which have exited and kills those left behind
+// by processes with KillOrphans set
+func (w *Watchdog) reapOrphans() {
+	orphans, err := process.FindOrphans()
+	if err != nil {
+		fmt.Println("Unable to find orphaned processes:", err)
+		return
+	}
+
+	w.pMu.Lock()
+	defer w.pMu.Unlock()
+
+	current := make(map[int]*process.Orphan)
+	for _, o := range orphans {
+		zombie := o.Zombie
+
+		// Only a live orphan can be traced, so remember it until it is reaped
+		if known, ok := w.orphans[o.Pid]; ok {
+			o = known
+		} else if !o.Zombie {
+			fmt.Printf("Orphaned process %d of %s reparented to agent\n", o.Pid, orphanOf(o))
+		}
+		current[o.Pid] = o
+
+		if zombie {
+			status, err := process.ReapOrphan(o.Pid)
+			if err != nil {
+				continue
+			}
+
+			fmt.Printf("Reaped orphaned process %d of %s, exit status %d\n", o.Pid, orphanOf(o), status)
+			delete(current, o.Pid)
+			continue
+		}
+
+		if p := w.childProcesses[o.Process]; p != nil && p.KillOrphans && leftBehind(o, p) {
+			fmt.Printf("Killing orphaned process %d of %s\n", o.Pid, o.Process)
+			syscall.Kill(o.Pid, syscall.SIGKILL)
+		}
+	}
+	w.orphans = current
+}
+
+// leftBehind reports whether an orphan outlived the instance of the process
+// it came from
+func leftBehind(o *process.Orphan, p *process.Process) bool {
+	if p.PID() == 0 {
+		return true
+	}
+	return !o.StartedAt.IsZero() && o.StartedAt.Before(p.History().StartedAt)
+}
+
+func orphanOf(o *process.Orphan) string {
+	if o.Process == "" {
+		return "unknown process"
+	}
+	return o.Process
+}
@@ -0,0 +1,72 @@
+package watchdog
+
+import (
+	"github.com/appio/watchdog/process"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSubreap_killOrphans(t *testing.T) {
+	orphanScanInterval = 50 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "watchdog")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	pidFile := filepath.Join(dir, "pid")
+
+	watchdog := New()
+	if err := watchdog.Subreap(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer watchdog.Shutdown()
+
+	// The orphan keeps the output pipes open
+	p := process.NewProcess("forker", "/bin/sh", "-c", "sleep 5 & echo $! > "+pidFile)
+	p.KillOrphans = true
+	watchdog.Add(p)
+	p.Run()
+	if err := p.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var pid int
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		data, _ := ioutil.ReadFile(pidFile)
+		if pid, err = strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pid == 0 {
+		t.Fatalf("orphan never started")
+	}
+	defer syscall.Kill(pid, syscall.SIGKILL)
+
+	// Killed once the process exits, and reaped
+	for time.Now().Before(deadline) {
+		if syscall.Kill(pid, 0) == syscall.ESRCH {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if syscall.Kill(pid, 0) != syscall.ESRCH {
+		t.Fatalf("expected orphan %d to be killed and reaped", pid)
+	}
+
+	// Its exit is handled once the orphan no longer holds its pipes open
+	for !p.IsStopped() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !p.IsStopped() {
+		t.Errorf("expected process to have exited")
+	}
+}
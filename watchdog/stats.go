@@ -0,0 +1,144 @@
+package watchdog
+
+import (
+	"fmt"
+	"github.com/appio/watchdog/process"
+	"time"
+)
+
+// statsInterval is how often the resource usage of running processes is
+// sampled
+var statsInterval = 5 * time.Second
+
+// RuleEvent records a process being restarted by one of its restart rules,
+// or for missing its watchdog keepalive
+type RuleEvent struct {
+	Process string
+	Rule    string
+	Time    time.Time
+
+	// Sample is the sample which exceeded the rule's threshold, if a restart
+	// rule was broken
+	Sample process.Sample
+
+	// Err is set if the process couldn't be restarted
+	Err error
+}
+
+// SampleStats samples the resource usage of every running process on an
+// interval until Shutdown or Detach, keeping a short history in each and
+// restarting those which break their restart rules
+func (w *Watchdog) SampleStats() {
+	w.pMu.Lock()
+	if w.statsStop != nil {
+		w.pMu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	w.statsStop = stop
+	w.pMu.Unlock()
+
+	interval := statsInterval
+	go func() {
+		for {
+			w.sampleStats()
+
+			select {
+			case <-time.After(interval):
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// RuleEvents returns the channel restarts by restart rules are reported on.
+// Events are dropped if it isn't read.
+func (w *Watchdog) RuleEvents() <-chan *RuleEvent {
+	return w.ruleEvents
+}
+
+// StopSampling stops sampling resource usage and waits for restarts in
+// progress to finish
+func (w *Watchdog) StopSampling() {
+	w.pMu.Lock()
+	if w.statsStop != nil {
+		close(w.statsStop)
+		w.statsStop = nil
+	}
+	w.pMu.Unlock()
+
+	w.restarts.Wait()
+}
+
+func (w *Watchdog) sampleStats() {
+	for _, proc := range w.Processes() {
+		if proc.PID() == 0 {
+			continue
+		}
+
+		// The process may exit while it is sampled
+		s, err := proc.Sample()
+		if err != nil {
+			continue
+		}
+
+		if rule := proc.CheckRestartRules(s); rule != nil {
+			w.restartForRule(proc, rule, s)
+		}
+	}
+}
+
+// restartForRule restarts a process which broke a restart rule, unless it
+// is already being restarted
+func (w *Watchdog) restartForRule(p *process.Process, rule *process.RestartRule, s *process.Sample) {
+	w.restart(p, &RuleEvent{
+		Process: p.Name,
+		Rule:    rule.String(),
+		Time:    s.Time,
+		Sample:  *s,
+	})
+}
+
+// restartForKeepalive restarts a process which missed its watchdog
+// keepalive, unless it is already being restarted
+func (w *Watchdog) restartForKeepalive(p *process.Process) {
+	w.restart(p, &RuleEvent{
+		Process: p.Name,
+		Rule:    fmt.Sprintf("watchdog_interval %s", p.WatchdogInterval),
+		Time:    time.Now(),
+	})
+}
+
+// restart restarts a process for the reason in event, which is reported
+// once it has restarted. Processes are only restarted while resource usage
+// is sampled.
+func (w *Watchdog) restart(p *process.Process, event *RuleEvent) {
+	w.pMu.Lock()
+	defer w.pMu.Unlock()
+
+	if w.statsStop == nil || w.restarting[p.Name] {
+		return
+	}
+	w.restarting[p.Name] = true
+	w.restarts.Add(1)
+
+	go func() {
+		defer w.restarts.Done()
+
+		fmt.Printf("Restarting process %s: %s\n", p.Name, event.Rule)
+		event.Err = p.Restart()
+		if event.Err != nil {
+			fmt.Printf("Unable to restart process %s: %s\n", p.Name, event.Err)
+		}
+
+		w.pMu.Lock()
+		delete(w.restarting, p.Name)
+		w.pMu.Unlock()
+
+		select {
+		case w.ruleEvents <- event:
+		default:
+		}
+	}()
+}
@@ -0,0 +1,46 @@
+package watchdog
+
+import (
+	"github.com/appio/watchdog/process"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSampleStats_restartRule(t *testing.T) {
+	defer func(old time.Duration) { statsInterval = old }(statsInterval)
+	statsInterval = 50 * time.Millisecond
+
+	w := New()
+
+	p := process.NewProcess("sleeper", "/bin/sleep", "5")
+	p.KillSignal = syscall.SIGTERM
+	rule, _ := process.ParseRestartRule("threads > 0 for 100ms")
+	p.RestartRules = []*process.RestartRule{rule}
+	w.Add(p)
+	p.Run()
+
+	if err := p.Start(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	pid := p.PID()
+
+	w.SampleStats()
+	defer w.Shutdown()
+
+	select {
+	case event := <-w.RuleEvents():
+		if event.Process != "sleeper" || event.Rule != "threads > 0 for 100ms" || event.Err != nil {
+			t.Fatalf("unexpected event: %#v", event)
+		}
+		if event.Sample.Pid != pid {
+			t.Errorf("expected sample of the first instance, got %#v", event.Sample)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("timed out waiting for restart")
+	}
+
+	if p.PID() == 0 || p.PID() == pid || p.Restarts != 1 {
+		t.Errorf("expected process to be restarted, pid %d restarts %d", p.PID(), p.Restarts)
+	}
+}
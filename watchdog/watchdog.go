@@ -2,9 +2,12 @@ package watchdog
 
 import (
 	"fmt"
+	"github.com/appio/watchdog/journal"
+	"github.com/appio/watchdog/outlet"
 	"github.com/appio/watchdog/process"
-	"strings"
+	"sort"
 	"sync"
+	"time"
 )
 
 // The purpose of this package is to act as a registry for processes
@@ -22,6 +25,25 @@ type Watchdog struct {
 	managed        map[string]chan bool
 	pMu            sync.Mutex
 	manage         chan int
+	journal        *journal.Journal
+
+	// managing tracks the goroutines delivering process output
+	managing sync.WaitGroup
+
+	// orphans are the orphaned descendants of processes found by the
+	// reaper, which is stopped by closing reaperStop and closes reaperDone
+	// once it has
+	orphans    map[int]*process.Orphan
+	reaperStop chan struct{}
+	reaperDone chan struct{}
+
+	// statsStop stops sampling resource usage when closed
+	statsStop chan struct{}
+
+	// restarting are the processes being restarted by a restart rule
+	restarting map[string]bool
+	restarts   sync.WaitGroup
+	ruleEvents chan *RuleEvent
 }
 
 func New() *Watchdog {
@@ -29,9 +51,20 @@ func New() *Watchdog {
 		childProcesses: make(map[string]*process.Process),
 		managed:        make(map[string]chan bool, 1),
 		manage:         make(chan int),
+		restarting:     make(map[string]bool),
+		ruleEvents:     make(chan *RuleEvent, 16),
 	}
 }
 
+// SetJournal sets the journal output is recorded to. It must be set before
+// processes are added.
+func (w *Watchdog) SetJournal(j *journal.Journal) {
+	w.pMu.Lock()
+	defer w.pMu.Unlock()
+
+	w.journal = j
+}
+
 // Add a process
 func (w *Watchdog) Add(p *process.Process) error {
 	w.pMu.Lock()
@@ -56,7 +89,9 @@ func (w *Watchdog) Remove(p *process.Process) error {
 		return fmt.Errorf("process not found: %s", p.Name)
 	}
 
-	w.managed[p.Name] <- true
+	if managed, ok := w.managed[p.Name]; ok {
+		close(managed)
+	}
 
 	delete(w.childProcesses, p.Name)
 	delete(w.managed, p.Name)
@@ -72,32 +107,171 @@ func (w *Watchdog) FindByName(name string) *process.Process {
 	return w.childProcesses[name]
 }
 
-// Shutdown stops all running processes ready for safe exit
+// Processes returns all registered processes sorted by name
+func (w *Watchdog) Processes() []*process.Process {
+	w.pMu.Lock()
+	defer w.pMu.Unlock()
+
+	names := make([]string, 0, len(w.childProcesses))
+	for name := range w.childProcesses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	procs := make([]*process.Process, 0, len(names))
+	for _, name := range names {
+		procs = append(procs, w.childProcesses[name])
+	}
+	return procs
+}
+
+// Shutdown stops all running processes in parallel and waits for them to
+// exit, ready for safe exit. Each process is killed if it is still running
+// after its kill timeout, so shutting down takes at most StopTimeout.
 func (w *Watchdog) Shutdown() error {
 	fmt.Println("Watchdog shutting down...")
-	for _, proc := range w.childProcesses {
-		if proc.IsRunning() {
+
+	// Nothing is restarted while processes are stopped
+	w.StopSampling()
+
+	procs := w.Processes()
+	errCh := make(chan error, len(procs))
+	var wg sync.WaitGroup
+	for _, proc := range procs {
+		if proc.IsStopped() {
+			continue
+		}
+
+		wg.Add(1)
+		go func(proc *process.Process) {
+			defer wg.Done()
+
 			fmt.Printf("Stopping process: %s\n", proc.Name)
-			proc.Stop()
+			if err := proc.StopWait(); err != nil {
+				errCh <- err
+			}
+		}(proc)
+	}
+	wg.Wait()
+	close(errCh)
+
+	w.stopManaging()
+	return <-errCh
+}
+
+// StopTimeout is the longest Shutdown can take, which is the longest any
+// registered process can take to stop
+func (w *Watchdog) StopTimeout() time.Duration {
+	var timeout time.Duration
+	for _, proc := range w.Processes() {
+		if t := proc.StopTimeout(); t > timeout {
+			timeout = t
 		}
 	}
+	return timeout
+}
 
-	return nil
+// Detach stops delivering process output without stopping the processes, so
+// they can be handed over to a new agent. Output already buffered is
+// delivered and outlets are closed before it returns.
+func (w *Watchdog) Detach() {
+	w.stopManaging()
 }
+
+// Reattach delivers process output again after Detach, when the processes
+// weren't handed over after all
+func (w *Watchdog) Reattach() {
+	w.pMu.Lock()
+	defer w.pMu.Unlock()
+
+	for name, p := range w.childProcesses {
+		if _, ok := w.managed[name]; !ok {
+			w.manageProcess(p)
+		}
+	}
+}
+
+// stopManaging stops every output goroutine and waits for them to finish
+func (w *Watchdog) stopManaging() {
+	w.stopReaper()
+	w.StopSampling()
+
+	w.pMu.Lock()
+	for name, managed := range w.managed {
+		close(managed)
+		delete(w.managed, name)
+	}
+	w.pMu.Unlock()
+
+	w.managing.Wait()
+}
+
 func (w *Watchdog) manageProcess(p *process.Process) error {
-	w.managed[p.Name] = make(chan bool)
+	managed := make(chan bool)
+	w.managed[p.Name] = managed
+
+	outlets := w.openOutlets(p)
+	journal := w.journal
 
+	deliver := func(r *process.Record) {
+		fmt.Printf("[%s] > %s\n", p.Name, r.Line)
+
+		if journal != nil {
+			if err := journal.Append(r); err != nil {
+				fmt.Printf("Unable to journal output of %s: %s\n", p.Name, err)
+			}
+		}
+
+		for _, o := range outlets {
+			o.Write(r)
+		}
+	}
+
+	w.managing.Add(1)
 	go func() {
+		defer w.managing.Done()
+		defer func() {
+			for _, o := range outlets {
+				o.Close()
+			}
+		}()
+
 		for {
 			select {
-			case <-w.managed[p.Name]:
-				return
+			case <-managed:
+				// Deliver whatever is still buffered before giving up
+				for {
+					select {
+					case r := <-p.OutputChan():
+						deliver(r)
+					default:
+						return
+					}
+				}
 
-			case out := <-p.OutputChan():
-				fmt.Printf("[%s] > %s\n", p.Name, strings.TrimRight(string(out), "\n"))
+			case r := <-p.OutputChan():
+				deliver(r)
+
+			case <-p.KeepaliveMissed():
+				w.restartForKeepalive(p)
 			}
 		}
 	}()
 
 	return nil
 }
+
+// openOutlets constructs the outlets configured for a process. Outlets which
+// fail to construct are reported and skipped so the process still runs.
+func (w *Watchdog) openOutlets(p *process.Process) []outlet.Outlet {
+	var outlets []outlet.Outlet
+	for name, config := range p.Outlets {
+		o, err := outlet.New(name, p.Name, config)
+		if err != nil {
+			fmt.Printf("Unable to open %s outlet for %s: %s\n", name, p.Name, err)
+			continue
+		}
+		outlets = append(outlets, o)
+	}
+	return outlets
+}
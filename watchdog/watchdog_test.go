@@ -3,6 +3,7 @@ package watchdog
 import (
 	"github.com/appio/watchdog/process"
 	"testing"
+	"time"
 )
 
 func TestAddProcess(t *testing.T) {
@@ -49,5 +50,34 @@ func TestFindProcessByName(t *testing.T) {
 }
 
 func TestWatchdogShutdown(t *testing.T) {
+	watchdog := New()
+
+	// Both ignore their kill signal, so have to be killed
+	var procs []*process.Process
+	for _, name := range []string{"one", "two"} {
+		p := process.NewProcess(name, "/bin/sh", "-c", `trap "" QUIT; exec sleep 5`)
+		p.KillTimeout = 300 * time.Millisecond
+		watchdog.Add(p)
+		p.Run()
+		if err := p.Start(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		procs = append(procs, p)
+	}
+	time.Sleep(100 * time.Millisecond)
 
+	start := time.Now()
+	if err := watchdog.Shutdown(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Stopped in parallel, not one kill timeout after the other
+	if elapsed := time.Since(start); elapsed > 550*time.Millisecond {
+		t.Errorf("shutdown took %s", elapsed)
+	}
+	for _, p := range procs {
+		if !p.IsStopped() || p.PID() != 0 {
+			t.Errorf("expected %s to be stopped", p.Name)
+		}
+	}
 }